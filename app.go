@@ -1,24 +1,39 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/wailsapp/wails/v3/pkg/application"
+	"golang.org/x/sync/singleflight"
+	"tailscale.com/net/tsaddr"
 
 	"github.com/open-beagle/awecloud-signaling-desktop/internal/banner"
 	"github.com/open-beagle/awecloud-signaling-desktop/internal/client"
 	"github.com/open-beagle/awecloud-signaling-desktop/internal/config"
 	"github.com/open-beagle/awecloud-signaling-desktop/internal/containerroute"
 	"github.com/open-beagle/awecloud-signaling-desktop/internal/dns"
+	"github.com/open-beagle/awecloud-signaling-desktop/internal/localca"
 	"github.com/open-beagle/awecloud-signaling-desktop/internal/proxy"
+	"github.com/open-beagle/awecloud-signaling-desktop/internal/sysjournal"
 	"github.com/open-beagle/awecloud-signaling-desktop/internal/tailscale"
 	appVersion "github.com/open-beagle/awecloud-signaling-desktop/internal/version"
 	"github.com/open-beagle/awecloud-signaling-desktop/internal/vip"
+	pb "github.com/open-beagle/awecloud-signaling-desktop/pkg/proto"
 )
 
 // App struct
@@ -35,7 +50,27 @@ type App struct {
 	networkCfg      *vip.NetworkConfig // VIP 网络配置（macOS loopback alias 管理）
 	proxyManager    *proxy.Manager
 	svcProxyMgr     *proxy.SVCProxyManager // K8S Service gRPC 代理管理器
+	localCA         *localca.CA            // 本地 CA，为 k8sapi TLS 代理签发证书（加载失败时为空，退回自签证书）
+	webProxy        *proxy.WebProxy        // 按 Host 路由的 Web 代理，web 类型域名共用一个 VIP 的 80 / 443 端口
+	webSyncMu       sync.Mutex             // 串行执行数据流推送后的 Web 路由同步
+	socksServer     *proxy.SOCKSServer     // 本地 SOCKS5 代理（配置了监听地址时运行）
 	containerRoutes *containerroute.Manager
+	systemResolvers []string       // 配置系统 DNS 之前探测到的系统原有上游 DNS
+	dnsQueryStream  bool           // 是否实时推送 DNS 查询日志到前端
+	dnsOverrides    *dns.Overrides // 用户自定义的本地 DNS 覆盖（别名、静态地址）
+	dnsPort         int            // 系统 DNS 指向的本地 DNS 端口
+
+	// 已解析域名的 Server 解析结果（用于应答 SRV / TXT 查询）
+	domainResults map[string]*client.DomainResolveResult
+	domainMu      sync.Mutex
+
+	// 域名解析去重与否定缓存（数据流推送变更时失效）
+	resolveGroup    singleflight.Group
+	resolveGen      atomic.Uint64        // 缓存代数，每次失效时递增
+	rejectedDomains map[string]time.Time // 被 Server 拒绝的域名 → 过期时间（domainMu 保护）
+
+	// 系统修改日志（系统 DNS、loopback alias、kubeconfig），异常退出后下次启动回滚
+	sysJournal *sysjournal.Journal
 }
 
 // NewApp creates a new App application struct
@@ -58,11 +93,68 @@ func (a *App) startup() {
 
 	config.GlobalConfig = cfg
 	log.Printf("Using server address: %s", config.GlobalConfig.ServerAddress)
+	migrateSOCKSPassword()
+
+	// 回滚上次异常退出遗留的系统修改（系统 DNS 指向已不存在的本地 DNS 等）
+	a.openSysJournal()
+	a.openDNSOverrides()
 
 	a.setupSystemTray()
 	log.Printf("System tray started")
 }
 
+// openSysJournal 打开系统修改日志，注册各类修改的回滚方式，并回滚已退出进程遗留的修改
+func (a *App) openSysJournal() {
+	j, err := sysjournal.Open()
+	if err != nil {
+		log.Printf("[App] 打开系统修改日志失败: %v", err)
+		return
+	}
+	j.SetReverter(sysjournal.KindDNS, func(*sysjournal.Entry) error {
+		return dns.CleanupSystemDNS()
+	})
+	j.SetReverter(sysjournal.KindLoopbackAlias, func(e *sysjournal.Entry) error {
+		return vip.RemoveAlias(e.Target)
+	})
+	j.SetReverter(sysjournal.KindKubeconfig, revertKubeconfig)
+	a.sysJournal = j
+
+	if results := j.Recover(); len(results) > 0 {
+		log.Printf("[App] 已处理 %d 条异常退出遗留的系统修改", len(results))
+	}
+}
+
+// recordChange 修改系统之前写入系统修改日志，失败只记录日志（不影响修改本身）
+func (a *App) recordChange(kind sysjournal.Kind, target, data string) {
+	if a.sysJournal == nil {
+		return
+	}
+	if err := a.sysJournal.Record(kind, target, data); err != nil {
+		log.Printf("[App] 记录系统修改失败: %s %s: %v", kind, target, err)
+	}
+}
+
+// forgetChange 修改已正常撤销后删除记录，target 为空时删除该类型的全部记录
+func (a *App) forgetChange(kind sysjournal.Kind, target string) {
+	if a.sysJournal == nil {
+		return
+	}
+	if err := a.sysJournal.Remove(kind, target); err != nil {
+		log.Printf("[App] 删除系统修改记录失败: %s %s: %v", kind, target, err)
+	}
+}
+
+// RepairNetworkSettings 修复网络设置：回滚异常退出的进程遗留的系统 DNS、loopback alias 和 kubeconfig 修改
+// 当前进程正在使用的修改不受影响
+func (a *App) RepairNetworkSettings() ([]*sysjournal.RepairResult, error) {
+	if a.sysJournal == nil {
+		return nil, fmt.Errorf("系统修改日志不可用")
+	}
+	results := a.sysJournal.Recover()
+	log.Printf("[App] 修复网络设置: 处理 %d 条遗留修改", len(results))
+	return results, nil
+}
+
 func (a *App) setupSystemTray() {
 	if mainApp == nil {
 		log.Printf("[App] mainApp is nil, cannot setup system tray")
@@ -102,6 +194,9 @@ func (a *App) shutdown() {
 	// 清理 ZTNA 网络栈
 	a.cleanupZTNA()
 
+	// 与异常退出后的回滚一致：删除本程序添加的集群、上下文和用户，保留其他内容
+	a.cleanupKubeconfig()
+
 	if a.desktopClient != nil {
 		a.desktopClient.Stop()
 	}
@@ -116,6 +211,8 @@ func (a *App) cleanupZTNA() {
 	// 清理系统 DNS 配置
 	if err := dns.CleanupSystemDNS(); err != nil {
 		log.Printf("[App] 清理系统 DNS 失败: %v", err)
+	} else {
+		a.forgetChange(sysjournal.KindDNS, "")
 	}
 
 	// 停止 DNS 服务器
@@ -136,6 +233,18 @@ func (a *App) cleanupZTNA() {
 		a.svcProxyMgr = nil
 	}
 
+	// 停止 Web 代理
+	if a.webProxy != nil {
+		a.webProxy.Stop()
+		a.webProxy = nil
+	}
+
+	// 停止 SOCKS5 代理
+	if a.socksServer != nil {
+		a.socksServer.Stop()
+		a.socksServer = nil
+	}
+
 	// 清理 VIP 网络配置（macOS 上删除 loopback alias）
 	if a.networkCfg != nil {
 		a.networkCfg.Cleanup()
@@ -277,73 +386,466 @@ func (a *App) initializeTailscale() error {
 func (a *App) initializeZTNA() error {
 	log.Printf("[App] 初始化 ZTNA 网络栈...")
 
-	// 1. 创建 VIP 分配器
-	a.vipAllocator = vip.NewAllocator()
+	// 1. 创建 VIP 分配器，恢复该 Server 之前的域名 → VIP 分配
+	a.vipAllocator = newVIPAllocator()
+	if store := a.openVIPStore(); store != nil {
+		if restored, err := a.vipAllocator.SetStore(store); err != nil {
+			log.Printf("[App] Warning: 恢复 VIP 分配失败: %v", err)
+		} else {
+			log.Printf("[App] 已恢复 %d 个 VIP 分配（%s）", restored, store.Path())
+		}
+	}
 
 	// 1.5 初始化 VIP 网络配置（macOS 上管理 loopback alias）
 	a.networkCfg = vip.NewNetworkConfig()
+	a.networkCfg.SetJournal(a.sysJournal)
 	if err := a.networkCfg.Setup(); err != nil {
 		log.Printf("[App] Warning: VIP 网络配置失败: %v", err)
 	}
 
-	// 设置 VIP 分配回调（macOS 上按需添加 loopback alias）
+	// 设置 VIP 分配 / 回收回调（macOS 上按需添加、删除 loopback alias）
 	a.vipAllocator.SetOnAllocate(func(vipAddr string) error {
 		return a.networkCfg.AddAlias(vipAddr)
 	})
+	a.vipAllocator.SetOnRecycle(func(vipAddr string) error {
+		return a.networkCfg.DropAlias(vipAddr)
+	})
 
 	// 2. 创建本地代理管理器（使用 tsnet Dial）
 	a.proxyManager = proxy.NewManager(a.tsManager.Dial)
+	if a.localCA = a.openLocalCA(); a.localCA != nil {
+		a.proxyManager.SetCertFunc(a.localCA.Certificate)
+	}
+	a.proxyManager.SetIdentityFunc(a.proxyIdentity)
+	a.proxyManager.SetOnBreakerOpen(a.onBreakerOpen)
 	a.containerRoutes = containerroute.NewManager(a.vipAllocator, a.proxyManager)
 
 	// 2.5 创建 K8S Service gRPC 代理管理器
 	a.svcProxyMgr = proxy.NewSVCProxyManager(a.tsManager.Dial)
 
+	// 2.6 创建 Web 代理（第一个 web 类型域名解析时启动）
+	a.webProxy = proxy.NewWebProxy(a.tsManager.Dial)
+	if a.localCA != nil {
+		a.webProxy.SetCertFunc(a.localCA.Certificate)
+	}
+
+	// 空闲代理回收后释放 VIP，下次 DNS 查询时重新创建
+	a.applyProxyIdleTimeout()
+
 	// 3. 创建并启动本地 DNS 服务器
 	// 使用平台推荐地址：macOS 用 127.0.0.1:15353（macOS 默认无 127.0.0.2），其他平台用 127.0.0.2
+	// Linux 的端口取决于系统 DNS 后端：systemd-resolved / dnsmasq 用 5353，resolvconf / resolv.conf 只能用 53
 	dnsPort := dns.RecommendedPort()
 	dnsAddr := dns.RecommendedListenAddr()
 
+	// 上游 DNS 必须在修改系统 DNS 之前探测，否则拿到的是本地 DNS 自身
+	a.systemResolvers = dns.SystemResolvers()
+
+	a.domainMu.Lock()
+	a.domainResults = make(map[string]*client.DomainResolveResult)
+	a.rejectedDomains = make(map[string]time.Time)
+	a.domainMu.Unlock()
+
+	// Server 推送数据变更（授权、域名变化）时，之前的解析结果和否定缓存可能已失效，区域、租户也可能变化
+	a.desktopClient.SetDataChangedCallback(func() {
+		a.invalidateDomainCache()
+		go a.updateDNSSearch()
+		go a.syncWebRoutes()
+	})
+
+	zones := a.dnsZones()
+	a.proxyManager.SetZones(zones)
+
 	a.dnsServer = dns.NewServer(dnsAddr, a.resolveDomain)
+	a.dnsServer.SetZones(zones)
+	a.dnsServer.SetRecordFunc(a.domainRecord)
+	a.dnsServer.SetReverseFunc(a.vipAllocator.Resolve, a.vipAllocator.Network())
+	if a.dnsOverrides != nil {
+		a.dnsServer.SetOverrides(a.dnsOverrides)
+	}
+	a.dnsServer.SetUpstreams(a.dnsUpstreams())
+	a.applyDNSQueryStream()
 	if err := a.dnsServer.Start(); err != nil {
 		return fmt.Errorf("启动 DNS 服务器失败: %w", err)
 	}
 
-	// 4. 配置系统 DNS（将 .beagle 域名指向本地 DNS）
-	if err := dns.ConfigureSystemDNS(dnsPort); err != nil {
-		log.Printf("[App] Warning: 系统 DNS 配置失败: %v", err)
-		// 不返回错误，用户可以手动配置
-	}
+	// 短名称搜索后缀只在本地 DNS 中使用，不注册到系统 DNS
+	a.updateDNSSearch()
+
+	// 数据流可能在回调设置之前已推送过服务列表
+	a.syncWebRoutes()
+
+	// 4. 配置系统 DNS（将内部域名后缀指向本地 DNS），先记录以便异常退出后回滚
+	a.dnsPort = dnsPort
+	a.configureSystemDNS(zones)
+
+	// 5. 启动本地 SOCKS5 代理（可选，供不走系统 DNS 的应用使用）
+	a.socksServer = proxy.NewSOCKSServer(a.socksDial)
+	a.startSOCKS()
 
 	log.Printf("[App] ZTNA 网络栈已就绪（DNS=%s）", dnsAddr)
 	return nil
 }
 
+// newVIPAllocator 按配置的地址段创建 VIP 分配器，地址段无效或与本机地址冲突时使用默认地址段
+func newVIPAllocator() *vip.Allocator {
+	pool := config.GlobalConfig.VIPPool
+	if pool == "" {
+		return vip.NewAllocator()
+	}
+	if err := validateVIPPool(pool); err != nil {
+		log.Printf("[App] Warning: %v，使用默认地址段 %s", err, vip.DefaultCIDR)
+		return vip.NewAllocator()
+	}
+	allocator, err := vip.NewAllocatorWithCIDR(pool)
+	if err != nil {
+		log.Printf("[App] Warning: %v，使用默认地址段 %s", err, vip.DefaultCIDR)
+		return vip.NewAllocator()
+	}
+	log.Printf("[App] VIP 地址段: %s", pool)
+	return allocator
+}
+
+// validateVIPPool 校验 VIP 地址段，本地 DNS 的监听地址不能落在地址段内
+func validateVIPPool(pool string) error {
+	dnsHost, _, _ := net.SplitHostPort(dns.RecommendedListenAddr())
+	return vip.ValidatePool(pool, dnsHost)
+}
+
+// GetVIPPool 返回当前使用的 VIP 地址段（未连接时返回配置的地址段）
+func (a *App) GetVIPPool() string {
+	if a.vipAllocator != nil {
+		return a.vipAllocator.Network().String()
+	}
+	if config.GlobalConfig.VIPPool != "" {
+		return config.GlobalConfig.VIPPool
+	}
+	return vip.DefaultCIDR
+}
+
+// SetVIPPool 设置 VIP 地址段，传空字符串恢复默认地址段
+// 地址段必须位于 127.0.0.0/8 内且不与本机接口地址冲突；下次连接时生效，原地址段内的分配不再沿用
+func (a *App) SetVIPPool(pool string) error {
+	log.Printf("[App] SetVIPPool: %s", pool)
+
+	pool = strings.TrimSpace(pool)
+	if pool != "" {
+		if err := validateVIPPool(pool); err != nil {
+			return err
+		}
+		_, network, _ := net.ParseCIDR(pool)
+		pool = network.String()
+	}
+
+	config.GlobalConfig.VIPPool = pool
+	if err := config.GlobalConfig.Save(); err != nil {
+		return fmt.Errorf("保存配置失败: %w", err)
+	}
+	return nil
+}
+
+// vipStoreDir VIP 分配持久化目录（位于应用目录，每个 Server 一个文件）
+const vipStoreDir = "vip"
+
+// openVIPStore 打开当前 Server 的 VIP 分配持久化文件，应用目录不可用时返回 nil（只在内存中分配）
+func (a *App) openVIPStore() *vip.Store {
+	appDir, err := config.GetAppDir()
+	if err != nil {
+		log.Printf("[App] 获取应用目录失败: %v", err)
+		return nil
+	}
+	dir := filepath.Join(appDir, vipStoreDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Printf("[App] 创建 VIP 分配目录失败: %v", err)
+		return nil
+	}
+	server := config.GlobalConfig.ServerAddress
+	return vip.NewStore(filepath.Join(dir, vip.StoreFileName(server)), server)
+}
+
+// proxyIdentity 返回 PROXY protocol 头部中的桌面身份（隧道 IP、用户名、Desktop ID）
+func (a *App) proxyIdentity() proxy.Identity {
+	identity := proxy.Identity{User: config.GlobalConfig.ClientID}
+	if a.tsManager != nil {
+		identity.TunnelIP = a.tsManager.GetIP()
+	}
+	if a.authResult != nil {
+		identity.DesktopID = a.authResult.DesktopID
+	}
+	return identity
+}
+
+// localCADir 本地 CA 目录（位于应用目录）
+const localCADir = "ca"
+
+// openLocalCA 加载应用目录中的本地 CA（不存在时生成），失败时返回 nil，TLS 代理退回自签证书
+func (a *App) openLocalCA() *localca.CA {
+	appDir, err := config.GetAppDir()
+	if err != nil {
+		log.Printf("[App] 获取应用目录失败: %v", err)
+		return nil
+	}
+	ca, err := localca.Load(filepath.Join(appDir, localCADir))
+	if err != nil {
+		log.Printf("[App] Warning: 加载本地 CA 失败，kubeconfig 将跳过证书验证: %v", err)
+		return nil
+	}
+	return ca
+}
+
+// ResetVIPMap 清空当前 Server 的域名 → VIP 分配（包括持久化文件）
+// 已启动的代理全部停止，域名在下次 DNS 查询时重新解析并从第一个地址开始分配
+func (a *App) ResetVIPMap() error {
+	log.Printf("[App] ResetVIPMap")
+
+	if a.vipAllocator == nil {
+		// 未连接时只删除持久化文件
+		if store := a.openVIPStore(); store != nil {
+			return store.Delete()
+		}
+		return nil
+	}
+
+	active, err := a.vipAllocator.Reset()
+	for domain, vipAddr := range active {
+		a.stopDomainProxies(domain, vipAddr)
+	}
+	if a.proxyManager != nil {
+		a.containerRoutes = containerroute.NewManager(a.vipAllocator, a.proxyManager)
+	}
+	// Web 代理的 VIP 也已清空，下次解析 web 类型域名时重新分配并启动
+	if a.webProxy != nil {
+		a.webProxy.Stop()
+		a.webProxy.ClearRoutes()
+	}
+
+	a.domainMu.Lock()
+	a.domainResults = make(map[string]*client.DomainResolveResult)
+	a.domainMu.Unlock()
+	a.invalidateDomainCache()
+
+	log.Printf("[App] 已清空 %d 个 VIP 分配", len(active))
+	return err
+}
+
+// proxyIdleTimeout 返回代理空闲回收时间，为 0 表示不回收
+func proxyIdleTimeout() time.Duration {
+	switch minutes := config.GlobalConfig.ProxyIdle; {
+	case minutes < 0:
+		return 0
+	case minutes == 0:
+		return proxy.DefaultIdleTimeout
+	default:
+		return time.Duration(minutes) * time.Minute
+	}
+}
+
+// applyProxyIdleTimeout 将空闲回收时间应用到两个代理管理器
+func (a *App) applyProxyIdleTimeout() {
+	timeout := proxyIdleTimeout()
+	if a.proxyManager != nil {
+		a.proxyManager.SetIdleTimeout(timeout, func(t proxy.Target) {
+			a.onProxyIdle(t.Domain, t.VIP)
+		})
+	}
+	if a.svcProxyMgr != nil {
+		a.svcProxyMgr.SetIdleTimeout(timeout, func(t proxy.SVCTarget) {
+			a.onProxyIdle(t.Domain, t.VIP)
+		})
+	}
+}
+
+// SetProxyIdleTimeout 设置代理空闲回收时间（分钟）并立即生效，0 恢复默认值，负数不回收
+func (a *App) SetProxyIdleTimeout(minutes int) error {
+	log.Printf("[App] SetProxyIdleTimeout: %d", minutes)
+
+	config.GlobalConfig.ProxyIdle = minutes
+	if err := config.GlobalConfig.Save(); err != nil {
+		return fmt.Errorf("保存配置失败: %w", err)
+	}
+	a.applyProxyIdleTimeout()
+	return nil
+}
+
+// onProxyIdle 代理空闲回收后，如果该 VIP 上已没有其他代理则释放域名的 VIP 映射
+// 释放后本地 DNS 下次查询该域名时重新走 Server 解析并启动代理（VIP 保持不变）
+func (a *App) onProxyIdle(domain, vipAddr string) {
+	if a.vipAllocator == nil || a.hasProxiesOn(vipAddr) {
+		return
+	}
+	a.vipAllocator.Release(domain)
+
+	a.domainMu.Lock()
+	delete(a.domainResults, domain)
+	a.domainMu.Unlock()
+
+	log.Printf("[App] 域名空闲，已释放 VIP: %s (%s)", domain, vipAddr)
+}
+
+// onBreakerOpen 代理目标熔断后重新向 Server 解析域名，Agent 的 IP 变化时更新代理的远程地址
+// 容器路由的代理（KeepAlive）不是 Server 下发的域名，不重新解析
+func (a *App) onBreakerOpen(t proxy.Target) {
+	if t.KeepAlive || a.desktopClient == nil || a.proxyManager == nil {
+		return
+	}
+	result, err := a.desktopClient.ResolveDomain(t.Domain)
+	if err != nil {
+		log.Printf("[App] 熔断后重新解析失败 (%s): %v", t.Domain, err)
+		return
+	}
+
+	a.domainMu.Lock()
+	if _, ok := a.domainResults[t.Domain]; ok {
+		a.domainResults[t.Domain] = result
+	}
+	a.domainMu.Unlock()
+
+	remoteAddr := fmt.Sprintf("%s:%d", result.AgentIP, result.TargetPort)
+	if remoteAddr == t.RemoteAddr {
+		log.Printf("[App] 熔断后重新解析 %s，远程地址未变化: %s", t.Domain, remoteAddr)
+		return
+	}
+	if a.proxyManager.UpdateRemote(t.VIP, t.Port, remoteAddr) {
+		log.Printf("[App] 熔断后重新解析 %s，远程地址已更新: %s → %s", t.Domain, t.RemoteAddr, remoteAddr)
+	}
+}
+
+// hasProxiesOn 报告 VIP 上是否还有运行中的代理
+func (a *App) hasProxiesOn(vipAddr string) bool {
+	if a.proxyManager != nil {
+		for _, t := range a.proxyManager.GetStatus() {
+			if t.VIP == vipAddr {
+				return true
+			}
+		}
+	}
+	if a.svcProxyMgr != nil {
+		for _, t := range a.svcProxyMgr.GetStatus() {
+			if t.VIP == vipAddr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stopDomainProxies 停止域名在 VIP 上的全部代理（TCP / UDP 代理和 SVCProxy）
+func (a *App) stopDomainProxies(domain, vipAddr string) {
+	if a.proxyManager != nil {
+		for _, t := range a.proxyManager.GetStatus() {
+			if t.Domain != domain || t.VIP != vipAddr {
+				continue
+			}
+			if t.UDP {
+				a.proxyManager.StopUDPProxy(t.VIP, t.Port)
+			} else {
+				a.proxyManager.StopProxy(t.VIP, t.Port)
+			}
+		}
+	}
+	if a.svcProxyMgr != nil {
+		for _, t := range a.svcProxyMgr.GetStatus() {
+			if t.Domain == domain && t.VIP == vipAddr {
+				a.svcProxyMgr.StopSVCProxy(t.VIP, t.Port)
+			}
+		}
+	}
+}
+
+// dnsZones 返回本地 DNS 拦截的内部域名后缀：优先使用用户配置，其次使用 Server 认证时下发的后缀，默认 beagle
+func (a *App) dnsZones() []string {
+	if len(config.GlobalConfig.DNSZones) > 0 {
+		return dns.NormalizeZones(config.GlobalConfig.DNSZones)
+	}
+	if a.authResult != nil {
+		return dns.NormalizeZones(a.authResult.DNSZones)
+	}
+	return dns.NormalizeZones(nil)
+}
+
+// configureSystemDNS 配置系统 DNS，失败只记录日志（用户可以手动配置）
+func (a *App) configureSystemDNS(zones []string) {
+	a.recordChange(sysjournal.KindDNS, strings.Join(zones, ","), "")
+	if err := dns.ConfigureSystemDNS(a.dnsPort, zones); err != nil {
+		log.Printf("[App] Warning: 系统 DNS 配置失败: %v", err)
+	}
+}
+
+// dnsUpstreams 返回上游 DNS 列表：优先使用用户配置，否则使用系统原有 DNS
+func (a *App) dnsUpstreams() []string {
+	if len(config.GlobalConfig.DNSUpstreams) > 0 {
+		return config.GlobalConfig.DNSUpstreams
+	}
+	return a.systemResolvers
+}
+
+// rejectedDomainTTL 被 Server 拒绝的域名在该时间内直接返回 NXDOMAIN，不再查询 Server
+const rejectedDomainTTL = 30 * time.Second
+
 // resolveDomain DNS 解析回调：查询 Server → 分配 VIP → 启动代理
+// 解析器通常会并发发出多个相同查询，同一域名同时只有一个解析在进行，其余查询等待并共享结果
 func (a *App) resolveDomain(domain string) (string, bool) {
 	// 先检查是否已有 VIP 映射
 	if existingVIP, ok := a.vipAllocator.GetVIP(domain); ok {
 		return existingVIP, true
 	}
 
+	// web 类型域名共用 Web 代理的 VIP，已有路由时不再查询 Server
+	if a.webProxy != nil && a.webProxy.HasRoute(domain) {
+		if vipAddr := a.webProxy.VIP(); vipAddr != "" {
+			return vipAddr, true
+		}
+	}
+
+	if a.isDomainRejected(domain) {
+		return "", false
+	}
+
+	// key 带上缓存代数：数据流推送变更后，新查询不会复用变更前发起的解析
+	gen := a.resolveGen.Load()
+	v, _, _ := a.resolveGroup.Do(fmt.Sprintf("%d/%s", gen, domain), func() (interface{}, error) {
+		return a.resolveDomainOnce(domain, gen), nil
+	})
+	vipAddr := v.(string)
+	return vipAddr, vipAddr != ""
+}
+
+// resolveDomainOnce 执行一次完整的域名解析，失败时返回空字符串
+func (a *App) resolveDomainOnce(domain string, gen uint64) string {
 	// 查询 Server 域名解析
 	if a.desktopClient == nil {
 		log.Printf("[App] DNS 解析失败: 未登录")
-		return "", false
+		return ""
 	}
 
 	result, err := a.desktopClient.ResolveDomain(domain)
 	if err != nil {
 		log.Printf("[App] DNS 解析失败 (%s): %v", domain, err)
-		return "", false
+		if errors.Is(err, client.ErrDomainRejected) {
+			a.rejectDomain(domain, gen)
+		}
+		return ""
+	}
+
+	// Web：共用 Web 代理的 VIP，按 Host 路由，不单独分配 VIP
+	if result.DomainType == "web" {
+		a.domainMu.Lock()
+		a.domainResults[domain] = result
+		a.domainMu.Unlock()
+		return a.routeWebDomain(webResolvedRoute(domain, result))
 	}
 
 	// 分配 VIP
 	vipAddr, err := a.vipAllocator.Allocate(domain)
 	if err != nil {
 		log.Printf("[App] VIP 分配失败 (%s): %v", domain, err)
-		return "", false
+		return ""
 	}
 
+	a.domainMu.Lock()
+	a.domainResults[domain] = result
+	a.domainMu.Unlock()
+
 	// 根据域名类型选择代理方式
 	if result.DomainType == "k8ssvc" {
 		// K8S Service：需要从 GetDomainList 获取 ServicePorts
@@ -351,7 +853,7 @@ func (a *App) resolveDomain(domain string) (string, bool) {
 		domains, err := a.desktopClient.GetDomainList()
 		if err != nil {
 			log.Printf("[App] 获取域名列表失败 (%s): %v", domain, err)
-			return "", false
+			return ""
 		}
 
 		// 查找当前域名的 ServicePorts
@@ -365,7 +867,7 @@ func (a *App) resolveDomain(domain string) (string, bool) {
 
 		if len(servicePorts) == 0 {
 			log.Printf("[App] K8S Service 域名 %s 没有 service_ports", domain)
-			return "", false
+			return ""
 		}
 
 		// 为每个端口创建独立的 SVCProxy
@@ -396,84 +898,284 @@ func (a *App) resolveDomain(domain string) (string, bool) {
 					result.Namespace, result.ServiceName)
 			}
 		}
+		if len(result.UDPPorts) > 0 {
+			// SVCProxy 的 gRPC 流只承载 TCP 语义，K8S Service 的 UDP 端口暂不转发
+			log.Printf("[App] K8S Service 域名 %s 的 UDP 端口 %v 暂不支持转发", domain, result.UDPPorts)
+		}
 	} else {
-		// SSH / K8SAPI / 其他：通过普通 TCP 代理
-		remoteAddr := fmt.Sprintf("%s:%d", result.AgentIP, result.TargetPort)
-
-		// SSH 类型域名：本地监听 22 端口（SSH 客户端默认端口），远程转发到 Agent 分配的端口
-		// K8SAPI 类型域名：本地监听 6443 端口（kubectl 默认端口），远程转发到 Agent 分配的端口
-		localPort := result.TargetPort
-		if result.DomainType == "ssh" {
-			localPort = 22
-		} else if result.DomainType == "k8sapi" {
-			localPort = 6443
-		}
-
-		target := proxy.Target{
-			Domain:     domain,
-			VIP:        vipAddr,
-			RemoteAddr: remoteAddr,
-			Port:       localPort,
-			TLS:        result.DomainType == "k8sapi", // K8S API 需要本地 TLS 终止，kubectl 默认 HTTPS
-		}
-		if err := a.proxyManager.StartProxy(target); err != nil {
-			log.Printf("[App] 代理启动失败 (%s → %s): %v", domain, remoteAddr, err)
-		} else {
-			log.Printf("[App] 代理已启动: %s:%d → %s (domain=%s, type=%s)",
-				vipAddr, localPort, remoteAddr, domain, result.DomainType)
+		// SSH / K8SAPI / 其他：通过普通 TCP 代理（udp 类型只有 UDP 端口）
+		if result.DomainType != "udp" {
+			remoteAddr := fmt.Sprintf("%s:%d", result.AgentIP, result.TargetPort)
+
+			localPort := localListenPort(result.DomainType, result.TargetPort)
+
+			target := proxy.Target{
+				Domain:     domain,
+				VIP:        vipAddr,
+				RemoteAddr: remoteAddr,
+				Port:       localPort,
+				TLS:        result.DomainType == "k8sapi", // K8S API 需要本地 TLS 终止，kubectl 默认 HTTPS
+
+				ProxyProtocol: proxy.ParseProxyProtocol(result.ProxyProtocol),
+				ProxyTLV:      result.ProxyProtocolTLV,
+			}
+			if err := a.proxyManager.StartProxy(target); err != nil {
+				log.Printf("[App] 代理启动失败 (%s → %s): %v", domain, remoteAddr, err)
+			} else {
+				log.Printf("[App] 代理已启动: %s:%d → %s (domain=%s, type=%s)",
+					vipAddr, localPort, remoteAddr, domain, result.DomainType)
+			}
+		}
+
+		// UDP 端口：本地端口与远程端口相同
+		for _, port := range result.UDPPorts {
+			remoteAddr := fmt.Sprintf("%s:%d", result.AgentIP, port)
+			target := proxy.Target{
+				Domain:     domain,
+				VIP:        vipAddr,
+				RemoteAddr: remoteAddr,
+				Port:       int(port),
+			}
+			if err := a.proxyManager.StartUDPProxy(target); err != nil {
+				log.Printf("[App] UDP 代理启动失败 (%s → %s): %v", domain, remoteAddr, err)
+			} else {
+				log.Printf("[App] UDP 代理已启动: %s:%d → %s (domain=%s)", vipAddr, port, remoteAddr, domain)
+			}
 		}
 	}
 
-	return vipAddr, true
+	return vipAddr
 }
 
-func (a *App) Logout() {
-	log.Printf("[App] Logout called")
+// webProxyVIPKey Web 代理在 VIP 分配器中的键（不是合法域名，不会与资源域名冲突）
+const webProxyVIPKey = "*.web-proxy"
 
-	// 先调用 Server gRPC 注销（安全离场）
-	// 在 goroutine 中执行，最多等 3 秒，避免阻塞前端
-	if a.desktopClient != nil {
-		done := make(chan struct{})
-		go func() {
-			a.desktopClient.Logout()
-			close(done)
-		}()
-		select {
-		case <-done:
-		case <-time.After(3 * time.Second):
-			log.Printf("[App] gRPC Logout 超时，跳过")
+// routeWebDomain 添加 Web 代理路由（Web 代理未启动时分配 VIP 并启动），返回 Web 代理的 VIP，失败时返回空字符串
+// 只在数据流推送和 DNS 解析时调用，GetServices 等查询接口不修改路由
+func (a *App) routeWebDomain(route proxy.WebRoute) string {
+	if a.webProxy == nil || a.vipAllocator == nil {
+		return ""
+	}
+	vipAddr := a.webProxy.VIP()
+	if vipAddr == "" {
+		var err error
+		if vipAddr, err = a.vipAllocator.Allocate(webProxyVIPKey); err != nil {
+			log.Printf("[App] Web 代理 VIP 分配失败 (%s): %v", route.Domain, err)
+			return ""
+		}
+		if err := a.webProxy.Start(vipAddr, proxy.DefaultWebHTTPPort, proxy.DefaultWebHTTPSPort); err != nil {
+			log.Printf("[App] Web 代理启动失败 (%s): %v", route.Domain, err)
+			return ""
 		}
 	}
+	a.webProxy.AddRoute(route)
+	return vipAddr
+}
 
-	// 清理 ZTNA 网络栈
-	a.cleanupZTNA()
+// webServiceRoute 返回已授权 Web 服务的路由，不是 web 类型或缺少域名、地址时返回 false
+func webServiceRoute(svc *pb.AuthorizedService) (proxy.WebRoute, bool) {
+	if svc.GetType() != "web" || svc.GetDomain() == "" || svc.GetListenAddr() == "" {
+		return proxy.WebRoute{}, false
+	}
+	return proxy.WebRoute{Domain: svc.GetDomain(), RemoteAddr: svc.GetListenAddr(), TLS: svc.GetBackendTls()}, true
+}
 
-	// 断开隧道（也加超时保护）
-	if a.tsManager != nil {
-		done := make(chan struct{})
-		go func() {
-			a.tsManager.Disconnect()
-			close(done)
-		}()
-		select {
-		case <-done:
-		case <-time.After(3 * time.Second):
-			log.Printf("[App] Tunnel disconnect 超时，跳过")
-		}
-		a.tsManager = nil
+// webResolvedRoute 返回 Server 解析结果对应的 Web 路由，后端协议由 Server 下发
+func webResolvedRoute(domain string, result *client.DomainResolveResult) proxy.WebRoute {
+	return proxy.WebRoute{
+		Domain:     domain,
+		RemoteAddr: fmt.Sprintf("%s:%d", result.AgentIP, result.TargetPort),
+		TLS:        result.BackendTLS,
 	}
+}
 
-	// 停止 gRPC 客户端
-	if a.desktopClient != nil {
-		a.desktopClient.Stop()
-		a.desktopClient = nil
+// syncWebRoutes 数据流推送后同步 Web 代理路由，只修改有变化的域名：
+// 已授权服务中的 Web 域名按服务列表添加或更新；服务列表之外的路由来自 DNS 解析，重新向 Server 解析确认，
+// 不再是 Web 资源或已取消授权的域名删除路由，其余路由（包括进行中的请求）保持不变
+func (a *App) syncWebRoutes() {
+	desktopClient, webProxy := a.desktopClient, a.webProxy
+	if desktopClient == nil || webProxy == nil {
+		return
 	}
+	a.webSyncMu.Lock()
+	defer a.webSyncMu.Unlock()
 
-	a.authResult = nil
+	desired := make(map[string]proxy.WebRoute)
+	for _, svc := range desktopClient.GetAuthorizedServices() {
+		if route, ok := webServiceRoute(svc); ok {
+			desired[strings.ToLower(route.Domain)] = route
+		}
+	}
 
-	// 清除认证信息（保留服务器地址）
-	config.GlobalConfig.ClearToken()
-	config.GlobalConfig.ClientID = ""
+	for _, current := range webProxy.Routes() {
+		if _, ok := desired[current.Domain]; ok {
+			continue
+		}
+		a.domainMu.Lock()
+		_, resolved := a.domainResults[current.Domain]
+		a.domainMu.Unlock()
+		if resolved {
+			result, err := desktopClient.ResolveDomain(current.Domain)
+			if err == nil && result.DomainType == "web" {
+				desired[current.Domain] = webResolvedRoute(current.Domain, result)
+				continue
+			}
+			if err != nil && !errors.Is(err, client.ErrDomainRejected) {
+				// Server 暂时不可用，保留原路由
+				log.Printf("[App] Web 路由重新解析失败，保留原路由 (%s): %v", current.Domain, err)
+				continue
+			}
+			a.domainMu.Lock()
+			delete(a.domainResults, current.Domain)
+			a.domainMu.Unlock()
+		}
+		webProxy.RemoveRoute(current.Domain)
+	}
+
+	// AddRoute 只在地址或协议变化时更新路由
+	for _, route := range desired {
+		a.routeWebDomain(route)
+	}
+}
+
+// isDomainRejected 域名是否在否定缓存中（最近被 Server 拒绝过）
+func (a *App) isDomainRejected(domain string) bool {
+	a.domainMu.Lock()
+	defer a.domainMu.Unlock()
+
+	expires, ok := a.rejectedDomains[domain]
+	if ok && time.Now().After(expires) {
+		delete(a.rejectedDomains, domain)
+		return false
+	}
+	return ok
+}
+
+// rejectDomain 将被 Server 拒绝的域名加入否定缓存
+// 解析期间数据流已推送变更时结果可能过时，不缓存
+func (a *App) rejectDomain(domain string, gen uint64) {
+	a.domainMu.Lock()
+	defer a.domainMu.Unlock()
+
+	if a.resolveGen.Load() != gen || a.rejectedDomains == nil {
+		return
+	}
+	a.rejectedDomains[domain] = time.Now().Add(rejectedDomainTTL)
+}
+
+// invalidateDomainCache 数据流推送变更后调用：清空否定缓存，并使进行中的解析不再被新查询复用
+func (a *App) invalidateDomainCache() {
+	a.domainMu.Lock()
+	defer a.domainMu.Unlock()
+
+	a.resolveGen.Add(1)
+	if a.rejectedDomains != nil {
+		a.rejectedDomains = make(map[string]time.Time)
+	}
+}
+
+// localListenPort 返回 SSH / K8SAPI / 其他类型域名在 VIP 上的本地监听端口
+// SSH 类型域名：本地监听 22 端口（SSH 客户端默认端口），远程转发到 Agent 分配的端口
+// K8SAPI 类型域名：本地监听 6443 端口（kubectl 默认端口），远程转发到 Agent 分配的端口
+func localListenPort(domainType string, targetPort int) int {
+	switch domainType {
+	case "ssh":
+		return 22
+	case "k8sapi":
+		return 6443
+	default:
+		return targetPort
+	}
+}
+
+// domainRecord DNS 元数据回调：从域名列表和解析结果生成 SRV / TXT 应答所需的信息
+func (a *App) domainRecord(domain string) (*dns.Record, bool) {
+	if a.desktopClient == nil {
+		return nil, false
+	}
+
+	domains, err := a.desktopClient.GetDomainList()
+	if err != nil {
+		log.Printf("[App] 获取域名列表失败 (%s): %v", domain, err)
+		return nil, false
+	}
+
+	a.domainMu.Lock()
+	result := a.domainResults[domain]
+	a.domainMu.Unlock()
+
+	for _, d := range domains {
+		if d.Domain != domain {
+			continue
+		}
+		record := &dns.Record{
+			Type:      d.Type,
+			Namespace: d.Namespace,
+			Service:   d.ServiceName,
+			Region:    d.Region,
+		}
+		if result != nil {
+			record.Agent = result.AgentName
+		}
+		if d.Type == "k8ssvc" {
+			for _, port := range d.ServicePorts {
+				record.Ports = append(record.Ports, int(port))
+			}
+		} else if result != nil {
+			record.Ports = []int{localListenPort(d.Type, result.TargetPort)}
+		}
+		return record, true
+	}
+	return nil, false
+}
+
+func (a *App) Logout() {
+	log.Printf("[App] Logout called")
+
+	// 先调用 Server gRPC 注销（安全离场）
+	// 在 goroutine 中执行，最多等 3 秒，避免阻塞前端
+	if a.desktopClient != nil {
+		done := make(chan struct{})
+		go func() {
+			a.desktopClient.Logout()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+			log.Printf("[App] gRPC Logout 超时，跳过")
+		}
+	}
+
+	// 清理 ZTNA 网络栈
+	a.cleanupZTNA()
+
+	// 断开隧道（也加超时保护）
+	if a.tsManager != nil {
+		done := make(chan struct{})
+		go func() {
+			a.tsManager.Disconnect()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+			log.Printf("[App] Tunnel disconnect 超时，跳过")
+		}
+		a.tsManager = nil
+	}
+
+	// 停止 gRPC 客户端
+	if a.desktopClient != nil {
+		a.desktopClient.Stop()
+		a.desktopClient = nil
+	}
+
+	a.authResult = nil
+
+	// 清除认证信息（保留服务器地址）
+	config.GlobalConfig.ClearToken()
+	config.GlobalConfig.ClientID = ""
 	config.GlobalConfig.RememberMe = false
 
 	if err := config.GlobalConfig.Save(); err != nil {
@@ -500,6 +1202,8 @@ type ServiceInfo struct {
 	ListenPort       int    `json:"listen_port,omitempty"`
 	TargetAddr       string `json:"target_addr,omitempty"`
 	ServiceID        string `json:"service_id,omitempty"` // 服务唯一标识
+	Type             string `json:"type,omitempty"`       // 服务类型：tcp / web
+	WebURL           string `json:"web_url,omitempty"`    // 浏览器访问地址（web 类型且 Web 代理可用时）
 }
 
 func (a *App) GetServices() ([]*ServiceInfo, error) {
@@ -543,6 +1247,12 @@ func (a *App) GetServices() ([]*ServiceInfo, error) {
 		serviceID := svc.Id
 		isFavorite := favoriteMap[serviceID]
 
+		// web 类型服务通过 Web 代理按域名访问（路由在数据流推送时注册，这里只生成地址）
+		var webURL string
+		if _, ok := webServiceRoute(svc); ok && a.webProxy != nil {
+			webURL = "http://" + svc.Domain
+		}
+
 		services = append(services, &ServiceInfo{
 			InstanceID:       uint(i + 1), // 临时使用索引作为ID
 			InstanceName:     svc.Name,
@@ -556,6 +1266,8 @@ func (a *App) GetServices() ([]*ServiceInfo, error) {
 			ListenPort:       listenPort,
 			TargetAddr:       svc.TargetAddr,
 			ServiceID:        serviceID, // 添加服务 ID 字段
+			Type:             svc.Type,
+			WebURL:           webURL,
 		})
 	}
 
@@ -587,200 +1299,745 @@ func (a *App) GetVersion() *VersionInfo {
 	}
 }
 
-func (a *App) GetWindowTitle() string {
-	if appVersion.BuildNumber != "0" && appVersion.BuildNumber != "" {
-		// 格式：Signaling v0.2.0 (Build 46 @ 2026-01-15_02:30:39)
-		return fmt.Sprintf("Signaling  %s (Build %s @ %s)", appVersion.Version, appVersion.BuildNumber, appVersion.BuildTime)
+func (a *App) GetWindowTitle() string {
+	if appVersion.BuildNumber != "0" && appVersion.BuildNumber != "" {
+		// 格式：Signaling v0.2.0 (Build 46 @ 2026-01-15_02:30:39)
+		return fmt.Sprintf("Signaling  %s (Build %s @ %s)", appVersion.Version, appVersion.BuildNumber, appVersion.BuildTime)
+	}
+	return fmt.Sprintf("Signaling  %s", appVersion.Version)
+}
+
+type SavedCredentials struct {
+	ServerAddress string `json:"server_address"`
+	ClientID      string `json:"client_id"`
+	ClientSecret  string `json:"client_secret"`
+	RememberMe    bool   `json:"remember_me"`
+	HasToken      bool   `json:"has_token"`
+}
+
+func (a *App) CheckSavedCredentials() *SavedCredentials {
+	log.Printf("[App] CheckSavedCredentials: HasToken=%v, DeviceToken=%s",
+		config.GlobalConfig.HasValidToken(),
+		maskToken(config.GlobalConfig.DeviceToken))
+
+	serverAddr := config.GlobalConfig.ServerAddress
+
+	if config.GlobalConfig.ClientID == "" {
+		return &SavedCredentials{
+			ServerAddress: serverAddr,
+			ClientID:      "",
+			ClientSecret:  "",
+			RememberMe:    true,
+			HasToken:      false,
+		}
+	}
+
+	hasToken := config.GlobalConfig.HasValidToken()
+	log.Printf("[App] Token status: HasToken=%v, ClientID=%s", hasToken, config.GlobalConfig.ClientID)
+
+	return &SavedCredentials{
+		ServerAddress: serverAddr,
+		ClientID:      config.GlobalConfig.ClientID,
+		ClientSecret:  "",
+		RememberMe:    true,
+		HasToken:      hasToken,
+	}
+}
+
+// maskToken 隐藏 token 中间部分，用于日志
+func maskToken(token string) string {
+	if token == "" {
+		return "<empty>"
+	}
+	if len(token) <= 10 {
+		return "***"
+	}
+	return token[:5] + "***" + token[len(token)-5:]
+}
+
+func (a *App) ClearCredentials() error {
+	config.GlobalConfig.ClearToken()
+	config.GlobalConfig.ClientID = ""
+	config.GlobalConfig.ServerAddress = ""
+	return config.GlobalConfig.Save()
+}
+
+func (a *App) GetLogs() []string {
+	return GetRecentLogs(1000)
+}
+
+// SetLogLevel 设置日志级别
+func (a *App) SetLogLevel(level string) {
+	SetLogLevel(level)
+	log.Printf("[INFO] Log level changed to: %s", level)
+}
+
+// GetLogLevel 获取当前日志级别
+func (a *App) GetLogLevel() string {
+	return GetLogLevel()
+}
+
+func (a *App) HideToTray() {
+	log.Printf("[App] HideToTray called")
+	if mainWindow != nil {
+		mainWindow.Hide()
+	}
+}
+
+// TunnelStatus 隧道状态信息
+type TunnelStatus struct {
+	Connected bool   `json:"connected"`
+	IP        string `json:"ip"`
+	Hostname  string `json:"hostname"`
+	Error     string `json:"error"`
+}
+
+// GRPCStatus gRPC 连接状态
+type GRPCStatus struct {
+	Connected     bool   `json:"connected"`
+	ServerAddress string `json:"server_address"`
+	Error         string `json:"error"`
+}
+
+// GetGRPCStatus 获取 gRPC 连接状态
+func (a *App) GetGRPCStatus() *GRPCStatus {
+	status := &GRPCStatus{
+		Connected:     false,
+		ServerAddress: config.GlobalConfig.ServerAddress,
+	}
+
+	if a.desktopClient == nil {
+		status.Error = "未连接"
+		return status
+	}
+
+	// 检查认证状态和 gRPC 连接状态
+	if !a.desktopClient.IsAuthenticated() {
+		status.Error = "未认证"
+		return status
+	}
+
+	if !a.desktopClient.IsGRPCConnected() {
+		status.Error = "gRPC 连接断开"
+		return status
+	}
+
+	status.Connected = true
+	return status
+}
+
+// GetTunnelStatus 获取隧道连接状态
+func (a *App) GetTunnelStatus() *TunnelStatus {
+	status := &TunnelStatus{
+		Connected: false,
+		IP:        "",
+	}
+
+	if a.tsManager == nil {
+		status.Error = "隧道未初始化"
+		return status
+	}
+
+	status.Connected = a.tsManager.IsConnected()
+	if status.Connected {
+		status.IP = a.tsManager.GetIP()
+		if a.authResult != nil {
+			status.Hostname = fmt.Sprintf("desktop-%d", a.authResult.DesktopID)
+		}
+	} else {
+		status.Error = "隧道未连接"
+	}
+
+	return status
+}
+
+// ProxyStatusInfo 代理连接状态信息
+type ProxyStatusInfo struct {
+	Domain       string           `json:"domain"`        // 域名
+	VIP          string           `json:"vip"`           // 本地 VIP 地址
+	Port         int              `json:"port"`          // 监听端口
+	RemoteAddr   string           `json:"remote_addr"`   // 远程地址
+	Type         string           `json:"type"`          // 类型：tcp / udp / svc / web
+	TLS          bool             `json:"tls"`           // 是否 TLS
+	BytesIn      int64            `json:"bytes_in"`      // 从本地客户端收到的字节数（上行）
+	BytesOut     int64            `json:"bytes_out"`     // 发给本地客户端的字节数（下行）
+	ActiveConns  int              `json:"active_conns"`  // 活动连接数（udp 类型为活动会话数）
+	TotalConns   int64            `json:"total_conns"`   // 累计连接数
+	DialFailures int64            `json:"dial_failures"` // 连接远程失败次数
+	LastError    string           `json:"last_error"`    // 最近一次错误
+	LastErrorAt  string           `json:"last_error_at"` // 最近一次错误的时间（RFC3339，无错误时为空）
+	Breaker      string           `json:"breaker"`       // 熔断器状态：closed / open / half-open（tcp 类型）
+	BreakerUntil string           `json:"breaker_until"` // 熔断结束时间（RFC3339，熔断中时有效）
+	Connections  []*ProxyConnInfo `json:"connections"`   // 活动连接
+}
+
+// ProxyConnInfo 代理上的单个活动连接
+type ProxyConnInfo struct {
+	ID         uint64 `json:"id"`          // 连接 ID（用于 CloseConnection）
+	Domain     string `json:"domain"`      // 域名
+	Port       int    `json:"port"`        // 代理监听端口
+	Type       string `json:"type"`        // 代理类型：tcp / udp / svc / web
+	ClientAddr string `json:"client_addr"` // 本地客户端地址
+	StartedAt  string `json:"started_at"`  // 开始时间（RFC3339）
+	BytesIn    int64  `json:"bytes_in"`    // 从客户端收到的字节数
+	BytesOut   int64  `json:"bytes_out"`   // 发给客户端的字节数
+}
+
+// GetProxyStatus 获取所有本地代理连接状态（包括流量统计和活动连接）
+func (a *App) GetProxyStatus() []*ProxyStatusInfo {
+	var result []*ProxyStatusInfo
+
+	// TCP / UDP 代理状态
+	if a.proxyManager != nil {
+		for _, t := range a.proxyManager.GetStatus() {
+			info := &ProxyStatusInfo{
+				Domain:     t.Domain,
+				VIP:        t.VIP,
+				Port:       t.Port,
+				RemoteAddr: t.RemoteAddr,
+				Type:       "tcp",
+				TLS:        t.TLS,
+			}
+			if t.UDP {
+				info.Type = "udp"
+			}
+			if stats, ok := a.proxyManager.Stats(t); ok {
+				info.setStats(stats)
+			}
+			result = append(result, info)
+		}
+	}
+
+	// SVCProxy 代理状态
+	if a.svcProxyMgr != nil {
+		for _, t := range a.svcProxyMgr.GetStatus() {
+			info := &ProxyStatusInfo{
+				Domain:     t.Domain,
+				VIP:        t.VIP,
+				Port:       t.Port,
+				RemoteAddr: fmt.Sprintf("%s:%d", t.AgentIP, t.GRPCPort),
+				Type:       "svc",
+			}
+			if stats, ok := a.svcProxyMgr.Stats(t.VIP, t.Port); ok {
+				info.setStats(stats)
+			}
+			result = append(result, info)
+		}
+	}
+
+	// Web 代理路由（共用 Web 代理的 VIP 和 80 端口）
+	if a.webProxy != nil {
+		if vipAddr := a.webProxy.VIP(); vipAddr != "" {
+			for _, r := range a.webProxy.Routes() {
+				info := &ProxyStatusInfo{
+					Domain:     r.Domain,
+					VIP:        vipAddr,
+					Port:       proxy.DefaultWebHTTPPort,
+					RemoteAddr: r.RemoteAddr,
+					Type:       "web",
+					TLS:        a.webProxy.HTTPS(),
+				}
+				if stats, ok := a.webProxy.Stats(r.Domain); ok {
+					info.setStats(stats)
+				}
+				result = append(result, info)
+			}
+		}
+	}
+
+	return result
+}
+
+// setStats 填充代理的流量统计
+func (info *ProxyStatusInfo) setStats(stats proxy.Stats) {
+	info.BytesIn = stats.BytesIn
+	info.BytesOut = stats.BytesOut
+	info.ActiveConns = stats.ActiveConns
+	info.TotalConns = stats.TotalConns
+	info.DialFailures = stats.DialFailures
+	info.LastError = stats.LastError
+	if !stats.LastErrorAt.IsZero() {
+		info.LastErrorAt = stats.LastErrorAt.Format(time.RFC3339)
+	}
+	info.Breaker = stats.Breaker
+	if !stats.BreakerOpenUntil.IsZero() {
+		info.BreakerUntil = stats.BreakerOpenUntil.Format(time.RFC3339)
+	}
+	info.Connections = make([]*ProxyConnInfo, 0, len(stats.Conns))
+	for _, c := range stats.Conns {
+		info.Connections = append(info.Connections, &ProxyConnInfo{
+			ID:         c.ID,
+			Domain:     info.Domain,
+			Port:       info.Port,
+			Type:       info.Type,
+			ClientAddr: c.ClientAddr,
+			StartedAt:  c.StartedAt.Format(time.RFC3339),
+			BytesIn:    c.BytesIn,
+			BytesOut:   c.BytesOut,
+		})
+	}
+}
+
+// ListConnections 列出所有代理上的活动连接（按建立顺序）
+func (a *App) ListConnections() []*ProxyConnInfo {
+	var result []*ProxyConnInfo
+	for _, info := range a.GetProxyStatus() {
+		result = append(result, info.Connections...)
+	}
+	slices.SortFunc(result, func(x, y *ProxyConnInfo) int { return cmp.Compare(x.ID, y.ID) })
+	return result
+}
+
+// CloseConnection 强制关闭一个活动连接（如卡住的 kubectl exec / SSH 会话），代理继续监听
+func (a *App) CloseConnection(id uint64) error {
+	log.Printf("[App] CloseConnection: %d", id)
+
+	if a.proxyManager != nil && a.proxyManager.CloseConn(id) {
+		return nil
+	}
+	if a.svcProxyMgr != nil && a.svcProxyMgr.CloseConn(id) {
+		return nil
+	}
+	if a.webProxy != nil && a.webProxy.CloseConn(id) {
+		return nil
+	}
+	return fmt.Errorf("连接 %d 不存在或已关闭", id)
+}
+
+// CloseDomainConnections 强制关闭域名的全部活动连接，代理继续监听，返回关闭的连接数
+func (a *App) CloseDomainConnections(domain string) int {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	closed := 0
+	if a.proxyManager != nil {
+		closed += a.proxyManager.CloseDomainConns(domain)
+	}
+	if a.svcProxyMgr != nil {
+		closed += a.svcProxyMgr.CloseDomainConns(domain)
+	}
+	if a.webProxy != nil {
+		closed += a.webProxy.CloseDomainConns(domain)
+	}
+	log.Printf("[App] CloseDomainConnections: %s, 已关闭 %d 个连接", domain, closed)
+	return closed
+}
+
+// DNSStatus 本地 DNS 服务器状态
+type DNSStatus struct {
+	Running         bool                  `json:"running"`          // 是否运行中
+	ListenAddr      string                `json:"listen_addr"`      // 监听地址
+	Zones           []string              `json:"zones"`            // 本地拦截的内部域名后缀
+	SearchDomains   []string              `json:"search_domains"`   // 短名称搜索后缀
+	SystemResolvers []string              `json:"system_resolvers"` // 系统原有上游 DNS
+	Upstreams       []*dns.UpstreamStatus `json:"upstreams"`        // 当前使用的上游 DNS 及健康状态
+	Cache           *dns.CacheStats       `json:"cache,omitempty"`  // 上游应答缓存命中统计
+}
+
+// GetDNSStatus 获取本地 DNS 服务器状态
+func (a *App) GetDNSStatus() *DNSStatus {
+	status := &DNSStatus{
+		ListenAddr:      dns.RecommendedListenAddr(),
+		Zones:           a.dnsZones(),
+		SystemResolvers: a.systemResolvers,
+	}
+	if a.dnsServer == nil {
+		return status
+	}
+	status.Running = true
+	status.ListenAddr = a.dnsServer.ListenAddr()
+	status.SearchDomains = a.dnsServer.SearchDomains()
+	status.Upstreams = a.dnsServer.UpstreamStatus()
+	status.Cache = a.dnsServer.CacheStats()
+	return status
+}
+
+// SOCKSStatus 本地 SOCKS5 代理状态
+type SOCKSStatus struct {
+	Enabled      bool   `json:"enabled"`       // 是否已配置监听地址
+	Running      bool   `json:"running"`       // 是否运行中
+	ListenAddr   string `json:"listen_addr"`   // 监听地址
+	Username     string `json:"username"`      // 用户名（为空时不认证）
+	PasswordSet  bool   `json:"password_set"`  // 是否已设置密码（密码只保存哈希，不返回）
+	Auth         bool   `json:"auth"`          // 是否要求用户名密码认证
+	BytesIn      int64  `json:"bytes_in"`      // 从客户端收到的字节数（上行）
+	BytesOut     int64  `json:"bytes_out"`     // 发给客户端的字节数（下行）
+	ActiveConns  int    `json:"active_conns"`  // 活动连接数
+	TotalConns   int64  `json:"total_conns"`   // 累计连接数
+	DialFailures int64  `json:"dial_failures"` // 连接目标失败次数（包括拒绝的地址）
+	LastError    string `json:"last_error"`    // 最近一次错误
+	LastErrorAt  string `json:"last_error_at"` // 最近一次错误的时间（RFC3339，无错误时为空）
+}
+
+// GetSOCKSStatus 返回本地 SOCKS5 代理状态
+func (a *App) GetSOCKSStatus() *SOCKSStatus {
+	status := &SOCKSStatus{
+		Enabled:     config.GlobalConfig.SOCKSListen != "",
+		ListenAddr:  config.GlobalConfig.SOCKSListen,
+		Username:    config.GlobalConfig.SOCKSUser,
+		PasswordSet: config.GlobalConfig.SOCKSPasswordHash != "",
+	}
+	if a.socksServer == nil {
+		return status
+	}
+	if addr := a.socksServer.Addr(); addr != "" {
+		status.Running = true
+		status.ListenAddr = addr
+		status.Auth = a.socksServer.Auth()
+	}
+	stats := a.socksServer.Stats()
+	status.BytesIn = stats.BytesIn
+	status.BytesOut = stats.BytesOut
+	status.ActiveConns = stats.ActiveConns
+	status.TotalConns = stats.TotalConns
+	status.DialFailures = stats.DialFailures
+	status.LastError = stats.LastError
+	if !stats.LastErrorAt.IsZero() {
+		status.LastErrorAt = stats.LastErrorAt.Format(time.RFC3339)
+	}
+	return status
+}
+
+// SetSOCKSProxy 设置本地 SOCKS5 代理并立即生效，listenAddr 为空时停止
+// 只允许监听本机回环地址；username 为空时不认证。配置中只保存密码哈希，
+// password 为空且用户名不变时沿用已保存的密码（前端无法取回密码，只修改监听地址时不需要重新输入）
+func (a *App) SetSOCKSProxy(listenAddr, username, password string) error {
+	log.Printf("[App] SetSOCKSProxy: %s (user=%s)", listenAddr, username)
+
+	listenAddr = strings.TrimSpace(listenAddr)
+	if listenAddr != "" {
+		if err := validateSOCKSListen(listenAddr); err != nil {
+			return err
+		}
+	}
+
+	passwordHash := ""
+	switch {
+	case username == "":
+	case password != "":
+		hash, err := proxy.HashSOCKSPassword(password)
+		if err != nil {
+			return err
+		}
+		passwordHash = hash
+	case username == config.GlobalConfig.SOCKSUser && config.GlobalConfig.SOCKSPasswordHash != "":
+		passwordHash = config.GlobalConfig.SOCKSPasswordHash
+	default:
+		return fmt.Errorf("设置 SOCKS5 用户名时需要设置密码")
+	}
+
+	config.GlobalConfig.SOCKSListen = listenAddr
+	config.GlobalConfig.SOCKSUser = username
+	config.GlobalConfig.SOCKSPasswordHash = passwordHash
+	config.GlobalConfig.SOCKSPassword = ""
+	if err := config.GlobalConfig.Save(); err != nil {
+		return fmt.Errorf("保存配置失败: %w", err)
+	}
+
+	// 未连接时下次连接生效
+	if a.socksServer == nil {
+		return nil
+	}
+	a.socksServer.Stop()
+	return a.startSOCKS()
+}
+
+// validateSOCKSListen 校验 SOCKS5 监听地址：必须是本机回环地址和有效端口，避免把隧道网络暴露给局域网
+func validateSOCKSListen(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("SOCKS5 监听地址无效 %q: %w", addr, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("SOCKS5 监听端口无效: %q", port)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip, err := netip.ParseAddr(host); err != nil || !ip.IsLoopback() {
+		return fmt.Errorf("SOCKS5 只能监听本机回环地址: %q", host)
+	}
+	return nil
+}
+
+// migrateSOCKSPassword 把旧版本保存在配置文件中的 SOCKS5 明文密码转换为哈希并重写配置文件
+func migrateSOCKSPassword() {
+	cfg := config.GlobalConfig
+	if cfg.SOCKSPassword == "" {
+		return
+	}
+	if cfg.SOCKSUser != "" && cfg.SOCKSPasswordHash == "" {
+		hash, err := proxy.HashSOCKSPassword(cfg.SOCKSPassword)
+		if err != nil {
+			log.Printf("[App] Warning: 转换 SOCKS5 密码失败: %v", err)
+			return
+		}
+		cfg.SOCKSPasswordHash = hash
+	}
+	cfg.SOCKSPassword = ""
+	if err := cfg.Save(); err != nil {
+		log.Printf("[App] Warning: 保存配置失败: %v", err)
+		return
+	}
+	log.Printf("[App] 已将 SOCKS5 密码转换为哈希保存")
+}
+
+// startSOCKS 按配置启动 SOCKS5 代理，未配置监听地址时不启动
+func (a *App) startSOCKS() error {
+	listenAddr := config.GlobalConfig.SOCKSListen
+	if a.socksServer == nil || listenAddr == "" {
+		return nil
+	}
+	if err := validateSOCKSListen(listenAddr); err != nil {
+		log.Printf("[App] Warning: %v", err)
+		return err
+	}
+	if err := a.socksServer.Start(listenAddr, config.GlobalConfig.SOCKSUser, config.GlobalConfig.SOCKSPasswordHash); err != nil {
+		log.Printf("[App] Warning: SOCKS5 代理启动失败: %v", err)
+		return err
+	}
+	return nil
+}
+
+// socksDial SOCKS5 代理的拨号
+// 内部域名按本地 DNS 的解析逻辑（resolveDomain）取得 VIP 并连接 VIP 上的本地代理，与系统 DNS 路径行为一致
+// （k8sapi 的本地 CA 证书、PROXY protocol、熔断和统计都生效）；隧道 IP 直接通过隧道拨号。
+// 其他地址一律拒绝，SOCKS5 代理不作为通用的出网代理
+func (a *App) socksDial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
 	}
-	return fmt.Sprintf("Signaling  %s", appVersion.Version)
-}
 
-type SavedCredentials struct {
-	ServerAddress string `json:"server_address"`
-	ClientID      string `json:"client_id"`
-	ClientSecret  string `json:"client_secret"`
-	RememberMe    bool   `json:"remember_me"`
-	HasToken      bool   `json:"has_token"`
-}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !tsaddr.IsTailscaleIP(ip.Unmap()) {
+			return nil, fmt.Errorf("%s 不是隧道地址", host)
+		}
+		if a.tsManager == nil {
+			return nil, fmt.Errorf("隧道未连接")
+		}
+		return a.tsManager.Dial(ctx, network, addr)
+	}
 
-func (a *App) CheckSavedCredentials() *SavedCredentials {
-	log.Printf("[App] CheckSavedCredentials: HasToken=%v, DeviceToken=%s",
-		config.GlobalConfig.HasValidToken(),
-		maskToken(config.GlobalConfig.DeviceToken))
+	domain := strings.TrimSuffix(strings.ToLower(host), ".")
+	if name, _, ok := dns.SplitZone(domain, a.dnsZones()); !ok || name == "" {
+		return nil, fmt.Errorf("%s 不是内部域名", host)
+	}
+	if a.vipAllocator == nil {
+		return nil, fmt.Errorf("ZTNA 网络栈未就绪")
+	}
+	vipAddr, ok := a.resolveDomain(domain)
+	if !ok {
+		return nil, fmt.Errorf("解析 %s 失败", domain)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, net.JoinHostPort(vipAddr, port))
+}
 
-	serverAddr := config.GlobalConfig.ServerAddress
+// SetDNSUpstreams 设置上游 DNS 列表并立即生效，传空列表恢复为系统原有 DNS
+// 支持 "10.0.0.53"、"tcp://10.0.0.53"、"tls://1.1.1.1"、"https://dns.google/dns-query"
+func (a *App) SetDNSUpstreams(upstreams []string) error {
+	log.Printf("[App] SetDNSUpstreams: %v", upstreams)
 
-	if config.GlobalConfig.ClientID == "" {
-		return &SavedCredentials{
-			ServerAddress: serverAddr,
-			ClientID:      "",
-			ClientSecret:  "",
-			RememberMe:    true,
-			HasToken:      false,
+	var cleaned []string
+	for _, u := range upstreams {
+		if u = strings.TrimSpace(u); u == "" {
+			continue
 		}
+		if err := dns.ValidateUpstream(u); err != nil {
+			return err
+		}
+		cleaned = append(cleaned, u)
 	}
 
-	hasToken := config.GlobalConfig.HasValidToken()
-	log.Printf("[App] Token status: HasToken=%v, ClientID=%s", hasToken, config.GlobalConfig.ClientID)
+	config.GlobalConfig.DNSUpstreams = cleaned
+	if err := config.GlobalConfig.Save(); err != nil {
+		return fmt.Errorf("保存配置失败: %w", err)
+	}
 
-	return &SavedCredentials{
-		ServerAddress: serverAddr,
-		ClientID:      config.GlobalConfig.ClientID,
-		ClientSecret:  "",
-		RememberMe:    true,
-		HasToken:      hasToken,
+	if a.dnsServer != nil {
+		a.dnsServer.SetUpstreams(a.dnsUpstreams())
 	}
+	return nil
 }
 
-// maskToken 隐藏 token 中间部分，用于日志
-func maskToken(token string) string {
-	if token == "" {
-		return "<empty>"
+// dnsOverridesFile 本地 DNS 覆盖文件名（位于应用目录）
+const dnsOverridesFile = "dns-overrides.json"
+
+// openDNSOverrides 加载本地 DNS 覆盖文件
+func (a *App) openDNSOverrides() {
+	appDir, err := config.GetAppDir()
+	if err != nil {
+		log.Printf("[App] 获取应用目录失败: %v", err)
+		return
 	}
-	if len(token) <= 10 {
-		return "***"
+	overrides, err := dns.NewOverrides(filepath.Join(appDir, dnsOverridesFile))
+	if err != nil {
+		log.Printf("[App] 加载 DNS 覆盖失败: %v", err)
+		return
 	}
-	return token[:5] + "***" + token[len(token)-5:]
+	a.dnsOverrides = overrides
 }
 
-func (a *App) ClearCredentials() error {
-	config.GlobalConfig.ClearToken()
-	config.GlobalConfig.ClientID = ""
-	config.GlobalConfig.ServerAddress = ""
-	return config.GlobalConfig.Save()
+// GetDNSOverrides 获取用户自定义的本地 DNS 覆盖
+func (a *App) GetDNSOverrides() []*dns.Override {
+	if a.dnsOverrides == nil {
+		return []*dns.Override{}
+	}
+	return a.dnsOverrides.List()
 }
 
-func (a *App) GetLogs() []string {
-	return GetRecentLogs(1000)
+// AddDNSOverride 添加本地 DNS 覆盖，名称已存在时替换，立即生效
+// recordType 为 A（target 为 IP 地址）或 CNAME（target 为目标域名）；name 支持短名称（db）和通配符（*.dev.beagle）
+func (a *App) AddDNSOverride(name, recordType, target string) error {
+	log.Printf("[App] AddDNSOverride: %s %s %s", name, recordType, target)
+	if a.dnsOverrides == nil {
+		return fmt.Errorf("DNS 覆盖不可用")
+	}
+	return a.dnsOverrides.Add(dns.Override{Name: name, Type: recordType, Target: target})
 }
 
-// SetLogLevel 设置日志级别
-func (a *App) SetLogLevel(level string) {
-	SetLogLevel(level)
-	log.Printf("[INFO] Log level changed to: %s", level)
+// RemoveDNSOverride 删除本地 DNS 覆盖，立即生效
+func (a *App) RemoveDNSOverride(name string) error {
+	log.Printf("[App] RemoveDNSOverride: %s", name)
+	if a.dnsOverrides == nil {
+		return fmt.Errorf("DNS 覆盖不可用")
+	}
+	return a.dnsOverrides.Remove(name)
 }
 
-// GetLogLevel 获取当前日志级别
-func (a *App) GetLogLevel() string {
-	return GetLogLevel()
+// updateDNSSearch 从域名列表和资源列表重新生成短名称搜索后缀，更新本地 DNS
+func (a *App) updateDNSSearch() {
+	if a.dnsServer == nil || a.desktopClient == nil {
+		return
+	}
+	domains, err := a.desktopClient.GetDomainList()
+	if err != nil {
+		log.Printf("[App] 获取域名列表失败（搜索后缀）: %v", err)
+	}
+	resources, err := a.desktopClient.GetResources()
+	if err != nil {
+		log.Printf("[App] 获取资源列表失败（搜索后缀）: %v", err)
+	}
+	a.applyDNSSearch(domains, resources)
 }
 
-func (a *App) HideToTray() {
-	log.Printf("[App] HideToTray called")
-	if mainWindow != nil {
-		mainWindow.Hide()
+// applyDNSSearch 按用户配置、域名所属区域和资源所属租户生成搜索后缀，内部域名后缀本身优先级最低
+func (a *App) applyDNSSearch(domains []*client.DomainInfo, resources []*client.ResourceInfo) {
+	if a.dnsServer == nil {
+		return
 	}
-}
+	zones := a.dnsServer.Zones()
 
-// TunnelStatus 隧道状态信息
-type TunnelStatus struct {
-	Connected bool   `json:"connected"`
-	IP        string `json:"ip"`
-	Hostname  string `json:"hostname"`
-	Error     string `json:"error"`
+	candidates := append([]string{}, config.GlobalConfig.DNSSearch...)
+	var names []string
+	for _, d := range domains {
+		names = append(names, d.Domain)
+		if d.Region != "" {
+			candidates = append(candidates, searchSuffix(d.Domain, d.Region, zones))
+		}
+	}
+	for _, r := range resources {
+		names = append(names, r.Domain)
+		if r.TenantName != "" {
+			candidates = append(candidates, searchSuffix(r.Domain, r.TenantName, zones))
+		}
+	}
+	search := dns.NormalizeSearchDomains(append(candidates, zones...), zones)
+	a.dnsServer.SetSearch(search, names)
 }
 
-// GRPCStatus gRPC 连接状态
-type GRPCStatus struct {
-	Connected     bool   `json:"connected"`
-	ServerAddress string `json:"server_address"`
-	Error         string `json:"error"`
+// searchSuffix 返回域名中从区域或租户标签开始的后缀：pg.yygl.beijing.beagle + beijing → beijing.beagle
+// 域名中没有该标签时返回 <label>.<zone>，域名不属于内部域名后缀时返回空
+func searchSuffix(domain, label string, zones []string) string {
+	host, zone, ok := dns.SplitZone(domain, zones)
+	if !ok {
+		return ""
+	}
+	label = strings.ToLower(label)
+	parts := strings.Split(host, ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		if parts[i] == label {
+			return strings.Join(parts[i:], ".") + "." + zone
+		}
+	}
+	return label + "." + zone
 }
 
-// GetGRPCStatus 获取 gRPC 连接状态
-func (a *App) GetGRPCStatus() *GRPCStatus {
-	status := &GRPCStatus{
-		Connected:     false,
-		ServerAddress: config.GlobalConfig.ServerAddress,
-	}
+// SetDNSSearchDomains 设置短名称搜索后缀（优先于 Server 下发的区域、租户）并立即生效，传空列表恢复为自动生成
+// 搜索后缀必须属于内部域名后缀，如 "beijing.beagle"
+func (a *App) SetDNSSearchDomains(domains []string) error {
+	log.Printf("[App] SetDNSSearchDomains: %v", domains)
 
-	if a.desktopClient == nil {
-		status.Error = "未连接"
-		return status
+	zones := a.dnsZones()
+	cleaned := dns.NormalizeSearchDomains(domains, zones)
+	for _, d := range domains {
+		d = strings.ToLower(strings.Trim(strings.TrimSpace(d), "."))
+		if d != "" && !slices.Contains(cleaned, d) {
+			return fmt.Errorf("无效的搜索后缀: %q（必须属于 %s）", d, strings.Join(zones, ", "))
+		}
 	}
 
-	// 检查认证状态和 gRPC 连接状态
-	if !a.desktopClient.IsAuthenticated() {
-		status.Error = "未认证"
-		return status
+	config.GlobalConfig.DNSSearch = cleaned
+	if err := config.GlobalConfig.Save(); err != nil {
+		return fmt.Errorf("保存配置失败: %w", err)
 	}
 
-	if !a.desktopClient.IsGRPCConnected() {
-		status.Error = "gRPC 连接断开"
-		return status
+	if a.dnsServer != nil {
+		go a.updateDNSSearch()
 	}
-
-	status.Connected = true
-	return status
+	return nil
 }
 
-// GetTunnelStatus 获取隧道连接状态
-func (a *App) GetTunnelStatus() *TunnelStatus {
-	status := &TunnelStatus{
-		Connected: false,
-		IP:        "",
+// ExpandShortName 按搜索后缀展开短名称，返回匹配的完整域名
+// 返回多个域名表示短名称有歧义（DNS 查询返回 NXDOMAIN），需要使用更完整的名称
+func (a *App) ExpandShortName(name string) []string {
+	if a.dnsServer == nil {
+		return []string{}
 	}
-
-	if a.tsManager == nil {
-		status.Error = "隧道未初始化"
-		return status
+	matches := a.dnsServer.ExpandName(strings.TrimSpace(name))
+	if matches == nil {
+		return []string{}
 	}
+	return matches
+}
 
-	status.Connected = a.tsManager.IsConnected()
-	if status.Connected {
-		status.IP = a.tsManager.GetIP()
-		if a.authResult != nil {
-			status.Hostname = fmt.Sprintf("desktop-%d", a.authResult.DesktopID)
-		}
-	} else {
-		status.Error = "隧道未连接"
-	}
+// dnsQueryEvent 实时推送 DNS 查询日志的前端事件名
+const dnsQueryEvent = "dns:query"
 
-	return status
+// GetDNSQueryLog 获取最近的 DNS 查询日志（按时间倒序）
+// name 按包含匹配，outcome 为 local / nxdomain / nodata / forwarded / cached / servfail / override，为空表示不过滤；limit 为 0 表示不限制
+func (a *App) GetDNSQueryLog(name, outcome string, limit int) []*dns.QueryLogEntry {
+	if a.dnsServer == nil {
+		return []*dns.QueryLogEntry{}
+	}
+	return a.dnsServer.QueryLog(dns.QueryLogFilter{Name: name, Outcome: outcome, Limit: limit})
 }
 
-// ProxyStatusInfo 代理连接状态信息
-type ProxyStatusInfo struct {
-	Domain     string `json:"domain"`      // 域名
-	VIP        string `json:"vip"`         // 本地 VIP 地址
-	Port       int    `json:"port"`        // 监听端口
-	RemoteAddr string `json:"remote_addr"` // 远程地址
-	Type       string `json:"type"`        // 类型：tcp / svc
-	TLS        bool   `json:"tls"`         // 是否 TLS
+// ClearDNSQueryLog 清空 DNS 查询日志
+func (a *App) ClearDNSQueryLog() {
+	if a.dnsServer != nil {
+		a.dnsServer.ClearQueryLog()
+	}
 }
 
-// GetProxyStatus 获取所有本地代理连接状态
-func (a *App) GetProxyStatus() []*ProxyStatusInfo {
-	var result []*ProxyStatusInfo
+// SetDNSQueryStream 开启或关闭 DNS 查询日志的实时推送（前端监听 "dns:query" 事件）
+func (a *App) SetDNSQueryStream(enabled bool) {
+	log.Printf("[App] SetDNSQueryStream: %v", enabled)
+	a.dnsQueryStream = enabled
+	a.applyDNSQueryStream()
+}
 
-	// TCP 代理状态
-	if a.proxyManager != nil {
-		for _, t := range a.proxyManager.GetStatus() {
-			result = append(result, &ProxyStatusInfo{
-				Domain:     t.Domain,
-				VIP:        t.VIP,
-				Port:       t.Port,
-				RemoteAddr: t.RemoteAddr,
-				Type:       "tcp",
-				TLS:        t.TLS,
-			})
-		}
+// applyDNSQueryStream 按当前开关设置 DNS 服务器的查询日志回调
+func (a *App) applyDNSQueryStream() {
+	if a.dnsServer == nil {
+		return
 	}
-
-	// SVCProxy 代理状态
-	if a.svcProxyMgr != nil {
-		for _, t := range a.svcProxyMgr.GetStatus() {
-			result = append(result, &ProxyStatusInfo{
-				Domain:     t.Domain,
-				VIP:        t.VIP,
-				Port:       t.Port,
-				RemoteAddr: fmt.Sprintf("%s:%d", t.AgentIP, t.GRPCPort),
-				Type:       "svc",
-			})
-		}
+	if !a.dnsQueryStream || mainApp == nil {
+		a.dnsServer.SetQueryObserver(nil)
+		return
 	}
-
-	return result
+	a.dnsServer.SetQueryObserver(func(entry *dns.QueryLogEntry) {
+		mainApp.Event.Emit(dnsQueryEvent, entry)
+	})
 }
 
 // ReconnectTunnel 重新连接隧道
@@ -1097,7 +2354,7 @@ func (a *App) GenerateKubeconfig() (*KubeconfigResult, error) {
 
 		// 从域名提取集群名称：kubernetes.{agent_name}.beagle → agent_name
 		// 或 kubernetes.{endpoint}.{agent_name}.beagle → endpoint-agent_name
-		clusterName := extractClusterName(r.Domain, r.AgentName)
+		clusterName := extractClusterName(r.Domain, r.AgentName, a.dnsZones())
 
 		// K8S API 默认端口 6443
 		port := 6443
@@ -1118,23 +2375,39 @@ func (a *App) GenerateKubeconfig() (*KubeconfigResult, error) {
 	}
 
 	// 4. 生成 kubeconfig YAML
-	homeDir, err := os.UserHomeDir()
+	kubeconfigPath, err := defaultKubeconfigPath()
 	if err != nil {
-		return nil, fmt.Errorf("获取 HOME 目录失败: %w", err)
+		return nil, err
 	}
-
-	kubeDir := homeDir + "/.kube"
-	if err := os.MkdirAll(kubeDir, 0700); err != nil {
+	if err := os.MkdirAll(filepath.Dir(kubeconfigPath), 0700); err != nil {
 		return nil, fmt.Errorf("创建 .kube 目录失败: %w", err)
 	}
 
-	kubeconfigPath := kubeDir + "/config"
-
 	// 读取现有 kubeconfig（如果存在）
 	existingContent, _ := os.ReadFile(kubeconfigPath)
 
+	// 先记录再写入：回滚时按名称删除本程序添加的集群、上下文和用户
+	// 同一进程内重复生成时合并之前记录的名称（之前生成的集群可能已不在本次列表中）
+	names := make([]string, 0, len(clusters))
+	for _, c := range clusters {
+		names = append(names, c.Name)
+	}
+	if a.sysJournal != nil {
+		if entry := a.sysJournal.Lookup(sysjournal.KindKubeconfig, kubeconfigPath); entry != nil {
+			names = append(names, strings.Split(entry.Data, ",")...)
+		}
+	}
+	names = slices.DeleteFunc(names, func(name string) bool { return name == "" })
+	slices.Sort(names)
+	a.recordChange(sysjournal.KindKubeconfig, kubeconfigPath, strings.Join(slices.Compact(names), ","))
+
 	// 构建新的 kubeconfig 内容
-	newContent := buildKubeconfig(string(existingContent), clusters)
+	// 有本地 CA 时 kubectl 用它验证代理证书，否则跳过验证
+	var caPEM []byte
+	if a.localCA != nil {
+		caPEM = a.localCA.CertPEM()
+	}
+	newContent := buildKubeconfig(string(existingContent), clusters, caPEM)
 
 	if err := os.WriteFile(kubeconfigPath, []byte(newContent), 0600); err != nil {
 		return nil, fmt.Errorf("写入 kubeconfig 失败: %w", err)
@@ -1156,26 +2429,161 @@ func (a *App) GenerateKubeconfig() (*KubeconfigResult, error) {
 // extractClusterName 从域名和 Agent 名称提取集群名称
 // kubernetes.beijing.beagle → beijing
 // kubernetes.beagle-241.beijing.beagle → beagle-241-beijing
-func extractClusterName(domain, agentName string) string {
-	// 移除域名后缀（.beagle 或其他）
-	parts := strings.Split(domain, ".")
-	if len(parts) < 3 {
+// kubernetes.beijing.corp.internal → beijing（后缀 corp.internal 可包含多级）
+func extractClusterName(domain, agentName string, zones []string) string {
+	// 移除域名后缀（zones 中的后缀，不在其中时按最后一级处理）
+	host, _, ok := dns.SplitZone(domain, zones)
+	if !ok {
+		host = domain[:max(strings.LastIndex(domain, "."), 0)]
+	}
+
+	// 去掉第一个 "kubernetes"
+	parts := strings.Split(host, ".")
+	if len(parts) < 2 {
 		return agentName
 	}
+	return strings.Join(parts[1:], "-")
+}
+
+// kubeconfig 中集群块的起止标记
+const (
+	kubeconfigMarker    = "# >>> AWECloud Signaling Clusters >>>"
+	kubeconfigMarkerEnd = "# <<< AWECloud Signaling Clusters <<<"
+)
+
+// kubeconfigUser 本程序添加的集群共用的用户名
+const kubeconfigUser = "signaling-user"
+
+// defaultKubeconfigPath 返回 ~/.kube/config
+func defaultKubeconfigPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("获取 HOME 目录失败: %w", err)
+	}
+	return filepath.Join(homeDir, ".kube", "config"), nil
+}
+
+// cleanupKubeconfig 正常退出时回滚本进程对 kubeconfig 的修改，失败时保留记录，下次启动再回滚
+func (a *App) cleanupKubeconfig() {
+	if a.sysJournal == nil {
+		return
+	}
+	path, err := defaultKubeconfigPath()
+	if err != nil {
+		return
+	}
+	entry := a.sysJournal.Lookup(sysjournal.KindKubeconfig, path)
+	if entry == nil {
+		return
+	}
+	if err := revertKubeconfig(entry); err != nil {
+		log.Printf("[App] 回滚 kubeconfig 失败: %v", err)
+		return
+	}
+	a.forgetChange(sysjournal.KindKubeconfig, path)
+}
+
+// revertKubeconfig 回滚 kubeconfig 修改：删除集群块，再按记录的集群名称删除本程序添加的集群、上下文和用户
+// （kubectl 修改配置时会重写整个文件，标记块不一定还在）。文件本身和其他条目始终保留
+func revertKubeconfig(entry *sysjournal.Entry) error {
+	content, err := os.ReadFile(entry.Target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取 kubeconfig 失败: %w", err)
+	}
+
+	existing := string(content)
+	begin := strings.Index(existing, kubeconfigMarker)
+	end := strings.Index(existing, kubeconfigMarkerEnd)
+	if begin >= 0 && end > begin {
+		end += len(kubeconfigMarkerEnd)
+		if end < len(existing) && existing[end] == '\n' {
+			end++
+		}
+		existing = existing[:begin] + existing[end:]
+	}
+
+	names := make(map[string]bool)
+	for _, name := range strings.Split(entry.Data, ",") {
+		if name != "" {
+			names[name] = true
+		}
+	}
+	existing = removeKubeconfigEntries(existing, names)
+
+	if existing == string(content) {
+		return nil
+	}
+	if err := os.WriteFile(entry.Target, []byte(existing), 0600); err != nil {
+		return fmt.Errorf("写入 kubeconfig 失败: %w", err)
+	}
+	return nil
+}
+
+// removeKubeconfigEntries 删除 kubeconfig 中名称在 names 中的集群和上下文、本程序的用户，
+// current-context 指向被删除的上下文时清空
+// 按 kubectl 写出的格式逐行处理：顶层键从第一列开始，列表项以 "- " 开头，项内的行缩进
+func removeKubeconfigEntries(content string, names map[string]bool) string {
+	var out, item []string
+	section := ""
+	flush := func() {
+		if item != nil && !ownsKubeconfigEntry(section, item, names) {
+			out = append(out, item...)
+		}
+		item = nil
+	}
+	for _, line := range strings.SplitAfter(content, "\n") {
+		text := strings.TrimRight(line, "\r\n")
+		switch {
+		case text != "" && !strings.HasPrefix(text, " ") && !strings.HasPrefix(text, "-") && !strings.HasPrefix(text, "#"):
+			flush()
+			key, value, _ := strings.Cut(text, ":")
+			section = key
+			if key == "current-context" && names[strings.Trim(strings.TrimSpace(value), `"'`)] {
+				line = `current-context: ""` + "\n"
+			}
+			out = append(out, line)
+		case strings.HasPrefix(text, "- ") && (section == "clusters" || section == "contexts" || section == "users"):
+			flush()
+			item = []string{line}
+		case item != nil && (text == "" || strings.HasPrefix(text, " ")):
+			item = append(item, line)
+		default:
+			flush()
+			out = append(out, line)
+		}
+	}
+	flush()
+	return strings.Join(out, "")
+}
 
-	// 去掉第一个 "kubernetes" 和最后一个后缀
-	middle := parts[1 : len(parts)-1]
-	return strings.Join(middle, "-")
+// ownsKubeconfigEntry 列表项是否是本程序添加的条目
+func ownsKubeconfigEntry(section string, item []string, names map[string]bool) bool {
+	for _, line := range item {
+		text := strings.TrimRight(line, "\r\n")
+		if !strings.HasPrefix(text, "- name:") && !strings.HasPrefix(text, "  name:") {
+			continue
+		}
+		name := strings.Trim(strings.TrimSpace(text[len("- name:"):]), `"'`)
+		if section == "users" {
+			return name == kubeconfigUser
+		}
+		return names[name]
+	}
+	return false
 }
 
 // buildKubeconfig 构建 kubeconfig YAML 内容
 // 使用标记块方式，避免影响用户已有配置
-func buildKubeconfig(existing string, clusters []clusterEntry) string {
+// caPEM 为本地 CA 证书，写入 certificate-authority-data；为空时写入 insecure-skip-tls-verify
+func buildKubeconfig(existing string, clusters []clusterEntry, caPEM []byte) string {
 	// 如果没有现有配置，生成完整的 kubeconfig
 	// 如果有现有配置，在标记块内替换
 
-	marker := "# >>> AWECloud Signaling Clusters >>>"
-	markerEnd := "# <<< AWECloud Signaling Clusters <<<"
+	marker := kubeconfigMarker
+	markerEnd := kubeconfigMarkerEnd
 
 	// 构建集群、上下文、用户条目
 	var clusterYAML, contextYAML, userYAML strings.Builder
@@ -1184,20 +2592,24 @@ func buildKubeconfig(existing string, clusters []clusterEntry) string {
 		// cluster 条目
 		clusterYAML.WriteString("- cluster:\n")
 		clusterYAML.WriteString(fmt.Sprintf("    server: https://%s:%d\n", c.VIP, c.Port))
-		clusterYAML.WriteString("    insecure-skip-tls-verify: true\n")
+		if len(caPEM) > 0 {
+			clusterYAML.WriteString(fmt.Sprintf("    certificate-authority-data: %s\n", base64.StdEncoding.EncodeToString(caPEM)))
+		} else {
+			clusterYAML.WriteString("    insecure-skip-tls-verify: true\n")
+		}
 		clusterYAML.WriteString(fmt.Sprintf("  name: %s\n", c.Name))
 
 		// context 条目
 		contextYAML.WriteString("- context:\n")
 		contextYAML.WriteString(fmt.Sprintf("    cluster: %s\n", c.Name))
-		contextYAML.WriteString("    user: signaling-user\n")
+		contextYAML.WriteString("    user: " + kubeconfigUser + "\n")
 		contextYAML.WriteString(fmt.Sprintf("  name: %s\n", c.Name))
 
 		// user 条目（共用一个 signaling-user）
 	}
 
 	// 只需要一个 user 条目
-	userYAML.WriteString("- name: signaling-user\n")
+	userYAML.WriteString("- name: " + kubeconfigUser + "\n")
 	userYAML.WriteString("  user: {}\n")
 
 	signalingBlock := fmt.Sprintf(`%s
@@ -1515,6 +2927,11 @@ func (a *App) ConnectService(serviceID string) (string, error) {
 		return "", fmt.Errorf("服务离线")
 	}
 
+	// web 类型服务直接返回浏览器访问地址
+	if targetService.WebURL != "" {
+		return targetService.WebURL, nil
+	}
+
 	// 构建连接地址
 	address := fmt.Sprintf("%s:%d", targetService.AgentTailscaleIP, targetService.ListenPort)
 
@@ -1713,6 +3130,7 @@ func (a *App) GetDomainList() ([]*DomainItem, error) {
 	if resourceErr != nil {
 		log.Printf("[App] ContainerSSH 资源查询失败，保留旧资源视图: %v", resourceErr)
 	} else {
+		a.applyDNSSearch(domains, resources)
 		if err := a.syncContainerSSHRoutes(resources); err != nil {
 			log.Printf("[App] ContainerSSH 路由同步失败: %v", err)
 		}
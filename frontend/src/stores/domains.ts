@@ -11,6 +11,7 @@ export interface DomainItem {
   namespace?: string          // K8S 命名空间（k8ssvc 类型时）
   service_name?: string       // K8S Service 名称（k8ssvc 类型时）
   region: string              // 区域名称（从 domain 解析，如 beijing）
+  udp_ports?: number[]        // UDP 端口列表（服务需要 UDP 转发时）
   display_name?: string
   resource_id?: string
 }
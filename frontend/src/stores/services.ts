@@ -20,6 +20,8 @@ export interface ServiceInfo {
   agent_tailscale_ip?: string  // Agent 的 Tailscale IP
   listen_port?: number         // Agent 监听端口
   target_addr?: string         // 内网目标地址
+  type?: string                // 服务类型：tcp / web
+  web_url?: string             // 浏览器访问地址（web 类型）
 }
 
 export interface ConnectionStatus {
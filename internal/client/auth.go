@@ -18,8 +18,9 @@ type AuthResult struct {
 	AuthKey    string
 	ServerURL  string
 	Message    string
-	IsNewLogin bool   // 是否是首次登录
-	DeviceName string // 设备名称（hostname）
+	IsNewLogin bool     // 是否是首次登录
+	DeviceName string   // 设备名称（hostname）
+	DNSZones   []string // Server 下发的内部域名后缀（为空时使用默认 beagle）
 }
 
 // Authenticate 认证（使用 Desktop 凭证）
@@ -110,6 +111,7 @@ func (c *DesktopClient) Authenticate(desktopID uint64, secret string) (*AuthResu
 		Message:    resp.Message,
 		IsNewLogin: false,
 		DeviceName: fingerprint.Hostname,
+		DNSZones:   resp.DnsZones,
 	}, nil
 }
 
@@ -33,6 +33,9 @@ const (
 // ErrStopReconnect 表示应停止重连（用户禁用或凭证无效）
 var ErrStopReconnect = errors.New("stop reconnect: user disabled or invalid credentials")
 
+// ErrDomainRejected 表示 Server 明确拒绝解析该域名（域名不存在或无权访问），区别于网络错误
+var ErrDomainRejected = errors.New("域名被 Server 拒绝")
+
 // DesktopClient Desktop 客户端
 type DesktopClient struct {
 	serverAddr string // gRPC地址（去掉协议前缀）
@@ -73,6 +76,9 @@ type DesktopClient struct {
 	// 重连回调（用于通知 App 层重新获取 authKey）
 	onReconnectNeeded func(reason ReconnectReason, message string) error
 
+	// 数据变更回调（数据流推送后通知 App 层刷新派生缓存）
+	onDataChanged func()
+
 	// 已授权服务列表
 	authorizedServices []*pb.AuthorizedService
 	servicesMutex      sync.RWMutex
@@ -221,6 +227,11 @@ func (c *DesktopClient) SetReconnectCallback(callback func(reason ReconnectReaso
 	c.onReconnectNeeded = callback
 }
 
+// SetDataChangedCallback 设置数据变更回调，数据流每次推送更新后调用
+func (c *DesktopClient) SetDataChangedCallback(callback func()) {
+	c.onDataChanged = callback
+}
+
 // SetTunnelStatusCallback 设置隧道状态查询回调
 func (c *DesktopClient) SetTunnelStatusCallback(callback func() (ip string, connected bool)) {
 	c.getTunnelStatus = callback
@@ -1091,6 +1102,10 @@ func (c *DesktopClient) handleDataStreamResponse(resp *pb.DesktopDataResponse) {
 		c.updateFavoritesCache(resp.FavoriteServiceIds)
 		log.Printf("[DesktopClient] DataStream FAVORITES: %d", len(resp.FavoriteServiceIds))
 	}
+
+	if c.onDataChanged != nil {
+		c.onDataChanged()
+	}
 }
 
 // updateServicesCache 更新服务列表缓存
@@ -1160,10 +1175,16 @@ type DomainResolveResult struct {
 	TargetPort   int
 	AgentName    string
 	DomainType   string
-	Namespace    string // K8S 命名空间（k8ssvc 类型时）
-	ServiceName  string // K8S Service 名称（k8ssvc 类型时）
-	SvcProxyPort int    // Agent SVCProxy gRPC 端口（k8ssvc 类型时）
-	EndpointName string // Endpoint 名称（Endpoint 跳跃时）
+	Namespace    string  // K8S 命名空间（k8ssvc 类型时）
+	ServiceName  string  // K8S Service 名称（k8ssvc 类型时）
+	SvcProxyPort int     // Agent SVCProxy gRPC 端口（k8ssvc 类型时）
+	EndpointName string  // Endpoint 名称（Endpoint 跳跃时）
+	UDPPorts     []int32 // UDP 端口列表（服务需要 UDP 转发时）
+
+	ProxyProtocol    string // 远程连接上发送的 PROXY protocol 版本（v1 / v2，为空时不发送）
+	ProxyProtocolTLV bool   // PROXY protocol v2 头部是否附加用户名 / Desktop ID TLV
+
+	BackendTLS bool // 后端是否为 HTTPS（web 类型时）
 }
 
 // ResolveDomain 通过 gRPC 解析 .beagle 域名
@@ -1184,7 +1205,7 @@ func (c *DesktopClient) ResolveDomain(domain string) (*DomainResolveResult, erro
 	}
 
 	if !resp.Success {
-		return nil, fmt.Errorf("%s", resp.Message)
+		return nil, fmt.Errorf("%w: %s", ErrDomainRejected, resp.Message)
 	}
 
 	return &DomainResolveResult{
@@ -1197,6 +1218,12 @@ func (c *DesktopClient) ResolveDomain(domain string) (*DomainResolveResult, erro
 		ServiceName:  resp.ServiceName,
 		SvcProxyPort: int(resp.SvcProxyPort),
 		EndpointName: resp.EndpointName,
+		UDPPorts:     resp.UdpPorts,
+
+		ProxyProtocol:    resp.ProxyProtocol,
+		ProxyProtocolTLV: resp.ProxyProtocolTlv,
+
+		BackendTLS: resp.BackendTls,
 	}, nil
 }
 
@@ -1298,6 +1325,7 @@ type DomainInfo struct {
 	Namespace    string   `json:"namespace"`     // K8S 命名空间（k8ssvc 类型）
 	ServiceName  string   `json:"service_name"`  // K8S Service 名称（k8ssvc 类型）
 	Region       string   `json:"region"`        // 区域名称（从域名解析）
+	UDPPorts     []int32  `json:"udp_ports"`     // UDP 端口列表（服务需要 UDP 转发时）
 }
 
 // GetDomainList 通过 gRPC 获取域名列表
@@ -1327,6 +1355,7 @@ func (c *DesktopClient) GetDomainList() ([]*DomainInfo, error) {
 			Namespace:    d.Namespace,
 			ServiceName:  d.ServiceName,
 			Region:       d.Region,
+			UDPPorts:     d.UdpPorts,
 		})
 	}
 
@@ -15,17 +15,28 @@ var GlobalConfig *Config
 
 // Config 是 Desktop 应用的配置（内存中使用）
 type Config struct {
-	ServerAddress   string        `json:"server_address"`   // Server gRPC 地址，例如 "localhost:8081"
-	ClientID        string        `json:"client_id"`        // Client ID（用户名/邮箱）
-	ClientSecret    string        `json:"client_secret"`    // Client Secret（加密存储）
-	DeviceToken     string        `json:"device_token"`     // Device Token（用于自动登录）
-	RememberMe      bool          `json:"remember_me"`      // 是否记住登录
-	TokenExpiresAt  int64         `json:"token_expires_at"` // Token 过期时间（Unix 时间戳）
-	TunnelToken     string        `json:"tunnel_token"`     // 隧道认证 Token
-	TunnelServer    string        `json:"tunnel_server"`    // 隧道服务器地址
-	TunnelPort      int           `json:"tunnel_port"`      // 隧道服务器端口
-	PortPreferences map[int64]int `json:"port_preferences"` // 服务 ID -> 本地端口映射
-	Telemetry       TelemetryConfig `json:"telemetry"`      // OpenTelemetry 配置
+	ServerAddress   string          `json:"server_address"`   // Server gRPC 地址，例如 "localhost:8081"
+	ClientID        string          `json:"client_id"`        // Client ID（用户名/邮箱）
+	ClientSecret    string          `json:"client_secret"`    // Client Secret（加密存储）
+	DeviceToken     string          `json:"device_token"`     // Device Token（用于自动登录）
+	RememberMe      bool            `json:"remember_me"`      // 是否记住登录
+	TokenExpiresAt  int64           `json:"token_expires_at"` // Token 过期时间（Unix 时间戳）
+	TunnelToken     string          `json:"tunnel_token"`     // 隧道认证 Token
+	TunnelServer    string          `json:"tunnel_server"`    // 隧道服务器地址
+	TunnelPort      int             `json:"tunnel_port"`      // 隧道服务器端口
+	PortPreferences map[int64]int   `json:"port_preferences"` // 服务 ID -> 本地端口映射
+	Telemetry       TelemetryConfig `json:"telemetry"`        // OpenTelemetry 配置
+	DNSUpstreams    []string        `json:"dns_upstreams"`    // 上游 DNS 列表（为空时使用系统原有 DNS）
+	DNSZones        []string        `json:"dns_zones"`        // 内部域名后缀（为空时使用 Server 下发的后缀）
+	DNSSearch       []string        `json:"dns_search"`       // 短名称搜索后缀（优先于 Server 下发的区域、租户）
+	ProxyIdle       int             `json:"proxy_idle"`       // 代理空闲回收时间（分钟），0 使用默认值，负数不回收
+	VIPPool         string          `json:"vip_pool"`         // VIP 地址段（为空时使用 127.1.0.0/16）
+	SOCKSListen     string          `json:"socks_listen"`     // 本地 SOCKS5 代理监听地址（为空时不启动），如 "127.0.0.1:1080"
+	SOCKSUser       string          `json:"socks_user"`       // SOCKS5 用户名（为空时不认证）
+
+	// SOCKS5 密码只保存哈希，两者都不返回给前端
+	SOCKSPasswordHash string `json:"-"` // SOCKS5 密码哈希（proxy.HashSOCKSPassword）
+	SOCKSPassword     string `json:"-"` // 旧版本保存的明文密码（只读取，启动时转换为哈希后清空）
 }
 
 // TelemetryConfig OpenTelemetry 配置
@@ -41,6 +52,18 @@ type LocalConfig struct {
 	Server string `json:"server"`          // Server 地址
 	Client string `json:"client"`          // Client ID（用户名/邮箱）
 	Token  string `json:"token,omitempty"` // Device Token（用于自动登录）
+
+	DNSUpstreams []string `json:"dns_upstreams,omitempty"` // 上游 DNS 列表，如 "10.0.0.53"、"tls://1.1.1.1"
+	DNSZones     []string `json:"dns_zones,omitempty"`     // 内部域名后缀，如 "beagle"、"corp.internal"
+	DNSSearch    []string `json:"dns_search,omitempty"`    // 短名称搜索后缀，如 "beijing.beagle"
+
+	ProxyIdle int    `json:"proxy_idle,omitempty"` // 代理空闲回收时间（分钟），0 使用默认值，负数不回收
+	VIPPool   string `json:"vip_pool,omitempty"`   // VIP 地址段，如 "127.77.0.0/16"
+
+	SOCKSListen       string `json:"socks_listen,omitempty"`        // 本地 SOCKS5 代理监听地址，如 "127.0.0.1:1080"
+	SOCKSUser         string `json:"socks_user,omitempty"`          // SOCKS5 用户名
+	SOCKSPasswordHash string `json:"socks_password_hash,omitempty"` // SOCKS5 密码哈希（不保存明文）
+	SOCKSPassword     string `json:"socks_password,omitempty"`      // 旧版本保存的明文密码，只读取不再写入
 }
 
 // GetAppDir 返回应用数据目录
@@ -126,6 +149,16 @@ func Load() (*Config, error) {
 		DeviceToken:     localConfig.Token,
 		RememberMe:      localConfig.Token != "", // 有 token 就是记住登录
 		PortPreferences: make(map[int64]int),
+		DNSUpstreams:    localConfig.DNSUpstreams,
+		DNSZones:        localConfig.DNSZones,
+		DNSSearch:       localConfig.DNSSearch,
+		ProxyIdle:       localConfig.ProxyIdle,
+		VIPPool:         localConfig.VIPPool,
+		SOCKSListen:     localConfig.SOCKSListen,
+		SOCKSUser:       localConfig.SOCKSUser,
+
+		SOCKSPasswordHash: localConfig.SOCKSPasswordHash,
+		SOCKSPassword:     localConfig.SOCKSPassword,
 	}
 
 	// 如果没有服务器地址，使用默认值
@@ -143,11 +176,20 @@ func (c *Config) Save() error {
 		return err
 	}
 
-	// 转换为 LocalConfig（只保存 3 个字段）
+	// 转换为 LocalConfig（只保存需要持久化的字段）
 	localConfig := LocalConfig{
-		Server: c.ServerAddress,
-		Client: c.ClientID,
-		Token:  c.DeviceToken,
+		Server:       c.ServerAddress,
+		Client:       c.ClientID,
+		Token:        c.DeviceToken,
+		DNSUpstreams: c.DNSUpstreams,
+		DNSZones:     c.DNSZones,
+		DNSSearch:    c.DNSSearch,
+		ProxyIdle:    c.ProxyIdle,
+		VIPPool:      c.VIPPool,
+
+		SOCKSListen:       c.SOCKSListen,
+		SOCKSUser:         c.SOCKSUser,
+		SOCKSPasswordHash: c.SOCKSPasswordHash,
 	}
 
 	data, err := json.MarshalIndent(localConfig, "", "  ")
@@ -155,7 +197,11 @@ func (c *Config) Save() error {
 		return err
 	}
 
-	return os.WriteFile(configPath, data, 0600)
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return err
+	}
+	// 文件已存在时 WriteFile 不修改权限，旧版本创建的配置文件可能是 0644
+	return os.Chmod(configPath, 0600)
 }
 
 // ClearToken 清除所有认证信息
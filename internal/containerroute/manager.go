@@ -71,7 +71,7 @@ func (m *Manager) Sync(resources []*client.ResourceInfo) error {
 			m.proxy.StopProxy(current.vip, 22)
 		}
 		remoteAddr := net.JoinHostPort(resource.AgentIP, fmt.Sprintf("%d", resource.ListenPort))
-		if err := m.proxy.StartProxy(proxy.Target{Domain: domain, VIP: vipAddr, RemoteAddr: remoteAddr, Port: 22}); err != nil {
+		if err := m.proxy.StartProxy(proxy.Target{Domain: domain, VIP: vipAddr, RemoteAddr: remoteAddr, Port: 22, KeepAlive: true}); err != nil {
 			return err
 		}
 		m.routes[domain] = route{
@@ -0,0 +1,253 @@
+package dns
+
+import (
+	"container/list"
+	"encoding/binary"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cache.go 缓存上游 DNS 的应答，避免每个非内部域名的查询都要走一次上游往返
+// 正向应答按记录 TTL 缓存；NXDOMAIN / NODATA 按 RFC 2308 取 SOA 的 TTL 与 MINIMUM 中较小者做否定缓存，
+// 没有 SOA 的否定应答不缓存。超过容量时淘汰最久未使用的条目
+
+// 缓存参数
+const (
+	defaultCacheSize = 4096      // 最多缓存的问题数
+	maxCacheTTL      = time.Hour // 单条缓存的最长有效期，避免上游给出过大的 TTL
+)
+
+// dnsTypeSOA SOA 记录类型，否定应答的授权段携带
+const dnsTypeSOA uint16 = 6
+
+// CacheStats DNS 应答缓存统计（用于状态展示）
+type CacheStats struct {
+	Entries  int    `json:"entries"`  // 当前缓存条目数
+	Capacity int    `json:"capacity"` // 缓存容量
+	Hits     uint64 `json:"hits"`     // 命中次数
+	Misses   uint64 `json:"misses"`   // 未命中次数
+}
+
+// cacheEntry 一条缓存的应答
+type cacheEntry struct {
+	key      string
+	msg      *message  // 去掉 OPT 记录后的应答，取出时记录 TTL 按已经过的时间递减
+	storedAt time.Time // 写入时间
+	expires  time.Time // 过期时间
+}
+
+// answerCache 按问题（域名 + 类型 + 类别）缓存上游应答的 LRU 缓存
+type answerCache struct {
+	capacity int
+	entries  map[string]*list.Element
+	lru      *list.List // 队首为最近使用
+
+	hits   uint64
+	misses uint64
+
+	mu sync.Mutex
+}
+
+// newAnswerCache 创建应答缓存
+func newAnswerCache(capacity int) *answerCache {
+	return &answerCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// questionKey 由报文的问题（线路格式的域名 + 类型 + 类别）生成键，域名不区分大小写
+func questionKey(m *message) (string, bool) {
+	if len(m.questions) != 1 {
+		return "", false
+	}
+	q := m.questions[0]
+	key := encodeName(strings.ToLower(q.name))
+	key = binary.BigEndian.AppendUint16(key, q.qtype)
+	key = binary.BigEndian.AppendUint16(key, q.qclass)
+	return string(key), true
+}
+
+// cacheKey 由查询的问题和 DO、CD 标志生成缓存键
+// 上游对 DO=1 的查询附带 DNSSEC 记录，对 CD=1 的查询不做验证，应答内容不同，不能混用
+func cacheKey(query *message) (string, bool) {
+	key, ok := questionKey(query)
+	if !ok {
+		return "", false
+	}
+	var flags byte
+	if query.edns != nil && query.edns.dnssecOK {
+		flags |= 1
+	}
+	if query.checkingDisabled {
+		flags |= 2
+	}
+	return key + string(flags), true
+}
+
+// get 查找查询对应的缓存应答，命中时返回改写了 ID、问题段和剩余 TTL 的应答
+func (c *answerCache) get(packet []byte) ([]byte, bool) {
+	query, err := parseMessage(packet)
+	if err != nil {
+		return nil, false
+	}
+	key, ok := cacheKey(query)
+	if !ok {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	if ok && time.Now().After(elem.Value.(*cacheEntry).expires) {
+		c.removeLocked(elem)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		c.mu.Unlock()
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(elem)
+	entry := elem.Value.(*cacheEntry)
+	c.mu.Unlock()
+
+	// ID 和问题段取自本次查询（保留客户端的大小写），RD、CD 标志跟随查询，OPT 按查询重新附加
+	resp := &message{header: entry.msg.header, questions: query.questions}
+	resp.id = query.id
+	resp.recursionDesired = query.recursionDesired
+	resp.checkingDisabled = query.checkingDisabled
+	if query.edns != nil {
+		resp.edns = &edns{udpSize: ednsUDPSize, dnssecOK: query.edns.dnssecOK}
+	}
+
+	elapsed := uint32(time.Since(entry.storedAt) / time.Second)
+	cached, asked := entry.msg.questions[0].name, query.questions[0].name
+	resp.answers = copyRecords(entry.msg.answers, cached, asked, elapsed)
+	resp.authority = copyRecords(entry.msg.authority, cached, asked, elapsed)
+	resp.additional = copyRecords(entry.msg.additional, cached, asked, elapsed)
+	return resp.pack(), true
+}
+
+// copyRecords 复制缓存的记录：名称为缓存问题域名的记录改用本次查询的写法（可压缩为指向问题段的指针），
+// TTL 减去已经过的秒数（不低于 0）
+func copyRecords(records []resource, cached, asked string, elapsed uint32) []resource {
+	result := make([]resource, len(records))
+	for i, rr := range records {
+		if strings.EqualFold(rr.name, cached) {
+			rr.name = asked
+		}
+		if rr.ttl > elapsed {
+			rr.ttl -= elapsed
+		} else {
+			rr.ttl = 0
+		}
+		result[i] = rr
+	}
+	return result
+}
+
+// put 缓存上游应答，不可缓存的应答（SERVFAIL、截断、无 SOA 的否定应答等）直接忽略
+func (c *answerCache) put(packet, raw []byte) {
+	query, err := parseMessage(packet)
+	if err != nil {
+		return
+	}
+	key, ok := cacheKey(query)
+	if !ok {
+		return
+	}
+	resp, err := parseMessage(raw)
+	if err != nil || !resp.response || resp.truncated {
+		return
+	}
+	want, _ := questionKey(query)
+	if got, ok := questionKey(resp); !ok || got != want {
+		return
+	}
+
+	ttl, ok := prepareCacheEntry(resp)
+	if !ok || ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	entry := &cacheEntry{key: key, msg: resp, storedAt: now, expires: now.Add(ttl)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.capacity {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+// removeLocked 删除一个条目（调用方持有锁）
+func (c *answerCache) removeLocked(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// flush 清空缓存（上游变更时调用），统计计数保留
+func (c *answerCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// stats 返回缓存统计
+func (c *answerCache) stats() *CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &CacheStats{
+		Entries:  c.lru.Len(),
+		Capacity: c.capacity,
+		Hits:     c.hits,
+		Misses:   c.misses,
+	}
+}
+
+// prepareCacheEntry 整理待缓存的应答：去掉上游的 OPT 记录（取出时按查询重新附加），
+// 将记录 TTL 限制在 maxCacheTTL 以内，并按 RFC 2308 计算缓存有效期
+func prepareCacheEntry(resp *message) (time.Duration, bool) {
+	if resp.rcode != rcodeSuccess && resp.rcode != rcodeNameError {
+		return 0, false
+	}
+	resp.edns = nil
+
+	minTTL, negativeTTL := ^uint32(0), ^uint32(0)
+	maxTTL := uint32(maxCacheTTL / time.Second)
+	for _, section := range [][]resource{resp.answers, resp.authority, resp.additional} {
+		for i := range section {
+			section[i].ttl = min(section[i].ttl, maxTTL)
+		}
+	}
+	for _, rr := range resp.answers {
+		minTTL = min(minTTL, rr.ttl)
+	}
+	for i, rr := range resp.authority {
+		if rr.rtype == dnsTypeSOA && len(rr.data) >= 22 {
+			// RFC 2308：否定缓存时间取 SOA 记录 TTL 与 MINIMUM 字段中的较小者
+			resp.authority[i].ttl = min(rr.ttl, binary.BigEndian.Uint32(rr.data[len(rr.data)-4:]))
+			negativeTTL = min(negativeTTL, resp.authority[i].ttl)
+		}
+	}
+
+	ttl := minTTL
+	if resp.rcode == rcodeNameError || len(resp.answers) == 0 {
+		ttl = negativeTTL
+	}
+	if ttl == ^uint32(0) {
+		return 0, false
+	}
+	return time.Duration(ttl) * time.Second, true
+}
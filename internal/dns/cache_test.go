@@ -0,0 +1,179 @@
+package dns
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// withRecord 向响应追加一条名称指向问题域名的记录，section 为计数字段偏移（6=应答、8=授权、10=附加）
+func withRecord(resp []byte, section int, rtype uint16, ttl uint32, rdata []byte) []byte {
+	resp = append(resp, 0xc0, 0x0c)
+	resp = binary.BigEndian.AppendUint16(resp, rtype)
+	resp = binary.BigEndian.AppendUint16(resp, 1)
+	resp = binary.BigEndian.AppendUint32(resp, ttl)
+	resp = binary.BigEndian.AppendUint16(resp, uint16(len(rdata)))
+	resp = append(resp, rdata...)
+	binary.BigEndian.PutUint16(resp[section:section+2], binary.BigEndian.Uint16(resp[section:section+2])+1)
+	return resp
+}
+
+// upstreamReply 以查询为基础构造上游响应头
+func upstreamReply(query []byte, rcode byte) []byte {
+	m, err := parseMessage(query)
+	if err != nil {
+		panic(err)
+	}
+	reply := m.reply(rcodeSuccess, false)
+	reply.edns = nil
+	resp := reply.pack()
+	resp[2], resp[3] = 0x81, 0x80|rcode
+	return resp
+}
+
+// hasOPT 报告报文是否携带 OPT 记录
+func hasOPT(t *testing.T, packet []byte) bool {
+	t.Helper()
+	m, err := parseMessage(packet)
+	if err != nil {
+		t.Fatalf("invalid message: %v", err)
+	}
+	return m.edns != nil
+}
+
+// soaRData 构造 SOA 记录数据（MNAME/RNAME 为根域）
+func soaRData(minimum uint32) []byte {
+	rdata := []byte{0, 0}
+	for _, v := range []uint32{1, 3600, 600, 86400, minimum} {
+		rdata = binary.BigEndian.AppendUint32(rdata, v)
+	}
+	return rdata
+}
+
+func TestCacheServesPositiveAnswerWithDecrementedTTL(t *testing.T) {
+	cache := newAnswerCache(8)
+	query := buildQuery(1, "www.example.com.", dnsTypeA)
+	resp := withRecord(upstreamReply(query, 0), 6, dnsTypeA, 300, []byte{93, 184, 216, 34})
+	cache.put(query, resp)
+
+	// 模拟写入 100 秒后再次查询，域名大小写不同也应命中
+	elem := cache.entries["\x03www\x07example\x03com\x00\x00\x01\x00\x01\x00"]
+	if elem == nil {
+		t.Fatal("expected answer to be cached")
+	}
+	elem.Value.(*cacheEntry).storedAt = time.Now().Add(-100 * time.Second)
+
+	again := buildQuery(2, "WWW.Example.com.", dnsTypeA)
+	hit, ok := cache.get(again)
+	if !ok {
+		t.Fatal("expected cache hit")
+	}
+	if binary.BigEndian.Uint16(hit[0:2]) != 2 || string(hit[12:len(again)]) != string(again[12:]) {
+		t.Fatal("cached answer must carry the new query ID and question")
+	}
+	if ttl := binary.BigEndian.Uint32(hit[len(again)+6:]); ttl != 200 {
+		t.Fatalf("expected remaining TTL 200, got %d", ttl)
+	}
+	if stats := cache.stats(); stats.Hits != 1 || stats.Entries != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCacheNegativeAnswersUseSOAMinimum(t *testing.T) {
+	cache := newAnswerCache(8)
+	query := buildQuery(1, "missing.example.com.", dnsTypeA)
+	resp := withRecord(upstreamReply(query, 3), 8, dnsTypeSOA, 900, soaRData(60))
+	cache.put(query, resp)
+
+	hit, ok := cache.get(query)
+	if !ok {
+		t.Fatal("NXDOMAIN with SOA must be cached")
+	}
+	if hit[3]&0x0f != 3 {
+		t.Fatalf("expected cached NXDOMAIN, got rcode %d", hit[3]&0x0f)
+	}
+	if ttl := binary.BigEndian.Uint32(hit[len(query)+6:]); ttl != 60 {
+		t.Fatalf("negative TTL must be min(SOA TTL, MINIMUM), got %d", ttl)
+	}
+
+	// 没有 SOA 的否定应答不缓存
+	other := buildQuery(2, "nosoa.example.com.", dnsTypeA)
+	cache.put(other, upstreamReply(other, 3))
+	if _, ok := cache.get(other); ok {
+		t.Fatal("negative answer without SOA must not be cached")
+	}
+}
+
+func TestCacheSkipsUncacheableAnswers(t *testing.T) {
+	cache := newAnswerCache(8)
+	query := buildQuery(1, "www.example.com.", dnsTypeA)
+
+	cache.put(query, upstreamReply(query, 2))
+	truncated := withRecord(upstreamReply(query, 0), 6, dnsTypeA, 300, []byte{1, 2, 3, 4})
+	truncated[2] |= 0x02
+	cache.put(query, truncated)
+	cache.put(query, withRecord(upstreamReply(query, 0), 6, dnsTypeA, 0, []byte{1, 2, 3, 4}))
+
+	if stats := cache.stats(); stats.Entries != 0 {
+		t.Fatalf("SERVFAIL, truncated and zero-TTL answers must not be cached, got %d entries", stats.Entries)
+	}
+}
+
+func TestCacheStripsUpstreamOPTAndEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newAnswerCache(2)
+	names := []string{"a.example.com.", "b.example.com.", "c.example.com."}
+	for i, name := range names {
+		query := withOPT(buildQuery(uint16(i), name, dnsTypeA), 1232)
+		resp := withRecord(upstreamReply(buildQuery(uint16(i), name, dnsTypeA), 0), 6, dnsTypeA, 300, []byte{10, 0, 0, byte(i)})
+		resp = withOPT(resp, 1232)
+		cache.put(query, resp)
+		if i == 1 {
+			// 访问 a，使 b 成为最久未使用
+			cache.get(buildQuery(9, names[0], dnsTypeA))
+		}
+	}
+
+	if _, ok := cache.get(buildQuery(9, names[1], dnsTypeA)); ok {
+		t.Fatal("least recently used entry must be evicted")
+	}
+	plain := buildQuery(9, names[0], dnsTypeA)
+	hit, ok := cache.get(plain)
+	if !ok {
+		t.Fatal("recently used entry must survive eviction")
+	}
+	if hasOPT(t, hit) {
+		t.Fatal("cached answer for a non-EDNS query must not carry an OPT record")
+	}
+	hit, ok = cache.get(withOPT(buildQuery(9, names[2], dnsTypeA), 1232))
+	if !ok {
+		t.Fatal("expected cache hit")
+	}
+	if !hasOPT(t, hit) {
+		t.Fatal("cached answer for an EDNS query must carry an OPT record")
+	}
+}
+
+func TestCacheSeparatesDNSSECAndCheckingDisabledQueries(t *testing.T) {
+	cache := newAnswerCache(8)
+	plain := buildQuery(1, "www.example.com.", dnsTypeA)
+	cache.put(plain, withRecord(upstreamReply(plain, 0), 6, dnsTypeA, 300, []byte{93, 184, 216, 34}))
+
+	dnssec := withOPT(buildQuery(2, "www.example.com.", dnsTypeA), 1232)
+	dnssec[len(dnssec)-4] |= 0x80 // DO=1
+	if _, ok := cache.get(dnssec); ok {
+		t.Fatal("an answer cached for DO=0 must not be served to a DO=1 query")
+	}
+	unchecked := buildQuery(3, "www.example.com.", dnsTypeA)
+	unchecked[3] |= 0x10 // CD=1
+	if _, ok := cache.get(unchecked); ok {
+		t.Fatal("an answer cached for CD=0 must not be served to a CD=1 query")
+	}
+
+	cache.put(unchecked, withRecord(upstreamReply(unchecked, 0), 6, dnsTypeA, 300, []byte{93, 184, 216, 35}))
+	if _, ok := cache.get(buildQuery(4, "www.example.com.", dnsTypeA)); !ok {
+		t.Fatal("plain query must still hit its own entry")
+	}
+	if _, ok := cache.get(unchecked); !ok {
+		t.Fatal("CD=1 query must hit the entry cached for CD=1")
+	}
+}
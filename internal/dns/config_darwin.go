@@ -7,12 +7,12 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/open-beagle/awecloud-signaling-desktop/internal/privilege"
 )
 
 const resolverDir = "/etc/resolver"
-const resolverFile = "beagle"                        // 域名后缀
 const resolverHeader = "# Added by Signal Desktop\n" // 文件标记，用于清理时识别
 
 // RecommendedListenAddr 返回 macOS 平台推荐的 DNS 监听地址
@@ -27,48 +27,79 @@ func RecommendedPort() int {
 	return 15353
 }
 
-// ConfigureSystemDNS 配置系统 DNS，将 .beagle 域名指向本地 DNS 服务器
-// macOS: 通过 osascript 提权创建 /etc/resolver/beagle 文件
-func ConfigureSystemDNS(port int) error {
+// SystemResolvers 返回系统原有的上游 DNS，需在 ConfigureSystemDNS 之前调用
+// macOS 的 /etc/resolv.conf 由系统根据当前网络生成，包含主 DNS 服务器
+func SystemResolvers() []string {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	return parseResolvConf(data)
+}
+
+// ConfigureSystemDNS 配置系统 DNS，将内部域名后缀（zones）指向本地 DNS 服务器
+// macOS: 通过 osascript 提权为每个后缀创建 /etc/resolver/<zone> 文件
+// 写入前先删除上次留下的带标记文件，后缀列表变化时不会残留旧配置
+func ConfigureSystemDNS(port int, zones []string) error {
 	content := fmt.Sprintf("%snameserver 127.0.0.1\nport %d\n", resolverHeader, port)
-	resolverPath := filepath.Join(resolverDir, resolverFile)
 
-	// 通过 osascript 提权创建目录和写入文件
-	cmd := fmt.Sprintf("mkdir -p %s && printf '%%s' '%s' > %s",
-		resolverDir, content, resolverPath)
-	if _, err := privilege.RunWithPrivilege(cmd); err != nil {
-		return fmt.Errorf("创建 %s 失败（需要管理员权限）: %w", resolverPath, err)
+	cmds := []string{fmt.Sprintf("mkdir -p %s", resolverDir)}
+	for _, path := range managedResolverFiles() {
+		cmds = append(cmds, fmt.Sprintf("rm -f '%s'", path))
+	}
+	for _, zone := range zones {
+		cmds = append(cmds, fmt.Sprintf("printf '%%s' '%s' > '%s'", content, filepath.Join(resolverDir, zone)))
 	}
 
-	log.Printf("[DNS] macOS DNS 配置已写入: %s (port=%d)", resolverPath, port)
+	// 通过 osascript 提权创建目录和写入文件（一次授权完成）
+	if _, err := privilege.RunWithPrivilege(strings.Join(cmds, " && ")); err != nil {
+		return fmt.Errorf("创建 %s 配置失败（需要管理员权限）: %w", resolverDir, err)
+	}
+
+	log.Printf("[DNS] macOS DNS 配置已写入: %s/{%s} (port=%d)", resolverDir, strings.Join(zones, ","), port)
 	return nil
 }
 
 // CleanupSystemDNS 清理系统 DNS 配置
-// 只删除带有 Signal Desktop 标记的文件
+// 只删除带有 Signal Desktop 标记的文件（包括旧版本写入的 /etc/resolver/beagle）
 func CleanupSystemDNS() error {
-	resolverPath := filepath.Join(resolverDir, resolverFile)
-
-	// 先检查文件是否存在
-	data, err := os.ReadFile(resolverPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		// 可能没有读取权限，尝试直接删除
+	paths := managedResolverFiles()
+	if len(paths) == 0 {
+		return nil
 	}
 
-	// 只删除带有我们标记的文件
-	if len(data) > 0 && string(data[:min(len(data), len(resolverHeader))]) != resolverHeader {
-		log.Printf("[DNS] %s 不是由 Signal Desktop 创建的，跳过删除", resolverPath)
-		return nil
+	cmds := make([]string, 0, len(paths))
+	for _, path := range paths {
+		cmds = append(cmds, fmt.Sprintf("rm -f '%s'", path))
 	}
 
 	// 通过 osascript 提权删除文件
-	if _, err := privilege.RunWithPrivilege(fmt.Sprintf("rm -f %s", resolverPath)); err != nil {
-		return fmt.Errorf("删除 %s 失败: %w", resolverPath, err)
+	if _, err := privilege.RunWithPrivilege(strings.Join(cmds, " && ")); err != nil {
+		return fmt.Errorf("删除 %s 配置失败: %w", resolverDir, err)
 	}
 
-	log.Printf("[DNS] macOS DNS 配置已清理")
+	log.Printf("[DNS] macOS DNS 配置已清理: %s", strings.Join(paths, ", "))
 	return nil
 }
+
+// managedResolverFiles 返回 /etc/resolver 下由 Signal Desktop 创建（带标记）的文件
+func managedResolverFiles() []string {
+	entries, err := os.ReadDir(resolverDir)
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		path := filepath.Join(resolverDir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil || !strings.HasPrefix(string(data), resolverHeader) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
@@ -3,134 +3,477 @@
 package dns
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 )
 
+// Linux 上系统 DNS 的管理方式因发行版和桌面环境而异，按以下顺序检测后端：
+//   - systemd-resolved：写 /etc/systemd/resolved.conf.d/beagle.conf 路由域（失败时回退 resolvectl）
+//   - NetworkManager + dnsmasq：写 /etc/NetworkManager/dnsmasq.d/signal-desktop.conf 按后缀转发
+//   - resolvconf / openresolv：添加 lo.signal-desktop 接口记录
+//   - 普通 /etc/resolv.conf：在文件开头插入受管理的 nameserver 块，修改前备份
+// 后两种方式无法按后缀路由，也无法指定端口，本地 DNS 必须监听 53 端口并作为首选 DNS，
+// 非内部域名由本地 DNS 转发到原有上游
+
+// linuxSystem 系统 DNS 配置使用的文件系统根目录和命令执行器，测试时替换为临时目录和假命令
+type linuxSystem struct {
+	root     string                                                          // 文件系统根目录，正常为 "/"
+	run      func(stdin string, name string, args ...string) ([]byte, error) // 执行命令，返回合并输出
+	lookPath func(file string) (string, error)                               // 查找命令
+
+	detectOnce sync.Once
+	detected   linuxBackend // 首次使用时检测到的后端
+}
+
+// sys 当前使用的系统环境
+var sys = &linuxSystem{root: "/", run: runCommand, lookPath: exec.LookPath}
+
+// runCommand 执行命令，stdin 非空时写入标准输入
+func runCommand(stdin string, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	return cmd.CombinedOutput()
+}
+
+// path 返回文件系统根目录下的绝对路径
+func (s *linuxSystem) path(p string) string {
+	return filepath.Join(s.root, p)
+}
+
+// hasCommand 命令是否存在
+func (s *linuxSystem) hasCommand(name string) bool {
+	_, err := s.lookPath(name)
+	return err == nil
+}
+
+// isActive systemd 服务是否运行
+func (s *linuxSystem) isActive(unit string) bool {
+	_, err := s.run("", "systemctl", "is-active", "--quiet", unit)
+	return err == nil
+}
+
+// 各后端使用的路径
+const (
+	resolvedConfDir   = "/etc/systemd/resolved.conf.d"
+	resolvedConfFile  = resolvedConfDir + "/beagle.conf"
+	nmConfFile        = "/etc/NetworkManager/NetworkManager.conf"
+	nmConfDir         = "/etc/NetworkManager/conf.d"
+	dnsmasqConfDir    = "/etc/NetworkManager/dnsmasq.d"
+	dnsmasqConfFile   = dnsmasqConfDir + "/signal-desktop.conf"
+	resolvConfFile    = "/etc/resolv.conf"
+	resolvConfBackup  = "/etc/resolv.conf.signal-desktop.bak"
+	resolvconfIface   = "lo.signal-desktop"
+	linuxConfigHeader = "# Added by Signal Desktop\n" // 文件标记，用于清理时识别
+)
+
+// resolv.conf 受管理块的起止标记
+const (
+	resolvBlockStart = "# >>> Signal Desktop >>>"
+	resolvBlockEnd   = "# <<< Signal Desktop <<<"
+)
+
+// linuxBackend 系统 DNS 后端
+type linuxBackend string
+
+const (
+	backendResolved   linuxBackend = "systemd-resolved"
+	backendDnsmasq    linuxBackend = "networkmanager-dnsmasq"
+	backendResolvconf linuxBackend = "resolvconf"
+	backendResolvFile linuxBackend = "resolv.conf"
+	backendNone       linuxBackend = "none"
+)
+
+// detectBackend 检测当前系统使用的 DNS 管理方式
+func (s *linuxSystem) detectBackend() linuxBackend {
+	switch {
+	case s.isActive("systemd-resolved"):
+		return backendResolved
+	case s.isNetworkManagerDnsmasq():
+		return backendDnsmasq
+	case s.hasCommand("resolvconf"):
+		return backendResolvconf
+	}
+
+	// /etc/resolv.conf 是普通文件时直接管理；是符号链接说明由其他程序生成，改了也会被覆盖
+	if info, err := os.Lstat(s.path(resolvConfFile)); err == nil && info.Mode().IsRegular() {
+		return backendResolvFile
+	}
+	return backendNone
+}
+
+// backend 返回检测到的后端，只在首次调用时检测一次
+// 检测需要执行 systemctl，状态展示、VIP 地址池校验等都会查询推荐端口，不能每次都检测
+func (s *linuxSystem) backend() linuxBackend {
+	s.detectOnce.Do(func() { s.detected = s.detectBackend() })
+	return s.detected
+}
+
+// isNetworkManagerDnsmasq NetworkManager 是否运行并使用内置 dnsmasq（dns=dnsmasq）
+func (s *linuxSystem) isNetworkManagerDnsmasq() bool {
+	files := []string{s.path(nmConfFile)}
+	if extra, err := filepath.Glob(filepath.Join(s.path(nmConfDir), "*.conf")); err == nil {
+		files = append(files, extra...)
+	}
+
+	dnsmasq := false
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.ReplaceAll(strings.TrimSpace(scanner.Text()), " ", "")
+			if strings.HasPrefix(line, "dns=") {
+				// conf.d 中后加载的配置覆盖前面的
+				dnsmasq = line == "dns=dnsmasq"
+			}
+		}
+	}
+	return dnsmasq && s.isActive("NetworkManager")
+}
+
+// port 后端要求的本地 DNS 监听端口
+// systemd-resolved 和 dnsmasq 支持指定端口，使用 5353 避免与系统 DNS 冲突；
+// resolv.conf 的 nameserver 不支持端口，只能使用 53
+func (b linuxBackend) port() int {
+	if b == backendResolvconf || b == backendResolvFile {
+		return 53
+	}
+	return 5353
+}
+
 // RecommendedListenAddr 返回 Linux 平台推荐的 DNS 监听地址
 func RecommendedListenAddr() string {
-	return "127.0.0.2:5353"
+	return fmt.Sprintf("127.0.0.2:%d", RecommendedPort())
 }
 
 // RecommendedPort 返回 Linux 平台推荐的 DNS 监听端口
-// systemd-resolved 占用 53 端口，Desktop DNS 使用 5353 避免冲突
+// systemd-resolved / dnsmasq 占用 53 端口，Desktop DNS 使用 5353 避免冲突；
+// resolvconf 和普通 resolv.conf 只能使用 53 端口
 func RecommendedPort() int {
-	return 5353
+	return sys.backend().port()
 }
 
-// ConfigureSystemDNS 配置 Linux 系统 DNS，将 .beagle 域名指向本地 DNS 服务器
-// 优先使用 systemd-resolved（resolvectl），回退到 /etc/resolv.conf
-func ConfigureSystemDNS(port int) error {
-	// 方案 1：尝试 systemd-resolved
-	if isSystemdResolvedRunning() {
-		return configureSystemdResolved(port)
+// SystemResolvers 返回系统原有的上游 DNS，需在 ConfigureSystemDNS 之前调用
+// systemd-resolved 运行时 /etc/resolv.conf 只有存根地址 127.0.0.53，真实上游在 /run/systemd/resolve/resolv.conf
+// 本地 DNS 服务器自身和存根地址会被排除，避免转发回环
+func SystemResolvers() []string {
+	for _, path := range []string{"/run/systemd/resolve/resolv.conf", resolvConfFile} {
+		data, err := os.ReadFile(sys.path(path))
+		if err != nil {
+			continue
+		}
+		if servers := parseResolvConf(data, "127.0.0.2", "127.0.0.53"); len(servers) > 0 {
+			return servers
+		}
 	}
-
-	// 方案 2：回退到 /etc/resolv.conf 提示
-	log.Printf("[DNS] systemd-resolved 未运行，请手动配置 DNS")
-	log.Printf("[DNS] 将 .beagle 域名指向 127.0.0.2:%d", port)
 	return nil
 }
 
+// ConfigureSystemDNS 配置 Linux 系统 DNS，将内部域名后缀（zones）指向本地 DNS 服务器
+// 按检测到的后端配置，port 需与 RecommendedPort 一致
+// 不注册短名称的搜索后缀：系统解析器会自己按顺序展开，取第一个能解析的后缀，
+// 以完整域名查询本地 DNS，本地 DNS 无法再判断短名称是否有歧义
+func ConfigureSystemDNS(port int, zones []string) error {
+	return sys.configure(port, zones)
+}
+
 // CleanupSystemDNS 清理 Linux 系统 DNS 配置
+// 不依赖当前检测到的后端，逐个清理各后端留下的配置（后端可能在两次运行之间变化）
 func CleanupSystemDNS() error {
-	if isSystemdResolvedRunning() {
-		return cleanupSystemdResolved()
+	return sys.cleanup()
+}
+
+// configure 按检测到的后端配置系统 DNS
+func (s *linuxSystem) configure(port int, zones []string) error {
+	backend := s.backend()
+	if want := backend.port(); port != want {
+		log.Printf("[DNS] 警告: %s 需要本地 DNS 监听 %d 端口（当前: %d）", backend, want, port)
+	}
+
+	switch backend {
+	case backendResolved:
+		return s.configureSystemdResolved(port, zones)
+	case backendDnsmasq:
+		return s.configureDnsmasq(port, zones)
+	case backendResolvconf:
+		return s.configureResolvconf()
+	case backendResolvFile:
+		return s.configureResolvFile()
+	}
+
+	log.Printf("[DNS] 未检测到可管理的 DNS 配置方式，请手动配置 DNS")
+	log.Printf("[DNS] 将 %s 域名指向 127.0.0.2:%d", strings.Join(zones, ", "), port)
+	return nil
+}
+
+// cleanup 清理所有后端留下的配置
+func (s *linuxSystem) cleanup() error {
+	var errs []string
+	for _, fn := range []func() error{
+		s.cleanupSystemdResolved,
+		s.cleanupDnsmasq,
+		s.cleanupResolvconf,
+		s.cleanupResolvFile,
+	} {
+		if err := fn(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("清理系统 DNS 配置失败: %s", strings.Join(errs, "; "))
 	}
 	return nil
 }
 
-// isSystemdResolvedRunning 检查 systemd-resolved 是否运行
-func isSystemdResolvedRunning() bool {
-	cmd := exec.Command("systemctl", "is-active", "--quiet", "systemd-resolved")
-	return cmd.Run() == nil
+// routingDomains 将域名后缀转换为 systemd-resolved 的路由域（~ 前缀表示只用于路由，不作为搜索域）
+func routingDomains(zones []string) []string {
+	domains := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		domains = append(domains, "~"+zone)
+	}
+	return domains
 }
 
 // configureSystemdResolved 通过 systemd-resolved 配置 DNS 转发
-// 创建 /etc/systemd/resolved.conf.d/beagle.conf 配置文件
-func configureSystemdResolved(port int) error {
-	confDir := "/etc/systemd/resolved.conf.d"
-	confFile := confDir + "/beagle.conf"
+// 创建 /etc/systemd/resolved.conf.d/beagle.conf 配置文件，所有后缀写在同一个文件中，清理时整体删除
+func (s *linuxSystem) configureSystemdResolved(port int, zones []string) error {
+	confDir := s.path(resolvedConfDir)
+	confFile := s.path(resolvedConfFile)
 
 	// 创建配置目录
 	if err := os.MkdirAll(confDir, 0755); err != nil {
 		// 权限不足时尝试 resolvectl 方式
 		log.Printf("[DNS] 创建 %s 失败: %v，尝试 resolvectl 方式", confDir, err)
-		return configureResolvectl(port)
+		return s.configureResolvectl(port, zones)
 	}
 
-	// 写入配置文件：将 ~beagle 域名路由到本地 DNS
+	// 写入配置文件：将 ~<zone> 域名路由到本地 DNS
 	// [Resolve] 段的 DNS 和 Domains 配置
-	content := fmt.Sprintf("[Resolve]\nDNS=127.0.0.2:%d\nDomains=~beagle\n", port)
+	content := fmt.Sprintf("[Resolve]\nDNS=127.0.0.2:%d\nDomains=%s\n", port, strings.Join(routingDomains(zones), " "))
 	if err := os.WriteFile(confFile, []byte(content), 0644); err != nil {
 		log.Printf("[DNS] 写入 %s 失败: %v，尝试 resolvectl 方式", confFile, err)
-		return configureResolvectl(port)
+		return s.configureResolvectl(port, zones)
 	}
 
 	// 重启 systemd-resolved 使配置生效
-	cmd := exec.Command("systemctl", "restart", "systemd-resolved")
-	if output, err := cmd.CombinedOutput(); err != nil {
+	if output, err := s.run("", "systemctl", "restart", "systemd-resolved"); err != nil {
 		log.Printf("[DNS] 重启 systemd-resolved 失败: %v, 输出: %s", err, string(output))
 		// 不返回错误，配置文件已写入，下次重启会生效
 	}
 
-	log.Printf("[DNS] Linux DNS 配置已写入: %s (.beagle → 127.0.0.2:%d)", confFile, port)
+	log.Printf("[DNS] Linux DNS 配置已写入: %s (%s → 127.0.0.2:%d)", confFile, strings.Join(zones, ", "), port)
 	return nil
 }
 
 // configureResolvectl 通过 resolvectl 命令配置 DNS（无需 root 写文件权限）
-func configureResolvectl(port int) error {
+func (s *linuxSystem) configureResolvectl(port int, zones []string) error {
 	// 查找默认网络接口
-	iface := getDefaultInterface()
+	iface := s.defaultInterface()
 	if iface == "" {
 		log.Printf("[DNS] 未找到默认网络接口，请手动配置 DNS")
 		return fmt.Errorf("未找到默认网络接口")
 	}
 
 	// 设置 DNS 路由域名
-	cmd := exec.Command("resolvectl", "domain", iface, "~beagle")
-	if output, err := cmd.CombinedOutput(); err != nil {
+	if output, err := s.run("", "resolvectl", append([]string{"domain", iface}, routingDomains(zones)...)...); err != nil {
 		return fmt.Errorf("resolvectl domain 失败: %w, 输出: %s", err, string(output))
 	}
 
 	// 设置 DNS 服务器
 	dnsAddr := fmt.Sprintf("127.0.0.2:%d", port)
-	cmd = exec.Command("resolvectl", "dns", iface, dnsAddr)
-	if output, err := cmd.CombinedOutput(); err != nil {
+	if output, err := s.run("", "resolvectl", "dns", iface, dnsAddr); err != nil {
 		return fmt.Errorf("resolvectl dns 失败: %w, 输出: %s", err, string(output))
 	}
 
-	log.Printf("[DNS] Linux DNS 已通过 resolvectl 配置: %s (.beagle → %s)", iface, dnsAddr)
+	log.Printf("[DNS] Linux DNS 已通过 resolvectl 配置: %s (%s → %s)", iface, strings.Join(zones, ", "), dnsAddr)
 	return nil
 }
 
-// cleanupSystemdResolved 清理 systemd-resolved 配置
-func cleanupSystemdResolved() error {
-	confFile := "/etc/systemd/resolved.conf.d/beagle.conf"
+// cleanupSystemdResolved 清理 systemd-resolved 配置，配置文件不存在时不重启服务
+func (s *linuxSystem) cleanupSystemdResolved() error {
+	confFile := s.path(resolvedConfFile)
 
-	if err := os.Remove(confFile); err != nil && !os.IsNotExist(err) {
+	if err := os.Remove(confFile); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
 		log.Printf("[DNS] 删除 %s 失败: %v", confFile, err)
 		// 不返回错误，尝试继续清理
 	}
 
 	// 重启 systemd-resolved
-	cmd := exec.Command("systemctl", "restart", "systemd-resolved")
-	if output, err := cmd.CombinedOutput(); err != nil {
+	if output, err := s.run("", "systemctl", "restart", "systemd-resolved"); err != nil {
 		log.Printf("[DNS] 重启 systemd-resolved 失败: %v, 输出: %s", err, string(output))
 	}
 
-	log.Printf("[DNS] Linux DNS 配置已清理")
+	log.Printf("[DNS] systemd-resolved DNS 配置已清理")
 	return nil
 }
 
-// getDefaultInterface 获取默认网络接口名称
-func getDefaultInterface() string {
+// configureDnsmasq 为 NetworkManager 内置的 dnsmasq 添加按后缀转发的配置
+func (s *linuxSystem) configureDnsmasq(port int, zones []string) error {
+	var b strings.Builder
+	b.WriteString(linuxConfigHeader)
+	for _, zone := range zones {
+		fmt.Fprintf(&b, "server=/%s/127.0.0.2#%d\n", zone, port)
+	}
+
+	if err := os.MkdirAll(s.path(dnsmasqConfDir), 0755); err != nil {
+		return fmt.Errorf("创建 %s 失败: %w", dnsmasqConfDir, err)
+	}
+	confFile := s.path(dnsmasqConfFile)
+	if err := os.WriteFile(confFile, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", confFile, err)
+	}
+
+	// 重新加载 NetworkManager，使其重启 dnsmasq 并读取新配置
+	if output, err := s.run("", "nmcli", "general", "reload"); err != nil {
+		log.Printf("[DNS] 重新加载 NetworkManager 失败: %v, 输出: %s", err, string(output))
+	}
+
+	log.Printf("[DNS] NetworkManager dnsmasq 配置已写入: %s (%s → 127.0.0.2:%d)", confFile, strings.Join(zones, ", "), port)
+	return nil
+}
+
+// cleanupDnsmasq 删除 dnsmasq 配置并重新加载 NetworkManager
+func (s *linuxSystem) cleanupDnsmasq() error {
+	confFile := s.path(dnsmasqConfFile)
+	if err := os.Remove(confFile); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("删除 %s 失败: %w", confFile, err)
+	}
+
+	if output, err := s.run("", "nmcli", "general", "reload"); err != nil {
+		log.Printf("[DNS] 重新加载 NetworkManager 失败: %v, 输出: %s", err, string(output))
+	}
+
+	log.Printf("[DNS] NetworkManager dnsmasq 配置已清理")
+	return nil
+}
+
+// configureResolvconf 通过 resolvconf 添加本地 DNS 接口记录
+// resolvconf 会把该记录合并进生成的 /etc/resolv.conf，lo 前缀的接口排在最前面
+func (s *linuxSystem) configureResolvconf() error {
+	record := linuxConfigHeader + "nameserver 127.0.0.2\n"
+	if output, err := s.run(record, "resolvconf", "-a", resolvconfIface); err != nil {
+		return fmt.Errorf("resolvconf -a 失败: %w, 输出: %s", err, string(output))
+	}
+
+	log.Printf("[DNS] resolvconf 接口记录已添加: %s → 127.0.0.2:53", resolvconfIface)
+	return nil
+}
+
+// cleanupResolvconf 删除 resolvconf 接口记录
+// openresolv 记录在 /run/resolvconf/interfaces，Debian resolvconf 记录在 /run/resolvconf/interface
+func (s *linuxSystem) cleanupResolvconf() error {
+	exists := false
+	for _, dir := range []string{"/run/resolvconf/interfaces", "/run/resolvconf/interface"} {
+		if _, err := os.Stat(filepath.Join(s.path(dir), resolvconfIface)); err == nil {
+			exists = true
+		}
+	}
+	if !exists {
+		return nil
+	}
+
+	if output, err := s.run("", "resolvconf", "-d", resolvconfIface); err != nil {
+		return fmt.Errorf("resolvconf -d 失败: %w, 输出: %s", err, string(output))
+	}
+
+	log.Printf("[DNS] resolvconf 接口记录已删除: %s", resolvconfIface)
+	return nil
+}
+
+// configureResolvFile 在 /etc/resolv.conf 开头插入受管理的 nameserver 块
+// 首次修改前把原文件备份到 /etc/resolv.conf.signal-desktop.bak，已有受管理块时先替换
+func (s *linuxSystem) configureResolvFile() error {
+	path := s.path(resolvConfFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败: %w", resolvConfFile, err)
+	}
+
+	original := removeResolvBlock(string(data))
+	backup := s.path(resolvConfBackup)
+	if _, err := os.Stat(backup); os.IsNotExist(err) {
+		if err := os.WriteFile(backup, []byte(original), 0644); err != nil {
+			return fmt.Errorf("备份 %s 失败: %w", resolvConfFile, err)
+		}
+	}
+
+	block := resolvBlockStart + "\nnameserver 127.0.0.2\n" + resolvBlockEnd + "\n"
+	if err := os.WriteFile(path, []byte(block+original), 0644); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", resolvConfFile, err)
+	}
+
+	log.Printf("[DNS] %s 已添加本地 DNS（备份: %s）", resolvConfFile, resolvConfBackup)
+	return nil
+}
+
+// cleanupResolvFile 删除 /etc/resolv.conf 中的受管理块和备份
+// 只删除受管理块，保留期间其他程序或用户对文件的修改；受管理块被改动（结束标记丢失）无法单独删除时，
+// 从备份恢复整个文件。恢复失败时保留备份
+func (s *linuxSystem) cleanupResolvFile() error {
+	path := s.path(resolvConfFile)
+	backup := s.path(resolvConfBackup)
+
+	data, err := os.ReadFile(path)
+	if err == nil && strings.Contains(string(data), resolvBlockStart) {
+		content := removeResolvBlock(string(data))
+		if strings.Contains(content, resolvBlockStart) {
+			saved, err := os.ReadFile(backup)
+			if err != nil {
+				return fmt.Errorf("%s 的受管理块已被改动，读取备份失败: %w", resolvConfFile, err)
+			}
+			log.Printf("[DNS] %s 的受管理块已被改动，从备份恢复", resolvConfFile)
+			content = string(saved)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("恢复 %s 失败（备份: %s）: %w", resolvConfFile, resolvConfBackup, err)
+		}
+		log.Printf("[DNS] %s 已移除本地 DNS", resolvConfFile)
+	}
+
+	if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		log.Printf("[DNS] 删除 %s 失败: %v", resolvConfBackup, err)
+	}
+	return nil
+}
+
+// removeResolvBlock 删除 resolv.conf 内容中的受管理块
+func removeResolvBlock(content string) string {
+	start := strings.Index(content, resolvBlockStart)
+	if start < 0 {
+		return content
+	}
+	end := strings.Index(content[start:], resolvBlockEnd)
+	if end < 0 {
+		return content
+	}
+	end += start + len(resolvBlockEnd)
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	return content[:start] + content[end:]
+}
+
+// defaultInterface 获取默认网络接口名称
+func (s *linuxSystem) defaultInterface() string {
 	// 通过 ip route 获取默认路由的接口
-	cmd := exec.Command("ip", "route", "show", "default")
-	output, err := cmd.Output()
+	output, err := s.run("", "ip", "route", "show", "default")
 	if err != nil {
 		return ""
 	}
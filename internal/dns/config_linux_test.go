@@ -0,0 +1,291 @@
+//go:build linux
+
+package dns
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSystem 以临时目录为根、记录执行命令的系统环境
+type fakeSystem struct {
+	*linuxSystem
+	commands []string        // 执行过的命令
+	active   map[string]bool // 运行中的 systemd 服务
+	binaries map[string]bool // 存在的命令
+}
+
+func newFakeSystem(t *testing.T) *fakeSystem {
+	f := &fakeSystem{active: map[string]bool{}, binaries: map[string]bool{}}
+	f.linuxSystem = &linuxSystem{
+		root: t.TempDir(),
+		run: func(stdin string, name string, args ...string) ([]byte, error) {
+			cmd := strings.Join(append([]string{name}, args...), " ")
+			if stdin != "" {
+				cmd += " <<< " + stdin
+			}
+			f.commands = append(f.commands, cmd)
+			if name == "systemctl" && args[0] == "is-active" && !f.active[args[len(args)-1]] {
+				return nil, errors.New("inactive")
+			}
+			return nil, nil
+		},
+		lookPath: func(file string) (string, error) {
+			if f.binaries[file] {
+				return "/usr/sbin/" + file, nil
+			}
+			return "", errors.New("not found")
+		},
+	}
+	return f
+}
+
+// write 在根目录下写入文件
+func (f *fakeSystem) write(t *testing.T, path, content string) {
+	t.Helper()
+	full := f.path(path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read 读取根目录下的文件，不存在时返回空字符串
+func (f *fakeSystem) read(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(f.path(path))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// ran 是否执行过以 prefix 开头的命令
+func (f *fakeSystem) ran(prefix string) bool {
+	for _, cmd := range f.commands {
+		if strings.HasPrefix(cmd, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDetectBackend(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, f *fakeSystem)
+		want  linuxBackend
+	}{
+		{"resolved", func(t *testing.T, f *fakeSystem) {
+			f.active["systemd-resolved"] = true
+			f.binaries["resolvconf"] = true
+		}, backendResolved},
+		{"dnsmasq", func(t *testing.T, f *fakeSystem) {
+			f.active["NetworkManager"] = true
+			f.write(t, nmConfFile, "[main]\nplugins=ifupdown\n")
+			f.write(t, nmConfDir+"/dns.conf", "[main]\ndns = dnsmasq\n")
+		}, backendDnsmasq},
+		{"dnsmasq overridden", func(t *testing.T, f *fakeSystem) {
+			f.active["NetworkManager"] = true
+			f.write(t, nmConfFile, "[main]\ndns=dnsmasq\n")
+			f.write(t, nmConfDir+"/99-dns.conf", "[main]\ndns=default\n")
+			f.write(t, resolvConfFile, "nameserver 10.0.0.1\n")
+		}, backendResolvFile},
+		{"dnsmasq without NetworkManager", func(t *testing.T, f *fakeSystem) {
+			f.write(t, nmConfFile, "[main]\ndns=dnsmasq\n")
+			f.binaries["resolvconf"] = true
+		}, backendResolvconf},
+		{"resolv.conf", func(t *testing.T, f *fakeSystem) {
+			f.write(t, resolvConfFile, "nameserver 10.0.0.1\n")
+		}, backendResolvFile},
+		{"resolv.conf symlink", func(t *testing.T, f *fakeSystem) {
+			f.write(t, "/run/resolv.conf", "nameserver 10.0.0.1\n")
+			if err := os.MkdirAll(f.path("/etc"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Symlink(f.path("/run/resolv.conf"), f.path(resolvConfFile)); err != nil {
+				t.Fatal(err)
+			}
+		}, backendNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeSystem(t)
+			tt.setup(t, f)
+			if got := f.detectBackend(); got != tt.want {
+				t.Errorf("detectBackend() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvedBackendDoesNotRegisterSearchDomains(t *testing.T) {
+	f := newFakeSystem(t)
+	f.active["systemd-resolved"] = true
+
+	// 只注册 ~ 路由域：搜索域会让 systemd-resolved 自己展开短名称，取第一个能解析的后缀，有歧义也不会报告
+	if err := f.configure(5353, []string{"beagle"}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	want := "[Resolve]\nDNS=127.0.0.2:5353\nDomains=~beagle\n"
+	if got := f.read(t, resolvedConfFile); got != want {
+		t.Errorf("resolved conf = %q, want %q", got, want)
+	}
+	if !f.ran("systemctl restart systemd-resolved") {
+		t.Errorf("systemd-resolved not restarted: %v", f.commands)
+	}
+}
+
+func TestDnsmasqBackend(t *testing.T) {
+	f := newFakeSystem(t)
+	f.active["NetworkManager"] = true
+	f.write(t, nmConfFile, "[main]\ndns=dnsmasq\n")
+
+	if err := f.configure(5353, []string{"beagle", "corp.internal"}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	want := linuxConfigHeader + "server=/beagle/127.0.0.2#5353\nserver=/corp.internal/127.0.0.2#5353\n"
+	if got := f.read(t, dnsmasqConfFile); got != want {
+		t.Errorf("dnsmasq conf = %q, want %q", got, want)
+	}
+	if !f.ran("nmcli general reload") {
+		t.Errorf("NetworkManager not reloaded: %v", f.commands)
+	}
+
+	f.commands = nil
+	if err := f.cleanup(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if _, err := os.Stat(f.path(dnsmasqConfFile)); !os.IsNotExist(err) {
+		t.Errorf("dnsmasq conf not removed: %v", err)
+	}
+	if !f.ran("nmcli general reload") {
+		t.Errorf("NetworkManager not reloaded on cleanup: %v", f.commands)
+	}
+}
+
+func TestResolvconfBackend(t *testing.T) {
+	f := newFakeSystem(t)
+	f.binaries["resolvconf"] = true
+
+	if err := f.configure(53, []string{"beagle"}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	if !f.ran("resolvconf -a " + resolvconfIface + " <<< " + linuxConfigHeader + "nameserver 127.0.0.2\n") {
+		t.Errorf("resolvconf record not added: %v", f.commands)
+	}
+
+	// 记录不存在时清理不执行 resolvconf -d
+	f.commands = nil
+	if err := f.cleanup(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if f.ran("resolvconf -d") {
+		t.Errorf("unexpected resolvconf -d without record: %v", f.commands)
+	}
+
+	f.write(t, "/run/resolvconf/interface/"+resolvconfIface, "nameserver 127.0.0.2\n")
+	if err := f.cleanup(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if !f.ran("resolvconf -d " + resolvconfIface) {
+		t.Errorf("resolvconf record not removed: %v", f.commands)
+	}
+}
+
+func TestResolvFileBackend(t *testing.T) {
+	f := newFakeSystem(t)
+	original := "search example.com\nnameserver 10.0.0.1\n"
+	f.write(t, resolvConfFile, original)
+
+	// 重复配置只保留一个受管理块，备份保持原始内容
+	for i := 0; i < 2; i++ {
+		if err := f.configure(53, []string{"beagle"}); err != nil {
+			t.Fatalf("configure: %v", err)
+		}
+	}
+	got := f.read(t, resolvConfFile)
+	want := resolvBlockStart + "\nnameserver 127.0.0.2\n" + resolvBlockEnd + "\n" + original
+	if got != want {
+		t.Errorf("resolv.conf = %q, want %q", got, want)
+	}
+	if backup := f.read(t, resolvConfBackup); backup != original {
+		t.Errorf("backup = %q, want %q", backup, original)
+	}
+
+	// 本地 DNS 自身不作为上游
+	prev := sys
+	sys = f.linuxSystem
+	resolvers := SystemResolvers()
+	sys = prev
+	if len(resolvers) != 1 || resolvers[0] != "10.0.0.1:53" {
+		t.Errorf("SystemResolvers() = %v, want [10.0.0.1:53]", resolvers)
+	}
+
+	// 清理只删除受管理块，保留期间追加的内容
+	f.write(t, resolvConfFile, got+"options edns0\n")
+	if err := f.cleanup(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if got := f.read(t, resolvConfFile); got != original+"options edns0\n" {
+		t.Errorf("resolv.conf after cleanup = %q", got)
+	}
+	if _, err := os.Stat(f.path(resolvConfBackup)); !os.IsNotExist(err) {
+		t.Errorf("backup not removed: %v", err)
+	}
+}
+
+func TestResolvFileCleanupRestoresBackupWhenBlockAltered(t *testing.T) {
+	f := newFakeSystem(t)
+	original := "nameserver 10.0.0.1\n"
+	f.write(t, resolvConfFile, original)
+	if err := f.configure(53, []string{"beagle"}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+
+	// 结束标记被其他程序删掉，受管理块无法单独删除
+	f.write(t, resolvConfFile, resolvBlockStart+"\nnameserver 127.0.0.2\n"+original)
+	if err := f.cleanup(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if got := f.read(t, resolvConfFile); got != original {
+		t.Errorf("resolv.conf after cleanup = %q, want the backup %q", got, original)
+	}
+	if _, err := os.Stat(f.path(resolvConfBackup)); !os.IsNotExist(err) {
+		t.Errorf("backup not removed after restoring: %v", err)
+	}
+}
+
+func TestBackendDetectedOnce(t *testing.T) {
+	f := newFakeSystem(t)
+	f.active["systemd-resolved"] = true
+	for i := 0; i < 3; i++ {
+		if port := f.backend().port(); port != 5353 {
+			t.Fatalf("port = %d, want 5353", port)
+		}
+	}
+	detections := 0
+	for _, cmd := range f.commands {
+		if strings.HasPrefix(cmd, "systemctl is-active") {
+			detections++
+		}
+	}
+	if detections != 1 {
+		t.Errorf("backend detected %d times, want once: %v", detections, f.commands)
+	}
+}
+
+func TestCleanupWithoutConfig(t *testing.T) {
+	f := newFakeSystem(t)
+	if err := f.cleanup(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if len(f.commands) != 0 {
+		t.Errorf("unexpected commands: %v", f.commands)
+	}
+}
@@ -2,7 +2,11 @@
 
 package dns
 
-import "log"
+import (
+	"log"
+	"os"
+	"strings"
+)
 
 // RecommendedListenAddr 返回默认平台推荐的 DNS 监听地址
 func RecommendedListenAddr() string {
@@ -14,10 +18,19 @@ func RecommendedPort() int {
 	return 53
 }
 
+// SystemResolvers 返回系统原有的上游 DNS
+func SystemResolvers() []string {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	return parseResolvConf(data, "127.0.0.2")
+}
+
 // ConfigureSystemDNS 配置系统 DNS（Linux 平台暂不实现）
 // Linux 的 DNS 劫持在 P2 阶段实现（systemd-resolved 或 /etc/resolv.conf）
-func ConfigureSystemDNS(port int) error {
-	log.Printf("[DNS] Linux 平台暂不支持自动 DNS 配置，请手动将 .beagle 域名指向 127.0.0.2:%d", port)
+func ConfigureSystemDNS(port int, zones []string) error {
+	log.Printf("[DNS] Linux 平台暂不支持自动 DNS 配置，请手动将 %s 域名指向 127.0.0.2:%d", strings.Join(zones, ", "), port)
 	log.Printf("[DNS] 或者使用 IP 地址直接连接 Agent")
 	return nil
 }
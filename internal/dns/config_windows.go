@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
+	"net"
 	"os/exec"
 	"strings"
 	"syscall"
@@ -30,32 +31,59 @@ func RecommendedPort() int {
 	return 53
 }
 
+// SystemResolvers 返回各网卡上配置的 DNS 服务器，需在 ConfigureSystemDNS 之前调用
+// NRPT 只把内部域名交给本地 DNS，这里的列表用于转发其他域名
+func SystemResolvers() []string {
+	psCmd := `Get-DnsClientServerAddress -AddressFamily IPv4 | ForEach-Object { $_.ServerAddresses }`
+	encodedCmd := encodeCommandForPowerShell(psCmd)
+
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-WindowStyle", "Hidden", "-EncodedCommand", encodedCmd)
+	cmd.SysProcAttr = hiddenProcAttr
+	output, err := cmd.Output()
+	if err != nil {
+		log.Printf("[DNS] 获取系统 DNS 服务器失败: %v", err)
+		return nil
+	}
+
+	var servers []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		ip := strings.TrimSpace(line)
+		if net.ParseIP(ip) == nil || ip == "127.0.0.2" || seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		servers = append(servers, net.JoinHostPort(ip, "53"))
+	}
+	return servers
+}
+
+// nrptComment NRPT 规则的标记，用于清理时识别由 Signal Desktop 添加的规则
+const nrptComment = "Added by Signal Desktop"
+
 // ConfigureSystemDNS 配置 Windows 系统 DNS
-// 使用 NRPT (Name Resolution Policy Table) 将 .beagle 域名指向本地 DNS 服务器
+// 使用 NRPT (Name Resolution Policy Table) 将内部域名后缀（zones）指向本地 DNS 服务器，每个后缀一条规则
 // 注意：NRPT 的 NameServers 不支持自定义端口，Windows DNS 客户端固定向 53 端口发查询
 // 因此 Windows 上 DNS 服务器必须监听 127.0.0.1:53
 // 需要管理员权限
-func ConfigureSystemDNS(port int) error {
+func ConfigureSystemDNS(port int, zones []string) error {
 	if port != 53 {
 		log.Printf("[DNS] 警告: Windows NRPT 不支持自定义端口，DNS 服务器需监听 53 端口（当前: %d）", port)
 		log.Printf("[DNS] 请确保 DNS 服务器监听在 127.0.0.2:53，或手动配置 DNS")
 	}
 
-	// 检查并删除已存在的 NRPT 规则
-	exists, err := checkNRPTRuleExists()
-	if err != nil {
-		log.Printf("[DNS] 检查 NRPT 规则失败: %v", err)
-	}
-
-	if exists {
-		if err := removeNRPTRule(); err != nil {
-			log.Printf("[DNS] 删除旧 NRPT 规则失败: %v", err)
-		}
+	// 删除已存在的 NRPT 规则（包括上次运行留下的、后缀已变化的规则）
+	if err := removeNRPTRule(); err != nil {
+		log.Printf("[DNS] 删除旧 NRPT 规则失败: %v", err)
 	}
 
 	// 添加新的 NRPT 规则
 	// 使用 -NameServers 参数（非 DirectAccess 模式），不需要布尔参数，避免 $true 转义问题
-	psCmd := `Add-DnsClientNrptRule -Namespace ".beagle" -NameServers "127.0.0.2"`
+	var cmds []string
+	for _, zone := range zones {
+		cmds = append(cmds, fmt.Sprintf(`Add-DnsClientNrptRule -Namespace ".%s" -NameServers "127.0.0.2" -Comment "%s"`, zone, nrptComment))
+	}
+	psCmd := strings.Join(cmds, "; ")
 
 	// 使用 Base64 编码执行，彻底避免参数解析问题
 	encodedCmd := encodeCommandForPowerShell(psCmd)
@@ -67,7 +95,7 @@ func ConfigureSystemDNS(port int) error {
 		return fmt.Errorf("添加 NRPT 规则失败（需要管理员权限）: %w\n输出: %s", err, string(output))
 	}
 
-	log.Printf("[DNS] Windows NRPT 规则已添加: .beagle → 127.0.0.2:53")
+	log.Printf("[DNS] Windows NRPT 规则已添加: %s → 127.0.0.2:53", strings.Join(zones, ", "))
 	return nil
 }
 
@@ -76,28 +104,11 @@ func CleanupSystemDNS() error {
 	return removeNRPTRule()
 }
 
-// checkNRPTRuleExists 检查 NRPT 规则是否存在
-func checkNRPTRuleExists() (bool, error) {
-	// 使用 Base64 编码避免 $_ 等特殊字符的转义问题
-	psCmd := `Get-DnsClientNrptRule | Where-Object { $_.Namespace -eq ".beagle" }`
-	encodedCmd := encodeCommandForPowerShell(psCmd)
-
-	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-WindowStyle", "Hidden", "-EncodedCommand", encodedCmd)
-	cmd.SysProcAttr = hiddenProcAttr
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// 没有规则时可能返回错误，这是正常的
-		return false, nil
-	}
-
-	// 输出不为空说明规则存在
-	return len(strings.TrimSpace(string(output))) > 0, nil
-}
-
-// removeNRPTRule 删除 NRPT 规则
+// removeNRPTRule 删除由 Signal Desktop 添加的 NRPT 规则
+// 按标记识别；旧版本添加的 .beagle 规则没有标记，按命名空间识别
 func removeNRPTRule() error {
 	// 使用 Base64 编码避免 $_ 等特殊字符的转义问题
-	psCmd := `Get-DnsClientNrptRule | Where-Object { $_.Namespace -eq ".beagle" } | Remove-DnsClientNrptRule -Force`
+	psCmd := fmt.Sprintf(`Get-DnsClientNrptRule | Where-Object { $_.Comment -eq "%s" -or $_.Namespace -eq ".beagle" } | Remove-DnsClientNrptRule -Force`, nrptComment)
 	encodedCmd := encodeCommandForPowerShell(psCmd)
 
 	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-WindowStyle", "Hidden", "-EncodedCommand", encodedCmd)
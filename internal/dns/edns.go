@@ -0,0 +1,61 @@
+package dns
+
+// edns.go 处理 EDNS0（RFC 6891）和 UDP 截断
+// 查询携带 OPT 时，响应也必须携带 OPT，并按客户端通告的缓冲区大小决定是否截断；
+// OPT 记录的解析和编码见 message.go
+
+// udpPayloadLimit 返回 UDP 响应的大小上限
+// 无 EDNS0 时为 512 字节，否则取客户端通告的大小（不低于 512）
+func udpPayloadLimit(query []byte) int {
+	m, err := parseMessage(query)
+	if err != nil || m.edns == nil || int(m.edns.udpSize) < maxUDPSize {
+		return maxUDPSize
+	}
+	return int(m.edns.udpSize)
+}
+
+// buildDNSTruncated 构建截断响应：保留原响应的标志位和响应码并设置 TC，只携带问题段（和 OPT）
+// 原响应可能来自上游且无法完整解析，只读取其报文头
+func buildDNSTruncated(query, full []byte) []byte {
+	q, err := parseMessage(query)
+	if err != nil {
+		return nil
+	}
+	h, err := parseHeader(full)
+	if err != nil {
+		return nil
+	}
+	resp := q.reply(h.rcode, h.authoritative)
+	resp.setFlags(h.flags())
+	resp.id = q.id
+	return resp.truncate().pack()
+}
+
+// checkQuery 校验本地处理的查询，不能处理时返回应答的错误响应，查询本身是响应时返回 nil 且 ok 为 false
+//   - 操作码不是 QUERY：NOTIMP
+//   - 问题数不为 1：FORMERR（RFC 9619）
+//   - EDNS 版本不为 0：BADVERS（RFC 6891 6.1.3）
+func checkQuery(q *message) (resp *message, ok bool) {
+	switch {
+	case q.response:
+		return nil, false
+	case q.opcode != opcodeQuery:
+		return q.reply(rcodeNotImplemented, false), false
+	case len(q.questions) != 1:
+		return q.reply(rcodeFormatError, false), false
+	case q.edns != nil && q.edns.version != 0:
+		return q.reply(rcodeBadVersion, false), false
+	}
+	return nil, true
+}
+
+// buildDNSFormatError 为无法解析的查询构建只含报文头的 FORMERR 响应（RFC 1035 4.1.1）
+// 报文不足 12 字节或本身是响应时返回 nil（丢弃）
+func buildDNSFormatError(packet []byte) []byte {
+	h, err := parseHeader(packet)
+	if err != nil || h.response {
+		return nil
+	}
+	q := &message{header: h}
+	return q.reply(rcodeFormatError, false).pack()
+}
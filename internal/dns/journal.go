@@ -0,0 +1,158 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// journal.go 查询日志：记录最近的 DNS 查询及处理结果，用于排查"域名解析卡住"等问题
+// 日志只保存在内存中，超过容量时覆盖最早的记录
+
+// defaultJournalSize 查询日志最多保留的条数
+const defaultJournalSize = 1000
+
+// 查询结果分类
+const (
+	OutcomeLocal     = "local"     // 本地应答（VIP、SRV、TXT、PTR）
+	OutcomeNXDomain  = "nxdomain"  // 内部域名未注册或被 Server 拒绝
+	OutcomeNoData    = "nodata"    // 内部域名存在，但没有所查询类型的记录
+	OutcomeForwarded = "forwarded" // 转发到上游
+	OutcomeCached    = "cached"    // 上游应答缓存命中
+	OutcomeServFail  = "servfail"  // 上游全部失败
+	OutcomeOverride  = "override"  // 用户自定义覆盖
+	OutcomeSearch    = "search"    // 短名称按搜索后缀展开
+	OutcomeAmbiguous = "ambiguous" // 短名称匹配多个内部域名
+)
+
+// QueryLogEntry 一条查询日志
+type QueryLogEntry struct {
+	Time      time.Time `json:"time"`             // 收到查询的时间
+	Client    string    `json:"client"`           // 客户端地址
+	Protocol  string    `json:"protocol"`         // udp / tcp
+	Name      string    `json:"name"`             // 查询域名（不含末尾点）
+	Type      string    `json:"type"`             // 查询类型（A、AAAA、SRV ...）
+	Outcome   string    `json:"outcome"`          // 处理结果，见 Outcome* 常量
+	Answer    string    `json:"answer,omitempty"` // 本地应答的 VIP（反向查询、别名、短名称为域名）
+	Error     string    `json:"error,omitempty"`  // 失败原因
+	LatencyMs float64   `json:"latency_ms"`       // 处理耗时（毫秒）
+}
+
+// QueryLogFilter 查询日志过滤条件，字段为空表示不过滤
+type QueryLogFilter struct {
+	Name    string // 域名包含该字符串（不区分大小写）
+	Outcome string // 处理结果
+	Limit   int    // 最多返回条数，0 表示不限制
+}
+
+// journal 固定容量的环形查询日志
+type journal struct {
+	entries []*QueryLogEntry
+	next    int  // 下一条写入的位置
+	full    bool // 是否已写满一轮
+
+	observer func(*QueryLogEntry) // 新日志回调（推送到前端），可为空
+
+	mu sync.Mutex
+}
+
+// newJournal 创建查询日志
+func newJournal(capacity int) *journal {
+	return &journal{entries: make([]*QueryLogEntry, capacity)}
+}
+
+// add 追加一条日志
+func (j *journal) add(entry *QueryLogEntry) {
+	j.mu.Lock()
+	j.entries[j.next] = entry
+	j.next = (j.next + 1) % len(j.entries)
+	if j.next == 0 {
+		j.full = true
+	}
+	observer := j.observer
+	j.mu.Unlock()
+
+	if observer != nil {
+		observer(entry)
+	}
+}
+
+// list 按时间倒序返回符合条件的日志
+func (j *journal) list(filter QueryLogFilter) []*QueryLogEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	count := j.next
+	if j.full {
+		count = len(j.entries)
+	}
+
+	name := strings.ToLower(filter.Name)
+	result := make([]*QueryLogEntry, 0)
+	for i := 0; i < count; i++ {
+		entry := j.entries[(j.next-1-i+len(j.entries))%len(j.entries)]
+		if name != "" && !strings.Contains(strings.ToLower(entry.Name), name) {
+			continue
+		}
+		if filter.Outcome != "" && entry.Outcome != filter.Outcome {
+			continue
+		}
+		result = append(result, entry)
+		if filter.Limit > 0 && len(result) >= filter.Limit {
+			break
+		}
+	}
+	return result
+}
+
+// clear 清空日志
+func (j *journal) clear() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = make([]*QueryLogEntry, len(j.entries))
+	j.next = 0
+	j.full = false
+}
+
+// QueryLog 返回最近的查询日志（按时间倒序）
+func (s *Server) QueryLog(filter QueryLogFilter) []*QueryLogEntry {
+	return s.journal.list(filter)
+}
+
+// ClearQueryLog 清空查询日志
+func (s *Server) ClearQueryLog() {
+	s.journal.clear()
+}
+
+// SetQueryObserver 设置新查询日志的回调（用于实时推送到前端），传 nil 取消
+// 回调在处理查询的 goroutine 中同步执行，不应阻塞
+func (s *Server) SetQueryObserver(fn func(*QueryLogEntry)) {
+	s.journal.mu.Lock()
+	s.journal.observer = fn
+	s.journal.mu.Unlock()
+}
+
+// queryTypeNames 常见查询类型的名称
+var queryTypeNames = map[uint16]string{
+	dnsTypeA:     "A",
+	2:            "NS",
+	dnsTypeCNAME: "CNAME",
+	dnsTypeSOA:   "SOA",
+	dnsTypePTR:   "PTR",
+	15:           "MX",
+	dnsTypeTXT:   "TXT",
+	dnsTypeAAAA:  "AAAA",
+	dnsTypeSRV:   "SRV",
+	64:           "SVCB",
+	65:           "HTTPS",
+	255:          "ANY",
+}
+
+// queryTypeName 返回查询类型的名称，未知类型按 RFC 3597 格式显示为 TYPEnnn
+func queryTypeName(qtype uint16) string {
+	if name, ok := queryTypeNames[qtype]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", qtype)
+}
@@ -0,0 +1,429 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// message.go DNS 报文模型（RFC 1035）：报文头、问题段、应答 / 授权 / 附加三个记录段和 EDNS0 OPT（RFC 6891）
+// 解析时展开名称压缩（包括 CNAME、PTR、SRV 等记录数据中的名称），校验各段计数和长度；
+// 构造时按名称压缩写出记录，OPT 记录由 edns 字段单独表示，总是写在附加段末尾
+
+// 操作码
+const opcodeQuery uint8 = 0
+
+// 响应码（RFC 1035 / RFC 6891），大于 15 的扩展响应码高 8 位由 OPT 记录携带
+const (
+	rcodeSuccess        uint16 = 0
+	rcodeFormatError    uint16 = 1
+	rcodeServerFailure  uint16 = 2
+	rcodeNameError      uint16 = 3
+	rcodeNotImplemented uint16 = 4
+	rcodeRefused        uint16 = 5
+	rcodeBadVersion     uint16 = 16
+)
+
+// classINET IN 类别
+const classINET uint16 = 1
+
+// maxNameLength 域名线路格式的最大长度（RFC 1035 2.3.4）
+const maxNameLength = 255
+
+// dnsTypeNS / dnsTypeMX 记录数据中含有域名的记录类型（解析时展开压缩）
+const (
+	dnsTypeNS uint16 = 2
+	dnsTypeMX uint16 = 15
+)
+
+// errMessageTooShort 报文不足 12 字节的报文头
+var errMessageTooShort = errors.New("报文太短")
+
+// header DNS 报文头（不含四个计数字段，计数由各段长度决定）
+type header struct {
+	id                 uint16
+	response           bool
+	opcode             uint8
+	authoritative      bool
+	truncated          bool
+	recursionDesired   bool
+	recursionAvailable bool
+	authenticData      bool
+	checkingDisabled   bool
+	rcode              uint16 // 完整响应码，包括 OPT 携带的扩展高位
+}
+
+// flags 返回报文头第 3、4 字节（只含响应码低 4 位）
+func (h *header) flags() uint16 {
+	f := uint16(h.opcode&0x0f)<<11 | h.rcode&0x0f
+	for _, bit := range []struct {
+		set  bool
+		mask uint16
+	}{
+		{h.response, 0x8000},
+		{h.authoritative, 0x0400},
+		{h.truncated, 0x0200},
+		{h.recursionDesired, 0x0100},
+		{h.recursionAvailable, 0x0080},
+		{h.authenticData, 0x0020},
+		{h.checkingDisabled, 0x0010},
+	} {
+		if bit.set {
+			f |= bit.mask
+		}
+	}
+	return f
+}
+
+// setFlags 从报文头第 3、4 字节设置标志位和响应码低 4 位
+func (h *header) setFlags(f uint16) {
+	h.response = f&0x8000 != 0
+	h.opcode = uint8(f>>11) & 0x0f
+	h.authoritative = f&0x0400 != 0
+	h.truncated = f&0x0200 != 0
+	h.recursionDesired = f&0x0100 != 0
+	h.recursionAvailable = f&0x0080 != 0
+	h.authenticData = f&0x0020 != 0
+	h.checkingDisabled = f&0x0010 != 0
+	h.rcode = h.rcode&^0x0f | f&0x0f
+}
+
+// parseHeader 解析报文头，用于只关心标志位的场景（如上游响应的 TC、RCODE）
+func parseHeader(b []byte) (header, error) {
+	var h header
+	if len(b) < 12 {
+		return h, errMessageTooShort
+	}
+	h.id = binary.BigEndian.Uint16(b[0:2])
+	h.setFlags(binary.BigEndian.Uint16(b[2:4]))
+	return h, nil
+}
+
+// question 问题段中的一个问题，名称不含末尾点
+type question struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+}
+
+// resource 一条资源记录，data 中的域名已展开为不压缩的线路格式
+type resource struct {
+	name  string
+	rtype uint16
+	class uint16
+	ttl   uint32
+	data  []byte
+}
+
+// localRecord 构造本地应答的记录（类别 IN，TTL 为 localTTL）
+func localRecord(name string, rtype uint16, data []byte) resource {
+	return resource{name: name, rtype: rtype, class: classINET, ttl: localTTL, data: data}
+}
+
+// edns EDNS0 OPT 伪记录（扩展响应码并入 header.rcode）
+type edns struct {
+	udpSize  uint16 // 发送方可接收的 UDP 报文大小
+	version  uint8
+	dnssecOK bool   // DO 标志
+	options  []byte // 原样保留的选项数据
+}
+
+// message 完整的 DNS 报文
+type message struct {
+	header
+	questions  []question
+	answers    []resource
+	authority  []resource
+	additional []resource // 不含 OPT 记录
+	edns       *edns
+}
+
+// parseMessage 解析 DNS 报文，各段计数与内容不符、名称越界或压缩指针非法时返回错误
+// 报文末尾多余的字节忽略
+func parseMessage(b []byte) (*message, error) {
+	h, err := parseHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	m := &message{header: h}
+
+	counts := []int{
+		int(binary.BigEndian.Uint16(b[6:8])),
+		int(binary.BigEndian.Uint16(b[8:10])),
+		int(binary.BigEndian.Uint16(b[10:12])),
+	}
+
+	questions, offset, err := readQuestions(b)
+	if err != nil {
+		return nil, err
+	}
+	m.questions = questions
+
+	sections := []*[]resource{&m.answers, &m.authority, &m.additional}
+	for s, count := range counts {
+		for i := 0; i < count; i++ {
+			rr, next, err := readResource(b, offset)
+			if err != nil {
+				return nil, fmt.Errorf("记录段 %d 第 %d 条: %w", s, i, err)
+			}
+			offset = next
+			if rr.rtype != dnsTypeOPT {
+				*sections[s] = append(*sections[s], rr)
+				continue
+			}
+			// OPT 只能出现在附加段，名称必须是根域，且最多一条
+			if s != 2 || rr.name != "" || m.edns != nil {
+				return nil, fmt.Errorf("非法的 OPT 记录")
+			}
+			m.edns = &edns{
+				udpSize:  rr.class,
+				version:  uint8(rr.ttl >> 16),
+				dnssecOK: rr.ttl&0x8000 != 0,
+				options:  rr.data,
+			}
+			m.rcode |= uint16(rr.ttl>>24) << 4
+		}
+	}
+	return m, nil
+}
+
+// readQuestions 读取报文头之后的问题段，返回问题列表和问题段之后的偏移
+// 调用方需保证报文不短于报文头
+func readQuestions(b []byte) ([]question, int, error) {
+	qdcount := int(binary.BigEndian.Uint16(b[4:6]))
+	var questions []question
+	offset := 12
+	for i := 0; i < qdcount; i++ {
+		name, next, err := readName(b, offset)
+		if err != nil {
+			return nil, 0, fmt.Errorf("问题 %d: %w", i, err)
+		}
+		if next+4 > len(b) {
+			return nil, 0, fmt.Errorf("问题 %d: 查询类型越界", i)
+		}
+		questions = append(questions, question{
+			name:   name,
+			qtype:  binary.BigEndian.Uint16(b[next : next+2]),
+			qclass: binary.BigEndian.Uint16(b[next+2 : next+4]),
+		})
+		offset = next + 4
+	}
+	return questions, offset, nil
+}
+
+// readName 读取 offset 处的域名（展开压缩指针），返回不含末尾点的名称和域名之后的偏移
+// 压缩指针只能指向之前出现的位置，避免指针循环
+func readName(b []byte, offset int) (string, int, error) {
+	var labels []string
+	length := 0
+	end := -1 // 遇到第一个压缩指针后，域名在原位置的结束偏移
+	limit := offset
+
+	for {
+		if offset >= len(b) {
+			return "", 0, fmt.Errorf("域名越界")
+		}
+		c := int(b[offset])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				if end < 0 {
+					end = offset + 1
+				}
+				return strings.Join(labels, "."), end, nil
+			}
+			if offset+1+c > len(b) {
+				return "", 0, fmt.Errorf("域名标签越界")
+			}
+			label := string(b[offset+1 : offset+1+c])
+			if strings.Contains(label, ".") {
+				return "", 0, fmt.Errorf("不支持包含点的标签: %q", label)
+			}
+			length += c + 1
+			if length+1 > maxNameLength {
+				return "", 0, fmt.Errorf("域名过长")
+			}
+			labels = append(labels, label)
+			offset += 1 + c
+		case 0xc0:
+			if offset+2 > len(b) {
+				return "", 0, fmt.Errorf("压缩指针越界")
+			}
+			ptr := int(binary.BigEndian.Uint16(b[offset:offset+2]) & 0x3fff)
+			if ptr >= limit {
+				return "", 0, fmt.Errorf("压缩指针必须指向之前的位置: %d", ptr)
+			}
+			if end < 0 {
+				end = offset + 2
+			}
+			offset, limit = ptr, ptr
+		default:
+			return "", 0, fmt.Errorf("不支持的标签类型: %#x", c)
+		}
+	}
+}
+
+// readResource 读取 offset 处的一条资源记录，返回记录和下一条记录的偏移
+func readResource(b []byte, offset int) (resource, int, error) {
+	var rr resource
+	name, next, err := readName(b, offset)
+	if err != nil {
+		return rr, 0, err
+	}
+	if next+10 > len(b) {
+		return rr, 0, fmt.Errorf("资源记录头越界")
+	}
+	rr.name = name
+	rr.rtype = binary.BigEndian.Uint16(b[next : next+2])
+	rr.class = binary.BigEndian.Uint16(b[next+2 : next+4])
+	rr.ttl = binary.BigEndian.Uint32(b[next+4 : next+8])
+	rdlength := int(binary.BigEndian.Uint16(b[next+8 : next+10]))
+	start := next + 10
+	if start+rdlength > len(b) {
+		return rr, 0, fmt.Errorf("资源记录数据越界")
+	}
+	data, err := expandRData(b, rr.rtype, start, start+rdlength)
+	if err != nil {
+		return rr, 0, err
+	}
+	rr.data = data
+	return rr, start + rdlength, nil
+}
+
+// expandRData 复制记录数据，并展开其中域名的压缩指针（压缩指针指向报文中的其他位置，脱离原报文后无法解析）
+func expandRData(b []byte, rtype uint16, start, end int) ([]byte, error) {
+	// prefix 域名之前的定长字段，names 域名个数
+	var prefix, names int
+	switch rtype {
+	case dnsTypeCNAME, dnsTypeNS, dnsTypePTR:
+		names = 1
+	case dnsTypeMX:
+		prefix, names = 2, 1
+	case dnsTypeSRV:
+		prefix, names = 6, 1
+	case dnsTypeSOA:
+		names = 2
+	default:
+		return append([]byte(nil), b[start:end]...), nil
+	}
+
+	if start+prefix > end {
+		return nil, fmt.Errorf("记录数据过短")
+	}
+	data := append([]byte(nil), b[start:start+prefix]...)
+	offset := start + prefix
+	for i := 0; i < names; i++ {
+		name, next, err := readName(b[:end], offset)
+		if err != nil {
+			return nil, fmt.Errorf("记录数据: %w", err)
+		}
+		data = append(data, encodeName(name)...)
+		offset = next
+	}
+	return append(data, b[offset:end]...), nil
+}
+
+// pack 将报文编码为线路格式，记录名称按 RFC 1035 4.1.4 压缩
+func (m *message) pack() []byte {
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:2], m.id)
+	binary.BigEndian.PutUint16(b[2:4], m.flags())
+	binary.BigEndian.PutUint16(b[4:6], uint16(len(m.questions)))
+	binary.BigEndian.PutUint16(b[6:8], uint16(len(m.answers)))
+	binary.BigEndian.PutUint16(b[8:10], uint16(len(m.authority)))
+	arcount := len(m.additional)
+	if m.edns != nil {
+		arcount++
+	}
+	binary.BigEndian.PutUint16(b[10:12], uint16(arcount))
+
+	names := make(map[string]int)
+	for _, q := range m.questions {
+		b = appendName(b, q.name, names)
+		b = binary.BigEndian.AppendUint16(b, q.qtype)
+		b = binary.BigEndian.AppendUint16(b, q.qclass)
+	}
+	for _, section := range [][]resource{m.answers, m.authority, m.additional} {
+		for _, rr := range section {
+			b = appendName(b, rr.name, names)
+			b = binary.BigEndian.AppendUint16(b, rr.rtype)
+			b = binary.BigEndian.AppendUint16(b, rr.class)
+			b = binary.BigEndian.AppendUint32(b, rr.ttl)
+			b = binary.BigEndian.AppendUint16(b, uint16(len(rr.data)))
+			b = append(b, rr.data...)
+		}
+	}
+	if e := m.edns; e != nil {
+		ttl := uint32(m.rcode>>4)<<24 | uint32(e.version)<<16
+		if e.dnssecOK {
+			ttl |= 0x8000
+		}
+		b = append(b, 0) // 名称：根域
+		b = binary.BigEndian.AppendUint16(b, dnsTypeOPT)
+		b = binary.BigEndian.AppendUint16(b, e.udpSize)
+		b = binary.BigEndian.AppendUint32(b, ttl)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(e.options)))
+		b = append(b, e.options...)
+	}
+	return b
+}
+
+// appendName 写入域名，已写过的后缀改用压缩指针；names 记录各后缀在报文中的偏移
+func appendName(b []byte, name string, names map[string]int) []byte {
+	for name != "" {
+		if ptr, ok := names[name]; ok {
+			return binary.BigEndian.AppendUint16(b, 0xc000|uint16(ptr))
+		}
+		if len(b) <= 0x3fff {
+			names[name] = len(b)
+		}
+		label, rest, _ := strings.Cut(name, ".")
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+		name = rest
+	}
+	return append(b, 0)
+}
+
+// encodeName 将域名编码为线路格式（不压缩），用于记录数据
+func encodeName(domain string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(domain, "."), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// reply 创建查询的响应：复制 ID、操作码、RD、CD 和问题段，设置 RA（本地 DNS 为客户端递归查询）
+// 查询携带 OPT 时响应也携带 OPT，通告本地的缓冲区大小并复制 DO 标志（RFC 3225）
+func (m *message) reply(rcode uint16, authoritative bool) *message {
+	r := &message{
+		header: header{
+			id:                 m.id,
+			response:           true,
+			opcode:             m.opcode,
+			authoritative:      authoritative,
+			recursionDesired:   m.recursionDesired,
+			recursionAvailable: true,
+			checkingDisabled:   m.checkingDisabled,
+			rcode:              rcode,
+		},
+		questions: append([]question(nil), m.questions...),
+	}
+	if m.edns != nil {
+		r.edns = &edns{udpSize: ednsUDPSize, dnssecOK: m.edns.dnssecOK}
+	}
+	return r
+}
+
+// truncate 返回只保留报文头、问题段和 OPT 并设置 TC 的副本（UDP 响应超出客户端缓冲区时使用）
+func (m *message) truncate() *message {
+	t := &message{header: m.header, questions: m.questions, edns: m.edns}
+	t.header.truncated = true
+	return t
+}
@@ -0,0 +1,234 @@
+package dns
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// rawHeader 构造报文头，counts 依次为 QDCOUNT、ANCOUNT、NSCOUNT、ARCOUNT
+func rawHeader(id uint16, flags uint16, counts ...uint16) []byte {
+	b := binary.BigEndian.AppendUint16(nil, id)
+	b = binary.BigEndian.AppendUint16(b, flags)
+	for i := 0; i < 4; i++ {
+		var c uint16
+		if i < len(counts) {
+			c = counts[i]
+		}
+		b = binary.BigEndian.AppendUint16(b, c)
+	}
+	return b
+}
+
+func TestParseMessageRejectsMalformedPackets(t *testing.T) {
+	question := append(encodeName("example.com"), 0, 1, 0, 1)
+	longName := make([]byte, 0, 300)
+	for i := 0; i < 5; i++ {
+		longName = append(longName, 63)
+		longName = append(longName, make([]byte, 63)...)
+	}
+	longName = append(longName, 0)
+
+	tests := []struct {
+		name   string
+		packet []byte
+	}{
+		{"short header", []byte{0, 1, 0, 0, 0, 1}},
+		{"question count exceeds packet", append(rawHeader(1, 0x0100, 2), question...)},
+		{"truncated question type", append(rawHeader(1, 0x0100, 1), encodeName("example.com")...)},
+		{"label overruns packet", append(rawHeader(1, 0x0100, 1), 10, 'a', 'b')},
+		{"pointer to itself", append(rawHeader(1, 0x0100, 1), 0xc0, 12, 0, 1, 0, 1)},
+		{"forward pointer", append(rawHeader(1, 0x0100, 1), 0xc0, 14, 0, 0, 1, 0, 1)},
+		{"reserved label type", append(rawHeader(1, 0x0100, 1), 0x40, 'a', 0, 0, 1, 0, 1)},
+		{"name too long", append(append(rawHeader(1, 0x0100, 1), longName...), 0, 1, 0, 1)},
+		{"label containing dot", append(rawHeader(1, 0x0100, 1), 3, 'a', '.', 'b', 0, 0, 1, 0, 1)},
+		{"rdlength exceeds packet", append(append(rawHeader(1, 0x8180, 1, 1), question...),
+			0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 8, 1, 2, 3, 4)},
+		{"OPT in answer section", append(append(rawHeader(1, 0x0100, 1, 1), question...),
+			0, 0, 41, 4, 0xd0, 0, 0, 0, 0, 0, 0)},
+		{"OPT with non-root name", append(append(rawHeader(1, 0x0100, 1, 0, 0, 1), question...),
+			0xc0, 12, 0, 41, 4, 0xd0, 0, 0, 0, 0, 0, 0)},
+		{"duplicate OPT", append(append(rawHeader(1, 0x0100, 1, 0, 0, 2), question...),
+			0, 0, 41, 4, 0xd0, 0, 0, 0, 0, 0, 0,
+			0, 0, 41, 4, 0xd0, 0, 0, 0, 0, 0, 0)},
+		{"compressed CNAME target out of range", append(append(rawHeader(1, 0x8180, 1, 1), question...),
+			0xc0, 12, 0, 5, 0, 1, 0, 0, 0, 60, 0, 2, 0xc0, 0xff)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m, err := parseMessage(tt.packet); err == nil {
+				t.Fatalf("expected parse error, got %+v", m)
+			}
+		})
+	}
+}
+
+func TestMessageRoundTripPreservesHeaderQuestionsAndOPT(t *testing.T) {
+	m := &message{
+		header: header{
+			id:                 0xbeef,
+			response:           true,
+			authoritative:      true,
+			recursionDesired:   true,
+			recursionAvailable: true,
+			checkingDisabled:   true,
+			rcode:              rcodeBadVersion,
+		},
+		questions: []question{
+			{name: "pg.yygl.beijing.beagle", qtype: dnsTypeA, qclass: classINET},
+			{name: "redis.beijing.beagle", qtype: dnsTypeAAAA, qclass: classINET},
+		},
+		answers: []resource{
+			localRecord("pg.yygl.beijing.beagle", dnsTypeCNAME, encodeName("redis.beijing.beagle")),
+			localRecord("redis.beijing.beagle", dnsTypeA, []byte{127, 1, 0, 3}),
+		},
+		additional: []resource{localRecord("beijing.beagle", dnsTypeTXT, []byte{2, 'o', 'k'})},
+		edns:       &edns{udpSize: 1232, dnssecOK: true, options: []byte{0, 10, 0, 0}},
+	}
+
+	packed := m.pack()
+	got, err := parseMessage(packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Fatalf("round trip mismatch:\n got %+v\nwant %+v", got, m)
+	}
+	// 第二个问题和应答记录的名称应压缩为指针
+	if len(packed) >= len(m.questions[0].name)+len(m.questions[1].name)+len(m.answers[0].name)*2+80 {
+		t.Fatalf("expected compressed names, packet is %d bytes", len(packed))
+	}
+	// 扩展响应码高位写在 OPT 中，报文头只保留低 4 位
+	if packed[3]&0x0f != byte(rcodeBadVersion&0x0f) {
+		t.Fatalf("unexpected header rcode %#x", packed[3])
+	}
+}
+
+func TestReplyCopiesQueryFlags(t *testing.T) {
+	query := buildQuery(7, "pg.yygl.beijing.beagle.", dnsTypeA)
+	query[3] |= 0x10 // CD=1
+	q, err := parseMessage(withOPT(query, 4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := q.reply(rcodeNameError, true)
+	if r.id != 7 || !r.response || !r.recursionDesired || !r.checkingDisabled || !r.recursionAvailable || !r.authoritative {
+		t.Fatalf("reply must copy ID, RD and CD and set QR, RA and AA: %+v", r.header)
+	}
+	if r.edns == nil || r.edns.udpSize != ednsUDPSize {
+		t.Fatalf("reply to an EDNS query must advertise %d, got %+v", ednsUDPSize, r.edns)
+	}
+
+	query[2] &^= 0x01 // RD=0
+	q, _ = parseMessage(query)
+	if r := q.reply(rcodeSuccess, false); r.recursionDesired || r.edns != nil {
+		t.Fatalf("reply must not set RD or OPT the query did not carry: %+v", r)
+	}
+}
+
+func TestAnswerToUnsupportedQueries(t *testing.T) {
+	server := newTestServer()
+	single := buildQuery(3, "pg.yygl.beijing.beagle.", dnsTypeA)
+
+	twoQuestions := append(rawHeader(3, 0x0100, 2), single[12:]...)
+	twoQuestions = append(twoQuestions, single[12:]...)
+
+	notify := append([]byte(nil), single...)
+	notify[2] = 0x20 // OPCODE=NOTIFY(4)
+
+	badVersion := withOPT(append([]byte(nil), single...), 1232)
+	badVersion[len(badVersion)-5] = 1 // EDNS 版本 1
+
+	response := append([]byte(nil), single...)
+	response[2] |= 0x80
+
+	tests := []struct {
+		name   string
+		packet []byte
+		rcode  uint16 // 0xffff 表示丢弃
+	}{
+		{"multiple questions", twoQuestions, rcodeFormatError},
+		{"unsupported opcode", notify, rcodeNotImplemented},
+		{"unsupported EDNS version", badVersion, rcodeBadVersion},
+		{"unparsable question", append(rawHeader(3, 0x0100, 1), 0xc0, 12), rcodeFormatError},
+		{"response packet", response, 0xffff},
+		{"short packet", single[:8], 0xffff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, entry := server.buildAnswer(tt.packet)
+			if entry != nil {
+				t.Fatal("rejected queries must not be logged as answered")
+			}
+			if tt.rcode == 0xffff {
+				if resp != nil {
+					t.Fatalf("expected packet to be dropped, got %x", resp)
+				}
+				return
+			}
+			m, err := parseMessage(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.id != 3 || !m.response || m.authoritative || m.rcode != tt.rcode {
+				t.Fatalf("expected rcode %d, got %+v", tt.rcode, m.header)
+			}
+		})
+	}
+}
+
+func TestAuthoritativeOnlyForLocalAnswers(t *testing.T) {
+	server := newTestServer()
+
+	local, _ := parseMessage(answerOf(server, buildQuery(1, "missing.beagle.", dnsTypeA)))
+	if local.rcode != rcodeNameError || !local.authoritative {
+		t.Fatalf("local NXDOMAIN must be authoritative: %+v", local.header)
+	}
+	// 没有可用上游时 SERVFAIL，不是权威应答
+	server.SetUpstreams([]string{deadUpstream(t)})
+	failed, _ := parseMessage(answerOf(server, buildQuery(2, "www.example.com.", dnsTypeA)))
+	if failed.rcode != rcodeServerFailure || failed.authoritative {
+		t.Fatalf("upstream failure must be non-authoritative SERVFAIL: %+v", failed.header)
+	}
+}
+
+func FuzzParseMessage(f *testing.F) {
+	f.Add(buildQuery(1, "pg.yygl.beijing.beagle.", dnsTypeA))
+	f.Add(withOPT(buildQuery(2, "example.com.", dnsTypeAAAA), 1232))
+	f.Add(answerOf(newTestServer(), buildQuery(3, "_5432._tcp.pg.yygl.beijing.beagle.", dnsTypeSRV)))
+	f.Add(append(rawHeader(4, 0x0100, 1), 0xc0, 12, 0, 1, 0, 1))
+
+	f.Fuzz(func(t *testing.T, packet []byte) {
+		m, err := parseMessage(packet)
+		if err != nil {
+			return
+		}
+		// 能解析的报文重新编码后必须得到相同的内容
+		again, err := parseMessage(m.pack())
+		if err != nil {
+			t.Fatalf("packed message does not parse: %v", err)
+		}
+		if !reflect.DeepEqual(again, m) {
+			t.Fatalf("round trip mismatch:\n got %+v\nwant %+v", again, m)
+		}
+	})
+}
+
+func FuzzBuildAnswer(f *testing.F) {
+	f.Add(buildQuery(1, "pg.yygl.beijing.beagle.", dnsTypeA))
+	f.Add(buildQuery(2, "3.0.1.127.in-addr.arpa.", dnsTypePTR))
+	f.Add(withOPT(buildQuery(3, "pg.yygl.beijing.beagle.", dnsTypeTXT), 1232))
+	server := newTestServer()
+	server.SetUpstreams([]string{deadUpstream(f)})
+
+	f.Fuzz(func(t *testing.T, packet []byte) {
+		resp, _ := server.buildAnswer(packet)
+		if resp == nil {
+			return
+		}
+		if _, err := parseMessage(resp); err != nil {
+			t.Fatalf("response does not parse: %v", err)
+		}
+	})
+}
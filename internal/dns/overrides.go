@@ -0,0 +1,411 @@
+package dns
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// overrides.go 用户自定义的本地 DNS 覆盖，优先于 Server 下发的内部域名解析
+//   - 别名（CNAME）：db → pg.yygl.beijing.beagle，目标为内部域名时附带 VIP，否则向上游查询目标并附带其地址
+//   - 静态地址（A）：test.beagle → 10.0.0.8，IPv6 地址应答 AAAA
+//   - 通配符：*.dev.beagle 匹配 dev.beagle 下任意子域名，精确名称优先，多个通配符取后缀最长者
+// 覆盖保存在应用目录的 JSON 文件中，文件被外部修改后自动重新加载
+
+// 覆盖类型
+const (
+	OverrideA     = "A"     // 静态地址
+	OverrideCNAME = "CNAME" // 别名
+)
+
+// dnsTypeCNAME CNAME 记录类型
+const dnsTypeCNAME uint16 = 5
+
+// 覆盖参数
+const (
+	overrideReloadInterval = 2 * time.Second // 检查覆盖文件变更的间隔
+	maxCNAMEChain          = 8               // 别名链最大长度，避免别名循环
+)
+
+// overrideNamePattern 覆盖名称：可选的 "*." 通配符前缀加一个或多个标签，允许不带后缀的短名称（db）
+var overrideNamePattern = regexp.MustCompile(`^(\*\.)?[a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9_])?(\.[a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9_])?)*$`)
+
+// Override 一条本地 DNS 覆盖
+type Override struct {
+	Name   string `json:"name"`   // 域名、短名称或通配符（*.dev.beagle）
+	Type   string `json:"type"`   // A / CNAME
+	Target string `json:"target"` // A 为 IP 地址，CNAME 为目标域名
+}
+
+// normalize 规范化并校验覆盖
+func (o *Override) normalize() error {
+	o.Name = strings.ToLower(strings.Trim(strings.TrimSpace(o.Name), "."))
+	o.Type = strings.ToUpper(strings.TrimSpace(o.Type))
+	o.Target = strings.TrimSpace(o.Target)
+
+	if !overrideNamePattern.MatchString(o.Name) {
+		return fmt.Errorf("无效的名称: %q", o.Name)
+	}
+	switch o.Type {
+	case OverrideA:
+		if net.ParseIP(o.Target) == nil {
+			return fmt.Errorf("无效的 IP 地址: %q", o.Target)
+		}
+	case OverrideCNAME:
+		o.Target = strings.ToLower(strings.Trim(o.Target, "."))
+		if strings.HasPrefix(o.Target, "*.") || !overrideNamePattern.MatchString(o.Target) {
+			return fmt.Errorf("无效的目标域名: %q", o.Target)
+		}
+		if o.Target == o.Name {
+			return fmt.Errorf("别名不能指向自身: %s", o.Name)
+		}
+	default:
+		return fmt.Errorf("不支持的覆盖类型: %q（支持 A、CNAME）", o.Type)
+	}
+	return nil
+}
+
+// matches 覆盖是否匹配域名，返回匹配的后缀长度（精确匹配为域名长度 + 1，优先于任何通配符）
+func (o *Override) matches(name string) (int, bool) {
+	if suffix, ok := strings.CutPrefix(o.Name, "*."); ok {
+		if strings.HasSuffix(name, "."+suffix) {
+			return len(suffix), true
+		}
+		return 0, false
+	}
+	if name == o.Name {
+		return len(name) + 1, true
+	}
+	return 0, false
+}
+
+// Overrides 保存在文件中的本地 DNS 覆盖列表
+type Overrides struct {
+	path    string
+	entries []*Override
+
+	// 上次加载时文件的状态，用于检测外部修改
+	modTime time.Time
+	size    int64
+
+	mu sync.RWMutex
+}
+
+// NewOverrides 从文件加载覆盖列表，文件不存在时为空列表（添加第一条时创建）
+func NewOverrides(path string) (*Overrides, error) {
+	o := &Overrides{path: path}
+	if _, err := o.reload(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// List 返回全部覆盖（按名称排序）
+func (o *Overrides) List() []*Override {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	result := make([]*Override, 0, len(o.entries))
+	for _, e := range o.entries {
+		entry := *e
+		result = append(result, &entry)
+	}
+	return result
+}
+
+// Add 添加覆盖，名称已存在时替换
+func (o *Overrides) Add(entry Override) error {
+	if err := entry.normalize(); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := make([]*Override, 0, len(o.entries)+1)
+	for _, e := range o.entries {
+		if e.Name != entry.Name {
+			entries = append(entries, e)
+		}
+	}
+	entries = append(entries, &entry)
+	if err := o.saveLocked(entries); err != nil {
+		return err
+	}
+	log.Printf("[DNS] 添加覆盖: %s %s %s", entry.Name, entry.Type, entry.Target)
+	return nil
+}
+
+// Remove 删除指定名称的覆盖
+func (o *Overrides) Remove(name string) error {
+	name = strings.ToLower(strings.Trim(strings.TrimSpace(name), "."))
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := make([]*Override, 0, len(o.entries))
+	for _, e := range o.entries {
+		if e.Name != name {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == len(o.entries) {
+		return fmt.Errorf("覆盖不存在: %s", name)
+	}
+	if err := o.saveLocked(entries); err != nil {
+		return err
+	}
+	log.Printf("[DNS] 删除覆盖: %s", name)
+	return nil
+}
+
+// lookup 查找域名匹配的覆盖：精确名称优先，其次是后缀最长的通配符
+func (o *Overrides) lookup(name string) (*Override, bool) {
+	name = strings.ToLower(name)
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	var best *Override
+	bestLen := 0
+	for _, e := range o.entries {
+		if n, ok := e.matches(name); ok && n > bestLen {
+			best, bestLen = e, n
+		}
+	}
+	return best, best != nil
+}
+
+// reload 文件有变化时重新加载，返回是否重新加载
+// 文件内容无效时保留当前列表并返回错误
+func (o *Overrides) reload() (bool, error) {
+	info, err := os.Stat(o.path)
+	if os.IsNotExist(err) {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		changed := len(o.entries) > 0
+		o.entries, o.modTime, o.size = nil, time.Time{}, 0
+		return changed, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("读取覆盖文件失败: %w", err)
+	}
+
+	o.mu.RLock()
+	unchanged := info.ModTime().Equal(o.modTime) && info.Size() == o.size
+	o.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(o.path)
+	if err != nil {
+		return false, fmt.Errorf("读取覆盖文件失败: %w", err)
+	}
+	var entries []*Override
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return false, fmt.Errorf("解析覆盖文件失败: %w", err)
+		}
+	}
+
+	valid := make([]*Override, 0, len(entries))
+	for _, e := range entries {
+		if err := e.normalize(); err != nil {
+			log.Printf("[DNS] 忽略无效的覆盖 %q: %v", e.Name, err)
+			continue
+		}
+		valid = append(valid, e)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.entries, o.modTime, o.size = valid, info.ModTime(), info.Size()
+	return true, nil
+}
+
+// saveLocked 写入覆盖文件并更新内存中的列表（调用方持有锁）
+func (o *Overrides) saveLocked(entries []*Override) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化覆盖失败: %w", err)
+	}
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入覆盖文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		return fmt.Errorf("写入覆盖文件失败: %w", err)
+	}
+
+	o.entries = entries
+	if info, err := os.Stat(o.path); err == nil {
+		o.modTime, o.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// SetOverrides 设置本地 DNS 覆盖，需在 Start 之前调用；服务器运行期间自动重新加载覆盖文件
+func (s *Server) SetOverrides(o *Overrides) {
+	s.overrides = o
+}
+
+// watchOverrides 定期检查覆盖文件是否被外部修改
+func (s *Server) watchOverrides() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(overrideReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			changed, err := s.overrides.reload()
+			if err != nil {
+				log.Printf("[DNS] 重新加载覆盖失败: %v", err)
+				continue
+			}
+			if changed {
+				log.Printf("[DNS] 覆盖文件已重新加载: %d 条", len(s.overrides.List()))
+			}
+		}
+	}
+}
+
+// answerOverride 应答匹配覆盖的查询，不匹配时 ok 为 false
+// 返回响应和最终结果（静态地址或别名链末端的域名）
+func (s *Server) answerOverride(q *message, name string, qtype uint16) (*message, string, bool) {
+	if s.overrides == nil {
+		return nil, "", false
+	}
+	override, ok := s.lookupOverride(name)
+	if !ok {
+		return nil, "", false
+	}
+
+	var answers []resource
+	owner := name
+	for i := 0; ; i++ {
+		if override.Type == OverrideA {
+			ip := net.ParseIP(override.Target)
+			rtype, rdata := dnsTypeA, []byte(ip.To4())
+			if rdata == nil {
+				rtype, rdata = dnsTypeAAAA, []byte(ip.To16())
+			}
+			if qtype == rtype {
+				answers = append(answers, localRecord(owner, rtype, rdata))
+			}
+			log.Printf("[DNS] 覆盖: %s → %s", name, override.Target)
+			return buildDNSRecords(q, answers, nil), override.Target, true
+		}
+
+		answers = append(answers, localRecord(owner, dnsTypeCNAME, encodeName(override.Target)))
+		owner = override.Target
+		if qtype == dnsTypeCNAME || i+1 >= maxCNAMEChain {
+			return buildDNSRecords(q, answers, nil), override.Target, true
+		}
+
+		next, ok := s.overrides.lookup(override.Target)
+		if !ok {
+			break
+		}
+		override = next
+	}
+
+	// 别名链末端：内部域名取 VIP，其他域名向上游查询后以目标名称附带地址
+	target := override.Target
+	answers = append(answers, s.targetRecords(target, qtype)...)
+	log.Printf("[DNS] 覆盖: %s → %s", name, target)
+	return buildDNSRecords(q, answers, nil), target, true
+}
+
+// lookupOverride 查找查询名称匹配的覆盖
+// 没有直接匹配时去掉搜索后缀再查找：单标签名称不会经系统 DNS 到达本地 DNS，用户在系统中配置了搜索域
+// 或直接输入带后缀的名称时，db 的查询以 db.beijing.beagle 到达。
+// 已知的内部域名不去掉后缀，避免短名称覆盖遮住同名的真实域名
+func (s *Server) lookupOverride(name string) (*Override, bool) {
+	if override, ok := s.overrides.lookup(name); ok {
+		return override, true
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	s.search.mu.RLock()
+	suffixes, known := s.search.suffixes, s.search.names[name]
+	s.search.mu.RUnlock()
+	if known {
+		return nil, false
+	}
+	for _, suffix := range suffixes {
+		if short, ok := strings.CutSuffix(name, "."+suffix); ok && short != "" {
+			if override, ok := s.overrides.lookup(short); ok {
+				return override, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// targetRecords 查询别名目标的地址记录，记录名称为目标域名
+func (s *Server) targetRecords(target string, qtype uint16) []resource {
+	if qtype != dnsTypeA && qtype != dnsTypeAAAA {
+		return nil
+	}
+
+	if s.isLocalName(target) {
+		vip, ok := s.resolve(target)
+		if !ok || qtype != dnsTypeA {
+			return nil
+		}
+		return []resource{localRecord(target, dnsTypeA, net.ParseIP(vip).To4())}
+	}
+
+	resp, err := s.forwardToUpstream(newDNSQuery(target, qtype))
+	if err != nil {
+		log.Printf("[DNS] 查询别名目标 %s 失败: %v", target, err)
+		return nil
+	}
+	var records []resource
+	for _, rdata := range answerRData(resp, qtype) {
+		records = append(records, localRecord(target, qtype, rdata))
+	}
+	return records
+}
+
+// newDNSQuery 构造只包含一个问题的递归查询（随机 ID）
+func newDNSQuery(name string, qtype uint16) []byte {
+	var id [2]byte
+	rand.Read(id[:])
+	q := &message{
+		header:    header{id: binary.BigEndian.Uint16(id[:]), recursionDesired: true},
+		questions: []question{{name: name, qtype: qtype, qclass: classINET}},
+	}
+	return q.pack()
+}
+
+// answerRData 返回成功响应的应答段中指定类型记录的数据
+func answerRData(resp []byte, rtype uint16) [][]byte {
+	m, err := parseMessage(resp)
+	if err != nil || m.rcode != rcodeSuccess {
+		return nil
+	}
+
+	var result [][]byte
+	for _, rr := range m.answers {
+		if rr.rtype == rtype {
+			result = append(result, rr.data)
+		}
+	}
+	return result
+}
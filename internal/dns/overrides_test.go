@@ -0,0 +1,155 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newOverrideServer(t *testing.T, entries ...Override) (*Server, *Overrides) {
+	t.Helper()
+	overrides, err := NewOverrides(filepath.Join(t.TempDir(), "dns-overrides.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if err := overrides.Add(e); err != nil {
+			t.Fatalf("Add(%+v): %v", e, err)
+		}
+	}
+	server := newTestServer()
+	server.SetOverrides(overrides)
+	return server, overrides
+}
+
+func TestOverrideAliasToInternalDomain(t *testing.T) {
+	server, _ := newOverrideServer(t, Override{Name: "db", Type: "cname", Target: "pg.yygl.beijing.beagle."})
+
+	resp, entry := server.buildAnswer(buildQuery(1, "db.", dnsTypeA))
+	if entry.Outcome != OutcomeOverride || entry.Answer != "pg.yygl.beijing.beagle" {
+		t.Fatalf("unexpected log entry: %+v", entry)
+	}
+	if binary.BigEndian.Uint16(resp[6:8]) != 2 {
+		t.Fatalf("expected CNAME + A, got %d answers", binary.BigEndian.Uint16(resp[6:8]))
+	}
+	if !bytes.Contains(resp, encodeName("pg.yygl.beijing.beagle")) || !bytes.HasSuffix(resp, []byte{127, 1, 0, 3}) {
+		t.Fatalf("answer must alias to the VIP of the target, got %x", resp)
+	}
+}
+
+func TestOverrideAliasMatchesSearchExpandedName(t *testing.T) {
+	server, _ := newOverrideServer(t,
+		Override{Name: "db", Type: "cname", Target: "pg.yygl.beijing.beagle."},
+		Override{Name: "redis", Type: OverrideA, Target: "10.0.0.9"},
+	)
+	server.SetSearch([]string{"beijing.beagle"}, []string{"pg.yygl.beijing.beagle", "redis.beijing.beagle"})
+
+	// 系统解析器按用户配置的搜索域展开 db 后以完整名称查询
+	resp, entry := server.buildAnswer(buildQuery(1, "db.beijing.beagle.", dnsTypeA))
+	if entry.Outcome != OutcomeOverride || entry.Answer != "pg.yygl.beijing.beagle" {
+		t.Fatalf("unexpected log entry: %+v", entry)
+	}
+	if !bytes.HasSuffix(resp, []byte{127, 1, 0, 3}) {
+		t.Fatalf("answer must alias to the VIP of the target, got %x", resp)
+	}
+
+	// 后缀不是搜索后缀时不去掉；已知的内部域名不被短名称覆盖遮住
+	for _, name := range []string{"db.shanghai.beagle", "redis.beijing.beagle"} {
+		if o, ok := server.lookupOverride(name); ok {
+			t.Errorf("%s must not match override %s", name, o.Name)
+		}
+	}
+}
+
+func TestOverrideStaticAndWildcard(t *testing.T) {
+	server, _ := newOverrideServer(t,
+		Override{Name: "*.dev.beagle", Type: OverrideA, Target: "10.0.0.1"},
+		Override{Name: "*.api.dev.beagle", Type: OverrideA, Target: "10.0.0.2"},
+		Override{Name: "pg.yygl.beijing.beagle", Type: OverrideA, Target: "fd00::1"},
+	)
+
+	tests := []struct {
+		name  string
+		qtype uint16
+		want  []byte
+	}{
+		{"web.dev.beagle.", dnsTypeA, []byte{10, 0, 0, 1}},
+		{"v1.api.dev.beagle.", dnsTypeA, []byte{10, 0, 0, 2}},
+		{"pg.yygl.beijing.beagle.", dnsTypeAAAA, []byte{0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+	}
+	for _, tt := range tests {
+		resp := answerOf(server, buildQuery(1, tt.name, tt.qtype))
+		if binary.BigEndian.Uint16(resp[6:8]) != 1 || !bytes.HasSuffix(resp, tt.want) {
+			t.Errorf("%s: unexpected answer %x", tt.name, resp)
+		}
+	}
+
+	// 通配符不匹配后缀本身；静态 IPv6 地址的 A 查询为 NODATA
+	if _, ok := server.overrides.lookup("dev.beagle"); ok {
+		t.Error("wildcard must not match its own suffix")
+	}
+	if resp := answerOf(server, buildQuery(1, "pg.yygl.beijing.beagle.", dnsTypeA)); binary.BigEndian.Uint16(resp[6:8]) != 0 || resp[3]&0x0f != 0 {
+		t.Errorf("expected NODATA for A query on IPv6 override, got %x", resp)
+	}
+}
+
+func TestOverrideAliasLoopIsBounded(t *testing.T) {
+	server, _ := newOverrideServer(t,
+		Override{Name: "a.beagle", Type: OverrideCNAME, Target: "b.beagle"},
+		Override{Name: "b.beagle", Type: OverrideCNAME, Target: "a.beagle"},
+	)
+	resp := answerOf(server, buildQuery(1, "a.beagle.", dnsTypeA))
+	if got := binary.BigEndian.Uint16(resp[6:8]); got != maxCNAMEChain {
+		t.Fatalf("expected %d CNAME records, got %d", maxCNAMEChain, got)
+	}
+}
+
+func TestOverrideValidation(t *testing.T) {
+	_, overrides := newOverrideServer(t)
+	for _, bad := range []Override{
+		{Name: "db", Type: OverrideA, Target: "not-an-ip"},
+		{Name: "bad name", Type: OverrideA, Target: "10.0.0.1"},
+		{Name: "db", Type: OverrideCNAME, Target: "db"},
+		{Name: "db", Type: "MX", Target: "mail.beagle"},
+	} {
+		if err := overrides.Add(bad); err == nil {
+			t.Errorf("Add(%+v) should fail", bad)
+		}
+	}
+	if err := overrides.Remove("missing"); err == nil {
+		t.Error("Remove of a missing entry should fail")
+	}
+}
+
+func TestOverridesReloadFromFile(t *testing.T) {
+	_, overrides := newOverrideServer(t, Override{Name: "db", Type: OverrideA, Target: "10.0.0.1"})
+
+	data := []byte(`[{"name":"cache","type":"A","target":"10.0.0.9"},{"name":"bad","type":"A","target":"x"}]`)
+	if err := os.WriteFile(overrides.path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 确保修改时间与上次加载不同
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(overrides.path, future, future)
+
+	if changed, err := overrides.reload(); err != nil || !changed {
+		t.Fatalf("reload() = %v, %v", changed, err)
+	}
+	list := overrides.List()
+	if len(list) != 1 || list[0].Name != "cache" {
+		t.Fatalf("unexpected entries after reload: %+v", list)
+	}
+
+	// 内容无效时保留当前列表
+	os.WriteFile(overrides.path, []byte("{"), 0644)
+	os.Chtimes(overrides.path, future.Add(time.Minute), future.Add(time.Minute))
+	if _, err := overrides.reload(); err == nil {
+		t.Fatal("reload of invalid file should fail")
+	}
+	if _, ok := overrides.lookup("cache"); !ok {
+		t.Fatal("entries must be kept when the file is invalid")
+	}
+}
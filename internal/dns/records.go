@@ -0,0 +1,165 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// records.go 应答内部域名的 SRV / TXT 查询，让脚本和服务发现客户端通过普通 DNS 查询资源信息
+//   - _<port>._tcp.<domain> SRV：域名在 VIP 上暴露了该端口时返回 SRV，附加段带 A 记录
+//   - _http._tcp.<domain> 等服务名 SRV：返回该服务的常用端口中域名实际暴露的端口
+//   - <domain> TXT：type、agent、namespace、service、region、ports 等元数据
+
+// DNS 记录类型
+const (
+	dnsTypeTXT uint16 = 16
+	dnsTypeSRV uint16 = 33
+)
+
+// localTTL 本地应答记录的 TTL（秒），与 A 记录一致
+const localTTL = 60
+
+// Record 内部域名的元数据，用于应答 SRV / TXT 查询
+type Record struct {
+	Type      string // 域名类型：ssh / k8sapi / k8ssvc
+	Agent     string // Agent 名称
+	Namespace string // K8S 命名空间（k8ssvc 类型）
+	Service   string // K8S Service 名称（k8ssvc 类型）
+	Region    string // 区域名称
+	Ports     []int  // VIP 上监听的 TCP 端口
+}
+
+// RecordFunc 域名元数据回调函数
+// 输入域名（不含末尾点），返回元数据和是否存在
+type RecordFunc func(domain string) (*Record, bool)
+
+// wellKnownServices SRV 服务名对应的常用端口
+var wellKnownServices = map[string][]int{
+	"http":  {80, 8080, 8000, 8008, 8888},
+	"https": {443, 8443},
+	"ssh":   {22},
+}
+
+// SetRecordFunc 设置域名元数据回调，未设置时 SRV / TXT 查询返回 NODATA
+func (s *Server) SetRecordFunc(fn RecordFunc) {
+	s.records = fn
+}
+
+// splitServiceName 拆分 SRV 查询名 _<service>._<proto>.<domain>
+// 返回服务名（端口号或 http 等）、协议（tcp）和域名；不是服务名格式时 ok 为 false
+func splitServiceName(name string) (service, proto, domain string, ok bool) {
+	parts := strings.SplitN(name, ".", 3)
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], "_") || !strings.HasPrefix(parts[1], "_") {
+		return "", "", name, false
+	}
+	return strings.ToLower(parts[0][1:]), strings.ToLower(parts[1][1:]), parts[2], true
+}
+
+// servicePorts 返回服务名对应的、域名实际暴露的端口
+func servicePorts(record *Record, service, proto string) []int {
+	if proto != "tcp" {
+		return nil
+	}
+	candidates := wellKnownServices[service]
+	if port, err := strconv.Atoi(service); err == nil {
+		candidates = []int{port}
+	}
+
+	var ports []int
+	for _, want := range candidates {
+		for _, port := range record.Ports {
+			if port == want {
+				ports = append(ports, port)
+				break
+			}
+		}
+	}
+	return ports
+}
+
+// answerService 应答 _<service>._tcp.<domain> 查询
+// 域名未暴露对应端口时返回 NXDOMAIN（该服务名不存在），非 SRV 类型返回 NODATA
+func (s *Server) answerService(q *message, name, service, proto, domain, vip string, qtype uint16) *message {
+	var record *Record
+	if s.records != nil {
+		record, _ = s.records(domain)
+	}
+	if record == nil {
+		log.Printf("[DNS] 解析: %s → 无端口信息", name)
+		return buildDNSNXDomain(q)
+	}
+
+	ports := servicePorts(record, service, proto)
+	if len(ports) == 0 {
+		log.Printf("[DNS] 解析: %s → 未暴露该服务", name)
+		return buildDNSNXDomain(q)
+	}
+	if qtype != dnsTypeSRV {
+		return buildDNSNoData(q)
+	}
+
+	target := encodeName(domain)
+	answers := make([]resource, 0, len(ports))
+	for _, port := range ports {
+		rdata := []byte{0, 0, 0, 0} // 优先级、权重
+		rdata = binary.BigEndian.AppendUint16(rdata, uint16(port))
+		answers = append(answers, localRecord(name, dnsTypeSRV, append(rdata, target...)))
+	}
+	additional := []resource{localRecord(domain, dnsTypeA, net.ParseIP(vip).To4())}
+
+	log.Printf("[DNS] 解析: %s (SRV) → %s %v", name, domain, ports)
+	return buildDNSRecords(q, answers, additional)
+}
+
+// answerTXT 应答域名的 TXT 查询，返回资源元数据
+func (s *Server) answerTXT(q *message, domain string) *message {
+	var record *Record
+	if s.records != nil {
+		record, _ = s.records(domain)
+	}
+	if record == nil {
+		return buildDNSNoData(q)
+	}
+
+	var rdata []byte
+	for _, kv := range record.txt() {
+		if len(kv) > 255 {
+			kv = kv[:255]
+		}
+		rdata = append(rdata, byte(len(kv)))
+		rdata = append(rdata, kv...)
+	}
+	if len(rdata) == 0 {
+		return buildDNSNoData(q)
+	}
+
+	log.Printf("[DNS] 解析: %s (TXT)", domain)
+	return buildDNSRecords(q, []resource{localRecord(q.questions[0].name, dnsTypeTXT, rdata)}, nil)
+}
+
+// txt 以 key=value 形式列出元数据，空值跳过
+func (r *Record) txt() []string {
+	var ports []string
+	for _, port := range r.Ports {
+		ports = append(ports, strconv.Itoa(port))
+	}
+
+	var result []string
+	for _, kv := range [][2]string{
+		{"type", r.Type},
+		{"agent", r.Agent},
+		{"namespace", r.Namespace},
+		{"service", r.Service},
+		{"region", r.Region},
+		{"ports", strings.Join(ports, ",")},
+	} {
+		if kv[1] != "" {
+			result = append(result, fmt.Sprintf("%s=%s", kv[0], kv[1]))
+		}
+	}
+	return result
+}
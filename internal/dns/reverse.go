@@ -0,0 +1,87 @@
+package dns
+
+import (
+	"log"
+	"net"
+	"strings"
+	"sync"
+)
+
+// reverse.go 应答 VIP 地址段的反向查询（in-addr.arpa PTR）
+// ss、netstat、last、SSH VerifyHostKeyDNS 等会反查 127.1.x.x，本地应答后显示内部域名而不是裸地址；
+// VIP 地址段内未分配的地址返回 NXDOMAIN，不转发到上游（上游不可能有结果，只会超时）
+
+// dnsTypePTR PTR 记录类型
+const dnsTypePTR uint16 = 12
+
+// reverseSuffix IPv4 反向查询域名后缀
+const reverseSuffix = ".in-addr.arpa"
+
+// ReverseFunc VIP 反查回调函数
+// 输入 VIP 地址，返回域名（不含末尾点）和是否存在
+type ReverseFunc func(vip string) (domain string, ok bool)
+
+// reverseZone 本地应答的反向查询
+type reverseZone struct {
+	lookup  ReverseFunc
+	network *net.IPNet // 本地应答的地址段（VIP 地址段）
+	mu      sync.RWMutex
+}
+
+// SetReverseFunc 设置 VIP 反查回调和 VIP 地址段，地址段内的 PTR 查询由本地应答
+// 未设置时反向查询全部转发到上游
+func (s *Server) SetReverseFunc(fn ReverseFunc, network *net.IPNet) {
+	s.reverse.mu.Lock()
+	defer s.reverse.mu.Unlock()
+	s.reverse.lookup = fn
+	s.reverse.network = network
+}
+
+// reverseIP 解析 d.c.b.a.in-addr.arpa 形式的反向查询域名，地址属于 VIP 地址段时返回地址
+func (s *Server) reverseIP(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	if !strings.HasSuffix(lower, reverseSuffix) {
+		return "", false
+	}
+
+	s.reverse.mu.RLock()
+	network := s.reverse.network
+	lookup := s.reverse.lookup
+	s.reverse.mu.RUnlock()
+	if network == nil || lookup == nil {
+		return "", false
+	}
+
+	labels := strings.Split(strings.TrimSuffix(lower, reverseSuffix), ".")
+	if len(labels) != 4 {
+		return "", false
+	}
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	ip := net.ParseIP(strings.Join(labels, ".")).To4()
+	if ip == nil || !network.Contains(ip) {
+		return "", false
+	}
+	return ip.String(), true
+}
+
+// answerReverse 应答 VIP 的反向查询，返回响应和对应的域名（未分配时为空）
+func (s *Server) answerReverse(q *message, ip string, qtype uint16) (*message, string) {
+	s.reverse.mu.RLock()
+	lookup := s.reverse.lookup
+	s.reverse.mu.RUnlock()
+
+	domain, ok := lookup(ip)
+	if !ok {
+		log.Printf("[DNS] 反查: %s → 未分配", ip)
+		return buildDNSNXDomain(q), ""
+	}
+	if qtype != dnsTypePTR {
+		return buildDNSNoData(q), domain
+	}
+
+	log.Printf("[DNS] 反查: %s → %s", ip, domain)
+	answer := localRecord(q.questions[0].name, dnsTypePTR, encodeName(domain))
+	return buildDNSRecords(q, []resource{answer}, nil), domain
+}
@@ -0,0 +1,112 @@
+package dns
+
+import (
+	"log"
+	"net"
+	"strings"
+	"sync"
+)
+
+// search.go 短名称解析：按搜索后缀展开不带内部域名后缀的名称
+//   - beagle-242 → beagle-242.beijing.beagle，pg.yygl → pg.yygl.beijing.beagle
+//   - 展开结果只在已知的内部域名中匹配，不会为不存在的名称查询 Server
+//   - 多个搜索后缀都能匹配时视为有歧义：返回 NXDOMAIN 并在查询日志中列出候选，不做猜测
+// 搜索后缀来自用户配置和 Server 下发的区域、租户，只在本地 DNS 中使用，不注册到系统 DNS：
+// 系统解析器会自己按顺序展开短名称，取第一个能解析的后缀，以完整域名查询本地 DNS，歧义无法再被发现。
+// 因此短名称只在单标签查询直接到达本地 DNS 时（本地 DNS 是首选 DNS 的 resolv.conf / resolvconf 后端）
+// 或通过 App.ExpandShortName 展开时生效；systemd-resolved、/etc/resolver、NRPT 不会把单标签名称发给本地 DNS
+
+// searchList 短名称展开使用的搜索后缀和已知的内部域名
+type searchList struct {
+	suffixes []string        // 按优先级排列的搜索后缀
+	names    map[string]bool // 已知的内部域名
+	mu       sync.RWMutex
+}
+
+// NormalizeSearchDomains 规范化搜索后缀列表：规则与域名后缀相同，并且必须属于某个内部域名后缀
+// （短名称只展开为内部域名），保持原有顺序并去重
+func NormalizeSearchDomains(domains, zones []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+		if domain == "" || seen[domain] {
+			continue
+		}
+		if !zonePattern.MatchString(domain) {
+			log.Printf("[DNS] 忽略无效的搜索后缀: %q", domain)
+			continue
+		}
+		if _, _, ok := SplitZone(domain, zones); !ok {
+			log.Printf("[DNS] 忽略不属于内部域名后缀的搜索后缀: %q", domain)
+			continue
+		}
+		seen[domain] = true
+		result = append(result, domain)
+	}
+	return result
+}
+
+// SetSearch 设置搜索后缀（已规范化、无重复）和已知的内部域名，短名称展开后只匹配 names 中的域名
+func (s *Server) SetSearch(suffixes, names []string) {
+	known := make(map[string]bool, len(names))
+	for _, name := range names {
+		known[strings.ToLower(strings.TrimSuffix(name, "."))] = true
+	}
+
+	s.search.mu.Lock()
+	s.search.suffixes = suffixes
+	s.search.names = known
+	s.search.mu.Unlock()
+}
+
+// SearchDomains 返回当前的搜索后缀
+func (s *Server) SearchDomains() []string {
+	s.search.mu.RLock()
+	defer s.search.mu.RUnlock()
+	return s.search.suffixes
+}
+
+// ExpandName 按搜索后缀展开短名称，返回存在的完整域名（按搜索后缀顺序）
+// 名称已属于内部域名后缀时不展开；返回多个域名表示短名称有歧义
+func (s *Server) ExpandName(name string) []string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" || s.isLocalName(name) || net.ParseIP(name) != nil {
+		return nil
+	}
+
+	s.search.mu.RLock()
+	defer s.search.mu.RUnlock()
+
+	var matches []string
+	for _, suffix := range s.search.suffixes {
+		if candidate := name + "." + suffix; s.search.names[candidate] {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
+
+// answerShortName 应答可按搜索后缀展开的短名称，返回响应和匹配的完整域名，没有匹配时 ok 为 false
+// 唯一匹配时返回指向完整域名的 CNAME（A 查询附带 VIP）；多个匹配时有歧义，返回 NXDOMAIN
+func (s *Server) answerShortName(q *message, name string, qtype uint16) (*message, []string, bool) {
+	matches := s.ExpandName(name)
+	if len(matches) == 0 {
+		return nil, nil, false
+	}
+	if len(matches) > 1 {
+		log.Printf("[DNS] 短名称有歧义: %s → %s", name, strings.Join(matches, ", "))
+		return buildDNSNXDomain(q), matches, true
+	}
+
+	full := matches[0]
+	answers := []resource{localRecord(name, dnsTypeCNAME, encodeName(full))}
+	if qtype == dnsTypeA {
+		if vip, ok := s.resolve(full); ok {
+			answers = append(answers, localRecord(full, dnsTypeA, net.ParseIP(vip).To4()))
+		}
+	}
+
+	log.Printf("[DNS] 短名称: %s → %s", name, full)
+	return buildDNSRecords(q, answers, nil), matches, true
+}
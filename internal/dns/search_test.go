@@ -0,0 +1,62 @@
+package dns
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func newSearchTestServer() *Server {
+	server := newTestServer()
+	server.SetSearch(
+		NormalizeSearchDomains([]string{"yygl.beijing.beagle", "beijing.beagle", "shanghai.beagle", "example.com"}, []string{"beagle"}),
+		[]string{"pg.yygl.beijing.beagle", "beagle-242.beijing.beagle", "redis.beijing.beagle", "redis.shanghai.beagle"},
+	)
+	return server
+}
+
+func TestNormalizeSearchDomainsKeepsOnlyInternalSuffixes(t *testing.T) {
+	got := NormalizeSearchDomains([]string{" Beijing.Beagle. ", "beijing.beagle", "example.com", "bad suffix"}, []string{"beagle"})
+	if strings.Join(got, ",") != "beijing.beagle" {
+		t.Fatalf("unexpected search domains: %v", got)
+	}
+}
+
+func TestShortNameExpandsToUniqueDomain(t *testing.T) {
+	server := newSearchTestServer()
+	for _, name := range []string{"pg", "pg.yygl"} {
+		if got := server.ExpandName(name); len(got) != 1 || got[0] != "pg.yygl.beijing.beagle" {
+			t.Fatalf("ExpandName(%q) = %v", name, got)
+		}
+	}
+
+	query := buildQuery(3, "pg.yygl.", dnsTypeA)
+	resp, entry := server.buildAnswer(query)
+	if resp[3]&0x0f != 0 || binary.BigEndian.Uint16(resp[6:8]) != 2 {
+		t.Fatalf("expected CNAME + A, got rcode %d with %d answers", resp[3]&0x0f, binary.BigEndian.Uint16(resp[6:8]))
+	}
+	if rtype := binary.BigEndian.Uint16(resp[len(query)+2:]); rtype != dnsTypeCNAME {
+		t.Fatalf("first answer must be a CNAME, got type %d", rtype)
+	}
+	if entry.Outcome != OutcomeSearch || entry.Answer != "pg.yygl.beijing.beagle" {
+		t.Fatalf("unexpected journal entry: %+v", entry)
+	}
+}
+
+func TestAmbiguousShortNameIsNotGuessed(t *testing.T) {
+	server := newSearchTestServer()
+	resp, entry := server.buildAnswer(buildQuery(4, "redis.", dnsTypeA))
+	if rcode := resp[3] & 0x0f; rcode != 3 {
+		t.Fatalf("ambiguous short name must be NXDOMAIN, got rcode %d", rcode)
+	}
+	if entry.Outcome != OutcomeAmbiguous || !strings.Contains(entry.Error, "redis.shanghai.beagle") {
+		t.Fatalf("ambiguity must be reported with candidates: %+v", entry)
+	}
+}
+
+func TestFullyQualifiedNameIsNotExpanded(t *testing.T) {
+	server := newSearchTestServer()
+	if got := server.ExpandName("pg.yygl.beijing.beagle"); got != nil {
+		t.Fatalf("names inside a zone must not be expanded: %v", got)
+	}
+}
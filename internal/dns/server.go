@@ -1,17 +1,27 @@
-// Package dns 提供本地 DNS 服务器，拦截 .beagle 域名解析
-// 监听 127.0.0.1:15353，将 .beagle 域名解析为 VIP 地址（127.1.x.x）
-// 非 .beagle 域名转发到上游 DNS
+// Package dns 提供本地 DNS 服务器，拦截内部域名（默认 .beagle，可由 Server 下发）解析
+// 监听 127.0.0.1:15353（UDP + TCP），将内部域名解析为 VIP 地址（127.1.x.x）
+// 其他域名转发到上游 DNS
 package dns
 
 import (
-	"encoding/binary"
 	"fmt"
 	"log"
 	"net"
 	"strings"
 	"sync"
+	"time"
 )
 
+// DNS 报文大小限制
+const (
+	maxUDPSize     = 512   // 无 EDNS0 时 UDP 响应上限（RFC 1035）
+	ednsUDPSize    = 4096  // 本地服务器通告的 EDNS0 UDP 缓冲区大小
+	maxMessageSize = 65535 // DNS 报文最大长度（TCP 长度前缀上限）
+)
+
+// upstreamTimeout 单次上游查询超时
+const upstreamTimeout = 5 * time.Second
+
 // ResolveFunc 域名解析回调函数
 // 输入域名（不含末尾点），返回 VIP 地址和是否成功
 type ResolveFunc func(domain string) (vip string, ok bool)
@@ -20,8 +30,32 @@ type ResolveFunc func(domain string) (vip string, ok bool)
 type Server struct {
 	listenAddr  string
 	conn        *net.UDPConn
+	tcpListener net.Listener
 	resolve     ResolveFunc
-	upstreamDNS string // 上游 DNS 地址（用于转发非 .beagle 域名）
+	records     RecordFunc // 域名元数据（SRV / TXT），可为空
+
+	// 本地应答的域名后缀，可在运行时替换
+	zones   []string
+	zonesMu sync.RWMutex
+
+	// 上游 DNS（用于转发内部域名以外的查询），可在运行时替换
+	upstreams  *upstreamSet
+	upstreamMu sync.RWMutex
+
+	// 上游应答缓存
+	cache *answerCache
+
+	// 查询日志
+	journal *journal
+
+	// VIP 反向查询
+	reverse reverseZone
+
+	// 用户自定义覆盖，可为空
+	overrides *Overrides
+
+	// 短名称展开使用的搜索后缀
+	search searchList
 
 	stopCh chan struct{}
 	wg     sync.WaitGroup
@@ -30,13 +64,52 @@ type Server struct {
 // NewServer 创建 DNS 服务器
 func NewServer(listenAddr string, resolve ResolveFunc) *Server {
 	return &Server{
-		listenAddr:  listenAddr,
-		resolve:     resolve,
-		upstreamDNS: "8.8.8.8:53",
-		stopCh:      make(chan struct{}),
+		listenAddr: listenAddr,
+		resolve:    resolve,
+		zones:      []string{DefaultZone},
+		upstreams:  newUpstreamSet([]string{defaultUpstream}),
+		cache:      newAnswerCache(defaultCacheSize),
+		journal:    newJournal(defaultJournalSize),
+		stopCh:     make(chan struct{}),
 	}
 }
 
+// SetUpstreams 设置上游 DNS 列表，按顺序尝试并自动故障切换
+// 列表为空（或全部无效）时回退到默认上游
+func (s *Server) SetUpstreams(specs []string) {
+	set := newUpstreamSet(specs)
+	if len(set.upstreams) == 0 {
+		log.Printf("[DNS] 未配置可用的上游 DNS，使用默认上游 %s", defaultUpstream)
+		set = newUpstreamSet([]string{defaultUpstream})
+	}
+
+	s.upstreamMu.Lock()
+	s.upstreams = set
+	s.upstreamMu.Unlock()
+
+	// 不同上游的应答可能不同（如公司内网 DNS），切换后清空缓存
+	s.cache.flush()
+
+	log.Printf("[DNS] 上游 DNS: %s", strings.Join(specs, ", "))
+}
+
+// UpstreamStatus 返回各上游 DNS 的健康状态
+func (s *Server) UpstreamStatus() []*UpstreamStatus {
+	s.upstreamMu.RLock()
+	defer s.upstreamMu.RUnlock()
+	return s.upstreams.status()
+}
+
+// ListenAddr 返回监听地址
+func (s *Server) ListenAddr() string {
+	return s.listenAddr
+}
+
+// CacheStats 返回上游应答缓存的统计
+func (s *Server) CacheStats() *CacheStats {
+	return s.cache.stats()
+}
+
 // Start 启动 DNS 服务器
 func (s *Server) Start() error {
 	addr, err := net.ResolveUDPAddr("udp", s.listenAddr)
@@ -50,11 +123,27 @@ func (s *Server) Start() error {
 	}
 
 	s.conn = conn
-	log.Printf("[DNS] 本地 DNS 服务器已启动: %s", s.listenAddr)
 
 	s.wg.Add(1)
 	go s.serve()
 
+	// TCP 监听：客户端收到 TC 标志后会改用 TCP 重试
+	// TCP 监听失败不影响 UDP 服务，只记录警告
+	tcpListener, err := net.Listen("tcp", s.listenAddr)
+	if err != nil {
+		log.Printf("[DNS] 警告: 监听 DNS TCP 端口失败: %v", err)
+	} else {
+		s.tcpListener = tcpListener
+		s.wg.Add(1)
+		go s.serveTCP()
+	}
+
+	if s.overrides != nil {
+		s.wg.Add(1)
+		go s.watchOverrides()
+	}
+
+	log.Printf("[DNS] 本地 DNS 服务器已启动: %s", s.listenAddr)
 	return nil
 }
 
@@ -64,15 +153,19 @@ func (s *Server) Stop() {
 	if s.conn != nil {
 		s.conn.Close()
 	}
+	if s.tcpListener != nil {
+		s.tcpListener.Close()
+	}
 	s.wg.Wait()
 	log.Printf("[DNS] 本地 DNS 服务器已停止")
 }
 
-// serve 处理 DNS 请求
+// serve 处理 UDP DNS 请求
 func (s *Server) serve() {
 	defer s.wg.Done()
 
-	buf := make([]byte, 512)
+	// 按最大报文长度读取，EDNS0 客户端的查询可能超过 512 字节
+	buf := make([]byte, maxMessageSize)
 	for {
 		select {
 		case <-s.stopCh:
@@ -98,150 +191,188 @@ func (s *Server) serve() {
 	}
 }
 
-// handleQuery 处理单个 DNS 查询
+// DNS 记录类型
+const (
+	dnsTypeA    uint16 = 1
+	dnsTypeAAAA uint16 = 28
+	dnsTypeOPT  uint16 = 41
+)
+
+// handleQuery 处理单个 UDP DNS 查询
 func (s *Server) handleQuery(packet []byte, remoteAddr *net.UDPAddr) {
-	// 解析查询域名
-	domain, qtype, err := parseDNSQuestion(packet)
-	if err != nil {
-		log.Printf("[DNS] 解析查询失败: %v", err)
+	resp := s.respond(packet, remoteAddr.String(), "udp")
+	if resp == nil {
 		return
 	}
+	// 超出客户端 UDP 缓冲区时截断并设置 TC，客户端会改用 TCP 重试
+	if len(resp) > udpPayloadLimit(packet) {
+		resp = buildDNSTruncated(packet, resp)
+	}
+	s.conn.WriteToUDP(resp, remoteAddr)
+}
 
-	// 去掉末尾的点
-	domain = strings.TrimSuffix(domain, ".")
+// respond 生成查询的响应并记录查询日志
+func (s *Server) respond(packet []byte, client, protocol string) []byte {
+	start := time.Now()
+	resp, entry := s.buildAnswer(packet)
+	if entry != nil {
+		entry.Time = start
+		entry.Client = client
+		entry.Protocol = protocol
+		entry.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+		s.journal.add(entry)
+	}
+	return resp
+}
 
-	// 检查是否是 .beagle 域名
-	if strings.HasSuffix(domain, ".beagle") && qtype == 1 { // A 记录
-		vip, ok := s.resolve(domain)
-		if ok {
-			resp := buildDNSResponse(packet, vip)
-			s.conn.WriteToUDP(resp, remoteAddr)
-			log.Printf("[DNS] 解析: %s → %s", domain, vip)
-			return
+// buildAnswer 生成查询对应的完整响应报文和查询日志（不含时间和客户端）
+// 报文无法解析时返回 FORMERR（不足一个报文头或本身是响应时返回 nil，直接丢弃）；
+// 返回的报文不做截断，由传输层按各自的上限处理
+func (s *Server) buildAnswer(packet []byte) ([]byte, *QueryLogEntry) {
+	q, err := parseMessage(packet)
+	if err != nil {
+		log.Printf("[DNS] 解析查询失败: %v", err)
+		return buildDNSFormatError(packet), nil
+	}
+	if resp, ok := checkQuery(q); !ok {
+		if resp == nil {
+			return nil, nil
 		}
-		// 域名未注册，返回 NXDOMAIN
-		resp := buildDNSNXDomain(packet)
-		s.conn.WriteToUDP(resp, remoteAddr)
-		log.Printf("[DNS] 域名未注册: %s", domain)
-		return
+		return resp.pack(), nil
 	}
 
-	// 非 .beagle 域名，转发到上游 DNS
-	resp, err := s.forwardToUpstream(packet)
-	if err != nil {
-		log.Printf("[DNS] 转发到上游失败: %v", err)
-		resp = buildDNSServerFailure(packet)
+	domain, qtype := q.questions[0].name, q.questions[0].qtype
+	entry := &QueryLogEntry{Name: domain, Type: queryTypeName(qtype)}
+
+	// 用户自定义覆盖优先于内部域名解析和上游
+	if resp, answer, ok := s.answerOverride(q, domain, qtype); ok {
+		entry.Outcome = OutcomeOverride
+		entry.Answer = answer
+		return resp.pack(), entry
 	}
-	s.conn.WriteToUDP(resp, remoteAddr)
-}
 
-// forwardToUpstream 转发查询到上游 DNS
-func (s *Server) forwardToUpstream(packet []byte) ([]byte, error) {
-	upstreamAddr, err := net.ResolveUDPAddr("udp", s.upstreamDNS)
-	if err != nil {
-		return nil, err
+	// 内部域名一律本地应答，不转发到上游，避免内部域名泄露
+	if s.isLocalName(domain) {
+		resp, vip := s.answerLocal(q, domain, qtype)
+		entry.Outcome = localOutcome(resp)
+		entry.Answer = vip
+		return resp.pack(), entry
 	}
 
-	conn, err := net.DialUDP("udp", nil, upstreamAddr)
-	if err != nil {
-		return nil, err
+	// VIP 地址段的反向查询本地应答
+	if ip, ok := s.reverseIP(domain); ok {
+		resp, name := s.answerReverse(q, ip, qtype)
+		entry.Outcome = localOutcome(resp)
+		entry.Answer = name
+		return resp.pack(), entry
 	}
-	defer conn.Close()
 
-	if _, err := conn.Write(packet); err != nil {
-		return nil, err
+	// 不带内部域名后缀的短名称，按搜索后缀展开
+	if resp, matches, ok := s.answerShortName(q, domain, qtype); ok {
+		if len(matches) > 1 {
+			entry.Outcome = OutcomeAmbiguous
+			entry.Error = fmt.Sprintf("短名称有歧义: %s", strings.Join(matches, ", "))
+		} else {
+			entry.Outcome = OutcomeSearch
+			entry.Answer = matches[0]
+		}
+		return resp.pack(), entry
 	}
 
-	buf := make([]byte, 512)
-	n, err := conn.Read(buf)
+	// 其他域名，优先使用缓存，否则转发到上游 DNS
+	if resp, ok := s.cache.get(packet); ok {
+		entry.Outcome = OutcomeCached
+		return resp, entry
+	}
+	resp, err := s.forwardToUpstream(packet)
 	if err != nil {
-		return nil, err
+		log.Printf("[DNS] 转发到上游失败: %v", err)
+		entry.Outcome = OutcomeServFail
+		entry.Error = err.Error()
+		return buildDNSServerFailure(q).pack(), entry
 	}
-
-	return buf[:n], nil
+	s.cache.put(packet, resp)
+	entry.Outcome = OutcomeForwarded
+	return resp, entry
 }
 
-// parseDNSQuestion 从 DNS 报文中解析查询域名和类型
-func parseDNSQuestion(packet []byte) (string, uint16, error) {
-	if len(packet) < 12 {
-		return "", 0, fmt.Errorf("报文太短")
+// localOutcome 按本地应答的响应码和应答数分类查询结果
+func localOutcome(resp *message) string {
+	switch {
+	case resp.rcode == rcodeNameError:
+		return OutcomeNXDomain
+	case len(resp.answers) == 0:
+		return OutcomeNoData
+	default:
+		return OutcomeLocal
 	}
+}
 
-	// 跳过 DNS 头部（12 字节）
-	offset := 12
-	var parts []string
+// answerLocal 本地应答内部域名查询
+// A 记录返回 VIP；TXT 返回资源元数据；_<service>._tcp.<domain> 返回 SRV。
+// VIP 只有 IPv4，AAAA 等其他类型返回 NODATA（NOERROR + 空应答），
+// 让优先 IPv6 的客户端立即回退到 A 记录，而不是等待上游超时
+// 返回响应和域名对应的 VIP（域名未注册时为空）
+func (s *Server) answerLocal(q *message, name string, qtype uint16) (*message, string) {
+	service, proto, domain, isService := splitServiceName(name)
 
-	for offset < len(packet) {
-		length := int(packet[offset])
-		if length == 0 {
-			offset++
-			break
-		}
-		offset++
-		if offset+length > len(packet) {
-			return "", 0, fmt.Errorf("域名标签越界")
-		}
-		parts = append(parts, string(packet[offset:offset+length]))
-		offset += length
+	vip, ok := s.resolve(domain)
+	if !ok {
+		// 域名未注册，返回 NXDOMAIN
+		log.Printf("[DNS] 域名未注册: %s", domain)
+		return buildDNSNXDomain(q), ""
 	}
 
-	if offset+4 > len(packet) {
-		return "", 0, fmt.Errorf("查询类型越界")
+	switch {
+	case isService:
+		return s.answerService(q, name, service, proto, domain, vip, qtype), vip
+	case qtype == dnsTypeTXT:
+		return s.answerTXT(q, domain), vip
+	case qtype != dnsTypeA:
+		log.Printf("[DNS] 解析: %s (type=%d) → NODATA", domain, qtype)
+		return buildDNSNoData(q), vip
 	}
 
-	qtype := binary.BigEndian.Uint16(packet[offset : offset+2])
-	domain := strings.Join(parts, ".")
+	log.Printf("[DNS] 解析: %s → %s", domain, vip)
+	return buildDNSResponse(q, vip), vip
+}
 
-	return domain, qtype, nil
+// forwardToUpstream 转发查询到上游 DNS
+func (s *Server) forwardToUpstream(packet []byte) ([]byte, error) {
+	s.upstreamMu.RLock()
+	upstreams := s.upstreams
+	s.upstreamMu.RUnlock()
+	return upstreams.exchange(packet)
 }
 
-// buildDNSResponse 构建 DNS A 记录响应
-func buildDNSResponse(query []byte, ip string) []byte {
+// buildDNSResponse 构建 A 记录的权威响应，应答名称与问题段一致
+func buildDNSResponse(q *message, ip string) *message {
 	parsedIP := net.ParseIP(ip).To4()
 	if parsedIP == nil {
-		return buildDNSServerFailure(query)
+		return buildDNSServerFailure(q)
 	}
+	return buildDNSRecords(q, []resource{localRecord(q.questions[0].name, dnsTypeA, parsedIP)}, nil)
+}
 
-	// 复制查询报文作为响应基础
-	resp := make([]byte, len(query))
-	copy(resp, query)
-
-	// 设置响应标志
-	resp[2] = 0x81 // QR=1, Opcode=0, AA=1
-	resp[3] = 0x80 // RA=1, RCODE=0 (No Error)
-
-	// 设置 Answer Count = 1
-	resp[6] = 0x00
-	resp[7] = 0x01
-
-	// 追加 Answer 段
-	// Name: 指针指向 Question 中的域名（offset 12）
-	answer := []byte{
-		0xc0, 0x0c, // 名称指针
-		0x00, 0x01, // Type: A
-		0x00, 0x01, // Class: IN
-		0x00, 0x00, 0x00, 0x3c, // TTL: 60 秒
-		0x00, 0x04, // RDLENGTH: 4
-	}
-	answer = append(answer, parsedIP...)
+// buildDNSRecords 构建包含应答段和附加段记录的权威响应
+func buildDNSRecords(q *message, answers, additional []resource) *message {
+	resp := q.reply(rcodeSuccess, true)
+	resp.answers = answers
+	resp.additional = additional
+	return resp
+}
 
-	return append(resp, answer...)
+// buildDNSNXDomain 构建权威的 NXDOMAIN 响应
+func buildDNSNXDomain(q *message) *message {
+	return q.reply(rcodeNameError, true)
 }
 
-// buildDNSNXDomain 构建 NXDOMAIN 响应
-func buildDNSNXDomain(query []byte) []byte {
-	resp := make([]byte, len(query))
-	copy(resp, query)
-	resp[2] = 0x81 // QR=1, AA=1
-	resp[3] = 0x83 // RA=1, RCODE=3 (NXDOMAIN)
-	return resp
+// buildDNSNoData 构建 NODATA 响应（域名存在，但没有所查询类型的记录）
+func buildDNSNoData(q *message) *message {
+	return q.reply(rcodeSuccess, true)
 }
 
-// buildDNSServerFailure 构建 Server Failure 响应
-func buildDNSServerFailure(query []byte) []byte {
-	resp := make([]byte, len(query))
-	copy(resp, query)
-	resp[2] = 0x81 // QR=1, AA=1
-	resp[3] = 0x82 // RA=1, RCODE=2 (Server Failure)
-	return resp
+// buildDNSServerFailure 构建 SERVFAIL 响应（上游全部失败），不是权威应答
+func buildDNSServerFailure(q *message) *message {
+	return q.reply(rcodeServerFailure, false)
 }
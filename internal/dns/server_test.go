@@ -0,0 +1,299 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+// buildQuery 构造只包含一个问题的标准查询报文
+func buildQuery(id uint16, name string, qtype uint16) []byte {
+	packet := make([]byte, 12)
+	binary.BigEndian.PutUint16(packet[0:2], id)
+	packet[2] = 0x01 // RD=1
+	binary.BigEndian.PutUint16(packet[4:6], 1)
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		packet = append(packet, byte(len(label)))
+		packet = append(packet, label...)
+	}
+	packet = append(packet, 0)
+	packet = binary.BigEndian.AppendUint16(packet, qtype)
+	return binary.BigEndian.AppendUint16(packet, 1) // Class: IN
+}
+
+func newTestServer() *Server {
+	server := NewServer("127.0.0.1:0", func(domain string) (string, bool) {
+		if domain == "pg.yygl.beijing.beagle" {
+			return "127.1.0.3", true
+		}
+		return "", false
+	})
+	server.SetRecordFunc(func(domain string) (*Record, bool) {
+		if domain != "pg.yygl.beijing.beagle" {
+			return nil, false
+		}
+		return &Record{Type: "k8ssvc", Agent: "beagle-242", Namespace: "yygl", Service: "pg", Region: "beijing", Ports: []int{5432, 8080}}, true
+	})
+	return server
+}
+
+// answerOf 返回查询的响应报文（忽略查询日志）
+func answerOf(s *Server, query []byte) []byte {
+	resp, _ := s.buildAnswer(query)
+	return resp
+}
+
+func TestAnswerARecordForBeagleDomain(t *testing.T) {
+	query := buildQuery(0x1234, "pg.yygl.beijing.beagle.", dnsTypeA)
+	resp := answerOf(newTestServer(), query)
+
+	if binary.BigEndian.Uint16(resp[0:2]) != 0x1234 {
+		t.Fatal("response must echo the query ID")
+	}
+	if resp[2]&0x80 == 0 || resp[3]&0x0f != 0 {
+		t.Fatalf("expected NOERROR response, got flags %#x %#x", resp[2], resp[3])
+	}
+	if binary.BigEndian.Uint16(resp[6:8]) != 1 {
+		t.Fatalf("expected one answer, got %d", binary.BigEndian.Uint16(resp[6:8]))
+	}
+	answer := resp[len(query):]
+	if binary.BigEndian.Uint16(answer[2:4]) != dnsTypeA || binary.BigEndian.Uint16(answer[10:12]) != 4 {
+		t.Fatalf("unexpected answer record: %x", answer)
+	}
+	if got := answer[12:16]; got[0] != 127 || got[1] != 1 || got[2] != 0 || got[3] != 3 {
+		t.Fatalf("unexpected VIP in answer: %v", got)
+	}
+}
+
+func TestAnswerAAAAForBeagleDomainIsAuthoritativeNoData(t *testing.T) {
+	query := buildQuery(7, "pg.yygl.beijing.beagle.", dnsTypeAAAA)
+	resp := answerOf(newTestServer(), query)
+
+	if resp[2]&0x04 == 0 {
+		t.Fatal("NODATA answer must be authoritative")
+	}
+	if rcode := resp[3] & 0x0f; rcode != 0 {
+		t.Fatalf("expected NOERROR, got rcode %d", rcode)
+	}
+	if binary.BigEndian.Uint16(resp[6:8]) != 0 {
+		t.Fatal("NODATA answer must not contain records")
+	}
+	if len(resp) != len(query) {
+		t.Fatalf("NODATA answer must only echo the question, got %d bytes", len(resp))
+	}
+}
+
+func TestAnswerAAAAForUnknownBeagleDomainIsNXDomain(t *testing.T) {
+	query := buildQuery(8, "missing.beagle.", dnsTypeAAAA)
+	resp := answerOf(newTestServer(), query)
+
+	if rcode := resp[3] & 0x0f; rcode != 3 {
+		t.Fatalf("expected NXDOMAIN, got rcode %d", rcode)
+	}
+}
+
+func TestMalformedQueryIsDropped(t *testing.T) {
+	if resp := answerOf(newTestServer(), []byte{0x00, 0x01, 0x01}); resp != nil {
+		t.Fatalf("expected malformed query to be dropped, got %x", resp)
+	}
+}
+
+// withOPT 为查询追加 EDNS0 OPT 记录
+func withOPT(query []byte, udpSize uint16) []byte {
+	query = append(query, 0x00, 0x00, 0x29, byte(udpSize>>8), byte(udpSize), 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint16(query[10:12], 1)
+	return query
+}
+
+func TestEDNSQueryGetsAnswerBeforeOPTRecord(t *testing.T) {
+	plain := buildQuery(9, "pg.yygl.beijing.beagle.", dnsTypeA)
+	query := withOPT(append([]byte(nil), plain...), 1232)
+	resp := answerOf(newTestServer(), query)
+
+	if an, ar := binary.BigEndian.Uint16(resp[6:8]), binary.BigEndian.Uint16(resp[10:12]); an != 1 || ar != 1 {
+		t.Fatalf("expected one answer and one OPT record, got an=%d ar=%d", an, ar)
+	}
+	// 应答记录必须紧跟问题段，而不是追加在查询的 OPT 记录之后
+	if rtype := binary.BigEndian.Uint16(resp[len(plain)+2 : len(plain)+4]); rtype != dnsTypeA {
+		t.Fatalf("expected A record right after the question, got type %d", rtype)
+	}
+	m, err := parseMessage(resp)
+	if err != nil || m.edns == nil || m.edns.udpSize != ednsUDPSize {
+		t.Fatalf("expected response OPT advertising %d, got %+v (err=%v)", ednsUDPSize, m.edns, err)
+	}
+}
+
+func TestUDPPayloadLimit(t *testing.T) {
+	plain := buildQuery(1, "example.com.", dnsTypeA)
+	if limit := udpPayloadLimit(plain); limit != maxUDPSize {
+		t.Fatalf("expected %d without EDNS, got %d", maxUDPSize, limit)
+	}
+	if limit := udpPayloadLimit(withOPT(append([]byte(nil), plain...), 256)); limit != maxUDPSize {
+		t.Fatalf("EDNS size below 512 must be raised to 512, got %d", limit)
+	}
+	if limit := udpPayloadLimit(withOPT(append([]byte(nil), plain...), 1232)); limit != 1232 {
+		t.Fatalf("expected advertised EDNS size, got %d", limit)
+	}
+}
+
+func TestTruncatedResponseKeepsQuestionAndSetsTC(t *testing.T) {
+	query := buildQuery(10, "big.example.com.", 16)
+	full := append(append([]byte(nil), query...), make([]byte, 1000)...)
+	full[2], full[3] = 0x81, 0x80
+	binary.BigEndian.PutUint16(full[6:8], 20)
+
+	resp := buildDNSTruncated(query, full)
+	if resp[2]&0x02 == 0 {
+		t.Fatal("truncated response must set TC")
+	}
+	if len(resp) != len(query) || binary.BigEndian.Uint16(resp[6:8]) != 0 {
+		t.Fatalf("truncated response must only carry the question, got %d bytes", len(resp))
+	}
+}
+
+func TestTCPConnAnswersLengthPrefixedQueries(t *testing.T) {
+	server := newTestServer()
+	clientConn, serverConn := net.Pipe()
+	go server.handleTCPConn(serverConn)
+	defer clientConn.Close()
+
+	for id := uint16(1); id <= 2; id++ {
+		if err := writeTCPMessage(clientConn, buildQuery(id, "pg.yygl.beijing.beagle.", dnsTypeA)); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := readTCPMessage(clientConn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if binary.BigEndian.Uint16(resp[0:2]) != id || binary.BigEndian.Uint16(resp[6:8]) != 1 {
+			t.Fatalf("unexpected TCP response for query %d: %x", id, resp)
+		}
+	}
+}
+
+func TestSRVForExposedPort(t *testing.T) {
+	query := buildQuery(11, "_5432._tcp.pg.yygl.beijing.beagle.", dnsTypeSRV)
+	resp := answerOf(newTestServer(), query)
+
+	if an, ar := binary.BigEndian.Uint16(resp[6:8]), binary.BigEndian.Uint16(resp[10:12]); an != 1 || ar != 1 {
+		t.Fatalf("expected one SRV answer and one additional A record, got an=%d ar=%d", an, ar)
+	}
+	srv := resp[len(query):]
+	if binary.BigEndian.Uint16(srv[2:4]) != dnsTypeSRV || binary.BigEndian.Uint16(srv[16:18]) != 5432 {
+		t.Fatalf("unexpected SRV record: %x", srv)
+	}
+	target := encodeName("pg.yygl.beijing.beagle")
+	if string(srv[18:18+len(target)]) != string(target) {
+		t.Fatal("SRV target must be the resource domain")
+	}
+	// 附加记录的名称会被压缩为指向问题段的指针，按解析结果检查
+	m, err := parseMessage(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := m.additional[0]; rr.name != "pg.yygl.beijing.beagle" || rr.rtype != dnsTypeA {
+		t.Fatalf("additional section must carry the target A record, got %+v", rr)
+	}
+}
+
+func TestSRVForNamedServiceAndUnexposedPort(t *testing.T) {
+	server := newTestServer()
+
+	resp := answerOf(server, buildQuery(12, "_http._tcp.pg.yygl.beijing.beagle.", dnsTypeSRV))
+	if an := binary.BigEndian.Uint16(resp[6:8]); an != 1 {
+		t.Fatalf("_http._tcp must map to the exposed 8080 port, got %d answers", an)
+	}
+
+	resp = answerOf(server, buildQuery(13, "_22._tcp.pg.yygl.beijing.beagle.", dnsTypeSRV))
+	if rcode := resp[3] & 0x0f; rcode != 3 {
+		t.Fatalf("unexposed port must be NXDOMAIN, got rcode %d", rcode)
+	}
+}
+
+func TestTXTDescribesResource(t *testing.T) {
+	query := buildQuery(14, "pg.yygl.beijing.beagle.", dnsTypeTXT)
+	resp := answerOf(newTestServer(), query)
+
+	if an := binary.BigEndian.Uint16(resp[6:8]); an != 1 {
+		t.Fatalf("expected one TXT record, got %d", an)
+	}
+	rdata := resp[len(query)+12:]
+	var got []string
+	for len(rdata) > 0 {
+		got = append(got, string(rdata[1:1+rdata[0]]))
+		rdata = rdata[1+rdata[0]:]
+	}
+	want := "type=k8ssvc agent=beagle-242 namespace=yygl service=pg region=beijing ports=5432,8080"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("unexpected TXT strings: %q", got)
+	}
+}
+
+func TestQueryLogRecordsOutcomes(t *testing.T) {
+	server := newTestServer()
+	server.respond(buildQuery(1, "pg.yygl.beijing.beagle.", dnsTypeA), "127.0.0.1:5000", "udp")
+	server.respond(buildQuery(2, "missing.beagle.", dnsTypeA), "127.0.0.1:5001", "udp")
+	server.respond(buildQuery(3, "pg.yygl.beijing.beagle.", dnsTypeAAAA), "127.0.0.1:5002", "tcp")
+
+	entries := server.QueryLog(QueryLogFilter{})
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	// 按时间倒序
+	if entries[0].Outcome != OutcomeNoData || entries[0].Type != "AAAA" || entries[0].Protocol != "tcp" {
+		t.Fatalf("unexpected newest entry: %+v", entries[0])
+	}
+	if entries[2].Outcome != OutcomeLocal || entries[2].Answer != "127.1.0.3" || entries[2].Client != "127.0.0.1:5000" {
+		t.Fatalf("unexpected oldest entry: %+v", entries[2])
+	}
+
+	nx := server.QueryLog(QueryLogFilter{Outcome: OutcomeNXDomain})
+	if len(nx) != 1 || nx[0].Name != "missing.beagle" {
+		t.Fatalf("outcome filter failed: %+v", nx)
+	}
+	if got := server.QueryLog(QueryLogFilter{Name: "YYGL", Limit: 1}); len(got) != 1 || got[0].Type != "AAAA" {
+		t.Fatalf("name filter with limit failed: %+v", got)
+	}
+}
+
+func TestQueryLogIsBounded(t *testing.T) {
+	j := newJournal(3)
+	for i := 0; i < 5; i++ {
+		j.add(&QueryLogEntry{Name: string(rune('a' + i))})
+	}
+	entries := j.list(QueryLogFilter{})
+	if len(entries) != 3 || entries[0].Name != "e" || entries[2].Name != "c" {
+		t.Fatalf("journal must keep the newest entries, got %+v", entries)
+	}
+}
+
+func TestPTRForAllocatedVIP(t *testing.T) {
+	server := newTestServer()
+	_, network, _ := net.ParseCIDR("127.1.0.0/16")
+	server.SetReverseFunc(func(vip string) (string, bool) {
+		if vip == "127.1.0.3" {
+			return "pg.yygl.beijing.beagle", true
+		}
+		return "", false
+	}, network)
+
+	resp := answerOf(server, buildQuery(1, "3.0.1.127.in-addr.arpa.", dnsTypePTR))
+	if resp[3]&0x0f != 0 || binary.BigEndian.Uint16(resp[6:8]) != 1 {
+		t.Fatalf("expected one PTR answer, got rcode %d ancount %d", resp[3]&0x0f, binary.BigEndian.Uint16(resp[6:8]))
+	}
+	if !bytes.HasSuffix(resp, encodeName("pg.yygl.beijing.beagle")) {
+		t.Fatalf("PTR rdata must be the domain, got %x", resp)
+	}
+
+	// VIP 地址段内未分配的地址本地返回 NXDOMAIN
+	if resp := answerOf(server, buildQuery(2, "9.0.1.127.in-addr.arpa.", dnsTypePTR)); resp[3]&0x0f != 3 {
+		t.Fatalf("expected NXDOMAIN for unallocated VIP, got rcode %d", resp[3]&0x0f)
+	}
+
+	// 地址段外的反向查询不由本地应答
+	if _, ok := server.reverseIP("1.0.0.127.in-addr.arpa"); ok {
+		t.Fatal("reverse query outside the VIP range must be forwarded")
+	}
+}
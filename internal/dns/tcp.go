@@ -0,0 +1,99 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+// tcpIdleTimeout TCP 连接空闲超时（RFC 7766 建议服务端主动关闭空闲连接）
+const tcpIdleTimeout = 10 * time.Second
+
+// serveTCP 接受 DNS TCP 连接
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.tcpListener.Accept()
+		if err != nil {
+			select {
+			case <-s.stopCh:
+				return
+			default:
+				log.Printf("[DNS] 接受 TCP 连接失败: %v", err)
+				continue
+			}
+		}
+		go s.handleTCPConn(conn)
+	}
+}
+
+// handleTCPConn 处理单个 TCP 连接，一个连接上可以顺序发送多个查询
+func (s *Server) handleTCPConn(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(tcpIdleTimeout))
+		packet, err := readTCPMessage(conn)
+		if err != nil {
+			return
+		}
+
+		resp := s.respond(packet, conn.RemoteAddr().String(), "tcp")
+		if resp == nil {
+			return
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(tcpIdleTimeout))
+		if err := writeTCPMessage(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+// forwardTCP 通过 TCP 向上游发送查询
+func forwardTCP(upstream string, packet []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", upstream, upstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(upstreamTimeout))
+
+	if err := writeTCPMessage(conn, packet); err != nil {
+		return nil, err
+	}
+	return readTCPMessage(conn)
+}
+
+// readTCPMessage 读取一个带 2 字节长度前缀的 DNS 报文
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var prefix [2]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint16(prefix[:])
+	if length == 0 {
+		return nil, fmt.Errorf("空 DNS 报文")
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// writeTCPMessage 写入一个带 2 字节长度前缀的 DNS 报文
+func writeTCPMessage(w io.Writer, packet []byte) error {
+	if len(packet) > maxMessageSize {
+		return fmt.Errorf("DNS 报文过长: %d", len(packet))
+	}
+	buf := make([]byte, 2+len(packet))
+	binary.BigEndian.PutUint16(buf[:2], uint16(len(packet)))
+	copy(buf[2:], packet)
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,367 @@
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// upstream.go 管理上游 DNS 服务器：按配置顺序转发，失败时切换到下一个，并记录每个上游的健康状态
+// 支持的地址格式：
+//   - 8.8.8.8 / 8.8.8.8:53 / udp://8.8.8.8:53：UDP（响应截断时自动改用 TCP）
+//   - tcp://8.8.8.8:53：仅 TCP
+//   - tls://1.1.1.1:853 / tls://dns.example.com：DNS over TLS（RFC 7858）
+//   - https://dns.google/dns-query：DNS over HTTPS（RFC 8484）
+
+// defaultUpstream 未配置且未探测到系统 DNS 时的兜底上游
+const defaultUpstream = "8.8.8.8:53"
+
+// 上游健康判定参数
+const (
+	unhealthyThreshold = 3                // 连续失败达到该次数后标记为不健康
+	unhealthyBackoff   = 30 * time.Second // 不健康的上游在该时间内排到最后尝试
+)
+
+// UpstreamStatus 上游 DNS 健康状态（用于状态展示）
+type UpstreamStatus struct {
+	Address             string    `json:"address"`              // 上游地址（配置原文）
+	Protocol            string    `json:"protocol"`             // udp / tcp / tls / https
+	Healthy             bool      `json:"healthy"`              // 是否健康
+	ConsecutiveFailures int       `json:"consecutive_failures"` // 连续失败次数
+	Queries             uint64    `json:"queries"`              // 查询总数
+	Failures            uint64    `json:"failures"`             // 失败总数
+	LastError           string    `json:"last_error,omitempty"` // 最近一次错误
+	LastFailure         time.Time `json:"last_failure"`         // 最近一次失败时间
+	LastSuccess         time.Time `json:"last_success"`         // 最近一次成功时间
+}
+
+// upstream 单个上游 DNS 服务器
+type upstream struct {
+	spec     string // 配置原文
+	protocol string // udp / tcp / tls / https
+	addr     string // host:port（https 为完整 URL）
+	host     string // TLS 证书校验用的主机名
+
+	// 健康状态（由 upstreamSet.mu 保护）
+	consecutiveFailures int
+	queries             uint64
+	failures            uint64
+	lastError           string
+	lastFailure         time.Time
+	lastSuccess         time.Time
+}
+
+// parseUpstream 解析上游地址配置
+func parseUpstream(spec string) (*upstream, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("上游地址为空")
+	}
+
+	u := &upstream{spec: spec, protocol: "udp"}
+	rest := spec
+	if i := strings.Index(spec, "://"); i >= 0 {
+		u.protocol = strings.ToLower(spec[:i])
+		rest = spec[i+3:]
+	}
+
+	switch u.protocol {
+	case "udp", "tcp":
+		u.addr = withDefaultPort(rest, "53")
+	case "tls":
+		u.addr = withDefaultPort(rest, "853")
+		u.host, _, _ = net.SplitHostPort(u.addr)
+	case "https":
+		u.addr = spec
+		u.host = strings.SplitN(rest, "/", 2)[0]
+	default:
+		return nil, fmt.Errorf("不支持的上游协议: %s", u.protocol)
+	}
+
+	if u.protocol != "https" {
+		if _, _, err := net.SplitHostPort(u.addr); err != nil {
+			return nil, fmt.Errorf("上游地址无效 %q: %w", spec, err)
+		}
+	}
+	return u, nil
+}
+
+// ValidateUpstream 检查上游地址配置是否有效
+func ValidateUpstream(spec string) error {
+	_, err := parseUpstream(spec)
+	return err
+}
+
+// withDefaultPort 地址未带端口时补上默认端口
+func withDefaultPort(addr, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), port)
+}
+
+// exchange 向该上游发送一次查询
+func (u *upstream) exchange(packet []byte) ([]byte, error) {
+	switch u.protocol {
+	case "tcp":
+		return forwardTCP(u.addr, packet)
+	case "tls":
+		return u.exchangeTLS(packet)
+	case "https":
+		return u.exchangeHTTPS(packet)
+	default:
+		return forwardUDP(u.addr, packet)
+	}
+}
+
+// exchangeTLS DNS over TLS：TLS 连接上使用与 TCP 相同的长度前缀格式
+func (u *upstream) exchangeTLS(packet []byte) ([]byte, error) {
+	dialer := &net.Dialer{Timeout: upstreamTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", u.addr, &tls.Config{ServerName: u.host})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(upstreamTimeout))
+
+	if err := writeTCPMessage(conn, packet); err != nil {
+		return nil, err
+	}
+	return readTCPMessage(conn)
+}
+
+// dohClient DNS over HTTPS 共用的 HTTP 客户端（复用连接）
+var dohClient = &http.Client{Timeout: upstreamTimeout}
+
+// exchangeHTTPS DNS over HTTPS：POST application/dns-message
+func (u *upstream) exchangeHTTPS(packet []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, u.addr, bytes.NewReader(packet))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := dohClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH 响应状态码 %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+}
+
+// forwardUDP 通过 UDP 向上游发送查询
+// 上游响应带 TC 标志时改用 TCP 重新查询，拿到完整响应
+func forwardUDP(addr string, packet []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", addr, upstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(upstreamTimeout))
+
+	if _, err := conn.Write(packet); err != nil {
+		return nil, err
+	}
+
+	// 之前超时的查询的迟到响应也可能送达，ID 或问题不符的报文丢弃后继续等待，直到超时
+	buf := make([]byte, maxMessageSize)
+	var resp []byte
+	for resp == nil {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if matchesQuery(packet, buf[:n]) {
+			resp = buf[:n]
+		}
+	}
+
+	if h, err := parseHeader(resp); err == nil && h.truncated {
+		log.Printf("[DNS] 上游响应被截断，改用 TCP 重试: %s", addr)
+		return forwardTCP(addr, packet)
+	}
+	return resp, nil
+}
+
+// matchesQuery 判断 resp 是否是 query 的响应：ID 相同且问题段一致（域名不区分大小写）
+// 只解析到问题段，被截断的响应也能匹配
+func matchesQuery(query, resp []byte) bool {
+	if len(query) < 12 || len(resp) < 12 || !bytes.Equal(resp[0:2], query[0:2]) {
+		return false
+	}
+	qs, _, err := readQuestions(query)
+	if err != nil {
+		return false
+	}
+	rs, _, err := readQuestions(resp)
+	if err != nil || len(rs) != len(qs) {
+		return false
+	}
+	for i, rq := range rs {
+		qq := qs[i]
+		if !strings.EqualFold(rq.name, qq.name) || rq.qtype != qq.qtype || rq.qclass != qq.qclass {
+			return false
+		}
+	}
+	return true
+}
+
+// upstreamSet 一组按顺序尝试的上游
+type upstreamSet struct {
+	upstreams []*upstream
+	mu        sync.Mutex
+}
+
+// newUpstreamSet 解析上游地址列表，无效地址记录日志后跳过
+func newUpstreamSet(specs []string) *upstreamSet {
+	set := &upstreamSet{}
+	for _, spec := range specs {
+		u, err := parseUpstream(spec)
+		if err != nil {
+			log.Printf("[DNS] 忽略无效上游 %q: %v", spec, err)
+			continue
+		}
+		set.upstreams = append(set.upstreams, u)
+	}
+	return set
+}
+
+// ordered 返回本次查询的尝试顺序：健康的上游按配置顺序在前，不健康的排在最后兜底
+func (s *upstreamSet) ordered() []*upstream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	healthy := make([]*upstream, 0, len(s.upstreams))
+	var unhealthy []*upstream
+	for _, u := range s.upstreams {
+		if u.isHealthy(now) {
+			healthy = append(healthy, u)
+		} else {
+			unhealthy = append(unhealthy, u)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// exchange 依次尝试各上游，返回第一个可用的响应
+// SERVFAIL / REFUSED 视为失败并继续尝试下一个上游；全部失败时返回最后一个收到的响应
+func (s *upstreamSet) exchange(packet []byte) ([]byte, error) {
+	upstreams := s.ordered()
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("未配置上游 DNS")
+	}
+
+	var lastResp []byte
+	var lastErr error
+	for _, u := range upstreams {
+		resp, err := u.exchange(packet)
+		var h header
+		if err == nil {
+			if h, err = parseHeader(resp); err != nil {
+				err = fmt.Errorf("上游响应过短")
+			}
+		}
+		if err == nil {
+			if h.rcode == rcodeServerFailure || h.rcode == rcodeRefused {
+				err = fmt.Errorf("上游返回 RCODE=%d", h.rcode)
+				lastResp = resp
+			}
+		}
+		s.record(u, err)
+		if err == nil {
+			return resp, nil
+		}
+		log.Printf("[DNS] 上游 %s 查询失败: %v", u.spec, err)
+		lastErr = err
+	}
+
+	if lastResp != nil {
+		return lastResp, nil
+	}
+	return nil, lastErr
+}
+
+// record 记录一次查询结果
+func (s *upstreamSet) record(u *upstream, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u.queries++
+	if err != nil {
+		u.failures++
+		u.consecutiveFailures++
+		u.lastError = err.Error()
+		u.lastFailure = time.Now()
+		return
+	}
+	u.consecutiveFailures = 0
+	u.lastSuccess = time.Now()
+}
+
+// status 返回所有上游的健康状态快照
+func (s *upstreamSet) status() []*UpstreamStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	result := make([]*UpstreamStatus, 0, len(s.upstreams))
+	for _, u := range s.upstreams {
+		result = append(result, &UpstreamStatus{
+			Address:             u.spec,
+			Protocol:            u.protocol,
+			Healthy:             u.isHealthy(now),
+			ConsecutiveFailures: u.consecutiveFailures,
+			Queries:             u.queries,
+			Failures:            u.failures,
+			LastError:           u.lastError,
+			LastFailure:         u.lastFailure,
+			LastSuccess:         u.lastSuccess,
+		})
+	}
+	return result
+}
+
+// isHealthy 连续失败未达阈值，或距最近一次失败已超过退避时间
+func (u *upstream) isHealthy(now time.Time) bool {
+	return u.consecutiveFailures < unhealthyThreshold || now.Sub(u.lastFailure) > unhealthyBackoff
+}
+
+// parseResolvConf 解析 resolv.conf 格式中的 nameserver 列表
+// exclude 中的地址（本地 DNS 服务器自身、systemd-resolved 存根）会被跳过，避免转发回环
+func parseResolvConf(data []byte, exclude ...string) []string {
+	skip := make(map[string]bool, len(exclude))
+	for _, ip := range exclude {
+		skip[ip] = true
+	}
+
+	var servers []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		ip := fields[1]
+		// 去掉 IPv6 链路本地地址的 zone（fe80::1%eth0）
+		host := strings.SplitN(ip, "%", 2)[0]
+		if net.ParseIP(host) == nil || skip[host] {
+			continue
+		}
+		servers = append(servers, net.JoinHostPort(ip, "53"))
+	}
+	return servers
+}
@@ -0,0 +1,137 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseUpstream(t *testing.T) {
+	cases := []struct {
+		spec, protocol, addr string
+	}{
+		{"10.0.0.53", "udp", "10.0.0.53:53"},
+		{"10.0.0.53:5353", "udp", "10.0.0.53:5353"},
+		{"2001:db8::1", "udp", "[2001:db8::1]:53"},
+		{"tcp://10.0.0.53", "tcp", "10.0.0.53:53"},
+		{"tls://1.1.1.1", "tls", "1.1.1.1:853"},
+		{"https://dns.google/dns-query", "https", "https://dns.google/dns-query"},
+	}
+	for _, c := range cases {
+		u, err := parseUpstream(c.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", c.spec, err)
+		}
+		if u.protocol != c.protocol || u.addr != c.addr {
+			t.Fatalf("%s: got %s %s", c.spec, u.protocol, u.addr)
+		}
+	}
+	for _, spec := range []string{"", "quic://1.1.1.1"} {
+		if _, err := parseUpstream(spec); err == nil {
+			t.Fatalf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestParseResolvConfSkipsLocalResolvers(t *testing.T) {
+	data := []byte("# generated\nnameserver 127.0.0.53\nnameserver 10.0.0.53\nnameserver fe80::1%eth0\nsearch corp\n")
+	servers := parseResolvConf(data, "127.0.0.53")
+	if len(servers) != 2 || servers[0] != "10.0.0.53:53" || servers[1] != "[fe80::1%eth0]:53" {
+		t.Fatalf("unexpected servers: %v", servers)
+	}
+}
+
+// startFakeUpstream 启动一个对所有查询返回固定 ANCOUNT 的 UDP 上游
+func startFakeUpstream(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, maxMessageSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query, err := parseMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(query.reply(rcodeSuccess, false).pack(), addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// deadUpstream 返回一个没有监听者的本地 UDP 地址
+func deadUpstream(t testing.TB) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+	return addr
+}
+
+func TestUpstreamFailoverAndHealthTracking(t *testing.T) {
+	dead, alive := deadUpstream(t), startFakeUpstream(t)
+	set := newUpstreamSet([]string{dead, alive})
+
+	for i := 0; i < unhealthyThreshold; i++ {
+		resp, err := set.exchange(buildQuery(uint16(i), "example.com.", dnsTypeA))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp[2]&0x80 == 0 {
+			t.Fatal("expected a response from the healthy upstream")
+		}
+	}
+
+	status := set.status()
+	if status[0].Healthy || status[0].ConsecutiveFailures != unhealthyThreshold {
+		t.Fatalf("dead upstream must be marked unhealthy: %+v", status[0])
+	}
+	if !status[1].Healthy || status[1].Queries != unhealthyThreshold {
+		t.Fatalf("alive upstream must stay healthy: %+v", status[1])
+	}
+	if ordered := set.ordered(); ordered[0].addr != alive {
+		t.Fatalf("unhealthy upstream must be tried last, got %s first", ordered[0].addr)
+	}
+
+	set.upstreams[0].lastFailure = time.Now().Add(-2 * unhealthyBackoff)
+	if ordered := set.ordered(); ordered[0].addr != dead {
+		t.Fatal("upstream must be retried in configured order after the backoff")
+	}
+}
+
+func TestForwardUDPIgnoresStaleReplies(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, maxMessageSize)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		// 先送达之前超时查询的迟到响应：ID 不同，或 ID 相同但问题不同，最后才是真正的响应
+		conn.WriteTo(upstreamReply(buildQuery(7, "stale.example.com.", dnsTypeA), 0), addr)
+		conn.WriteTo(upstreamReply(buildQuery(42, "stale.example.com.", dnsTypeA), 0), addr)
+		conn.WriteTo(upstreamReply(buf[:n], 0), addr)
+	}()
+
+	resp, err := forwardUDP(conn.LocalAddr().String(), buildQuery(42, "Example.com.", dnsTypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matchesQuery(buildQuery(42, "example.com.", dnsTypeA), resp) {
+		t.Fatalf("forwardUDP returned a reply to another query: %x", resp)
+	}
+}
@@ -0,0 +1,80 @@
+package dns
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+// zones.go 管理本地 DNS 拦截的内部域名后缀（zone）
+// 后缀由 Server 在认证时下发或由用户配置，默认只有 beagle；
+// 本地 DNS 应答、系统 DNS 注册（systemd-resolved / /etc/resolver / NRPT）和本地证书 SAN 都使用同一份列表
+
+// DefaultZone 未下发、未配置时使用的默认域名后缀
+const DefaultZone = "beagle"
+
+// zonePattern 合法的域名后缀：小写字母、数字和连字符组成的一个或多个标签
+// 后缀会写入系统配置和特权命令，必须严格校验
+var zonePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+
+// NormalizeZones 规范化域名后缀列表：去掉空白和首尾的点、转小写、去重，丢弃不合法的后缀
+// 结果为空时返回默认后缀
+func NormalizeZones(zones []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, zone := range zones {
+		zone = strings.ToLower(strings.Trim(strings.TrimSpace(zone), "."))
+		if zone == "" || seen[zone] {
+			continue
+		}
+		if !zonePattern.MatchString(zone) {
+			log.Printf("[DNS] 忽略无效的域名后缀: %q", zone)
+			continue
+		}
+		seen[zone] = true
+		result = append(result, zone)
+	}
+	if len(result) == 0 {
+		return []string{DefaultZone}
+	}
+	return result
+}
+
+// SplitZone 拆分域名为主机部分和所属后缀，不属于任何后缀时 ok 为 false
+// 后缀本身（如 beagle）也视为属于该后缀，主机部分为空
+func SplitZone(name string, zones []string) (host, zone string, ok bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, z := range zones {
+		if name == z {
+			return "", z, true
+		}
+		if strings.HasSuffix(name, "."+z) {
+			return strings.TrimSuffix(name, "."+z), z, true
+		}
+	}
+	return "", "", false
+}
+
+// SetZones 设置本地应答的域名后缀，属于这些后缀的查询不会转发到上游
+func (s *Server) SetZones(zones []string) {
+	zones = NormalizeZones(zones)
+
+	s.zonesMu.Lock()
+	s.zones = zones
+	s.zonesMu.Unlock()
+
+	log.Printf("[DNS] 本地域名后缀: %s", strings.Join(zones, ", "))
+}
+
+// Zones 返回本地应答的域名后缀
+func (s *Server) Zones() []string {
+	s.zonesMu.RLock()
+	defer s.zonesMu.RUnlock()
+	return s.zones
+}
+
+// isLocalName 域名是否属于本地应答的后缀
+func (s *Server) isLocalName(name string) bool {
+	_, _, ok := SplitZone(name, s.Zones())
+	return ok
+}
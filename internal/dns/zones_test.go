@@ -0,0 +1,43 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeZones(t *testing.T) {
+	got := NormalizeZones([]string{" .Corp.Internal. ", "beagle", "corp.internal", "bad zone", "x;rm -rf /", ""})
+	if strings.Join(got, ",") != "corp.internal,beagle" {
+		t.Fatalf("unexpected zones: %v", got)
+	}
+	if got := NormalizeZones(nil); len(got) != 1 || got[0] != DefaultZone {
+		t.Fatalf("empty list must fall back to the default zone, got %v", got)
+	}
+}
+
+func TestSplitZoneMatchesMultiLabelZones(t *testing.T) {
+	zones := []string{"corp.internal", "beagle"}
+	host, zone, ok := SplitZone("kubernetes.Beijing.corp.internal.", zones)
+	if !ok || host != "kubernetes.beijing" || zone != "corp.internal" {
+		t.Fatalf("unexpected split: %q %q %v", host, zone, ok)
+	}
+	if _, _, ok := SplitZone("evilcorp.internal", zones); ok {
+		t.Fatal("suffix match must respect label boundaries")
+	}
+}
+
+func TestCustomZoneIsAnsweredLocally(t *testing.T) {
+	server := NewServer("127.0.0.1:0", func(domain string) (string, bool) {
+		return "127.1.0.9", domain == "pg.corp.internal"
+	})
+	server.SetZones([]string{"corp.internal"})
+
+	resp := answerOf(server, buildQuery(1, "pg.corp.internal.", dnsTypeA))
+	if resp[3]&0x0f != 0 || resp[7] != 1 {
+		t.Fatalf("expected a local A answer, got rcode %d", resp[3]&0x0f)
+	}
+	resp = answerOf(server, buildQuery(2, "missing.corp.internal.", dnsTypeA))
+	if rcode := resp[3] & 0x0f; rcode != 3 {
+		t.Fatalf("unknown name in a custom zone must be NXDOMAIN, got rcode %d", rcode)
+	}
+}
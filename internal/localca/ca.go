@@ -0,0 +1,265 @@
+// Package localca 管理本地 CA，为本地 TLS 代理签发证书
+// CA 证书和私钥保存在应用目录，重启后保持不变，kubeconfig 通过 certificate-authority-data 信任它，
+// kubectl 不再需要 insecure-skip-tls-verify。
+// 叶子证书按域名 + VIP 签发，只保存在内存中，在到期前自动重新签发
+package localca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CA 和叶子证书的文件名、有效期
+const (
+	certFile = "ca.crt"
+	keyFile  = "ca.key"
+
+	caValidity      = 10 * 365 * 24 * time.Hour // CA 有效期
+	caRenewBefore   = 30 * 24 * time.Hour       // CA 剩余有效期不足时重新生成
+	leafValidity    = 30 * 24 * time.Hour       // 叶子证书有效期
+	leafRenewBefore = 7 * 24 * time.Hour        // 叶子证书剩余有效期不足时重新签发
+)
+
+// CA 本地证书颁发机构
+type CA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+
+	leaves map[string]*tls.Certificate // key: "域名|VIP"
+	mu     sync.Mutex
+
+	now func() time.Time // 测试时替换
+}
+
+// Load 读取 dir 中的 CA，不存在、损坏或即将过期时生成新的 CA 并保存
+func Load(dir string) (*CA, error) {
+	return load(dir, time.Now)
+}
+
+func load(dir string, now func() time.Time) (*CA, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建 CA 目录失败: %w", err)
+	}
+	ca := &CA{leaves: make(map[string]*tls.Certificate), now: now}
+
+	err := ca.read(dir)
+	if err == nil && ca.cert.NotAfter.Sub(now()) > caRenewBefore {
+		return ca, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("[LocalCA] 已有 CA 不可用，重新生成: %v", err)
+	} else if err == nil {
+		log.Printf("[LocalCA] CA 即将过期（%s），重新生成", ca.cert.NotAfter.Format(time.DateOnly))
+	}
+
+	if err := ca.generate(dir); err != nil {
+		return nil, err
+	}
+	log.Printf("[LocalCA] 已生成本地 CA: %s", filepath.Join(dir, certFile))
+	return ca, nil
+}
+
+// read 读取 CA 证书和私钥
+func (ca *CA) read(dir string) error {
+	certPEM, err := os.ReadFile(filepath.Join(dir, certFile))
+	if err != nil {
+		return err
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(dir, keyFile))
+	if err != nil {
+		return err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
+		return fmt.Errorf("CA 证书格式错误")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("解析 CA 证书失败: %w", err)
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil || keyBlock.Type != "EC PRIVATE KEY" {
+		return fmt.Errorf("CA 私钥格式错误")
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("解析 CA 私钥失败: %w", err)
+	}
+	if !cert.IsCA || !key.PublicKey.Equal(cert.PublicKey) {
+		return fmt.Errorf("CA 证书与私钥不匹配")
+	}
+
+	ca.cert, ca.key, ca.certPEM = cert, key, certPEM
+	return nil
+}
+
+// generate 生成新的 CA 并保存（私钥先写入，证书最后写入，中途失败时下次启动重新生成）
+func (ca *CA) generate(dir string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("生成 CA 私钥失败: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	commonName := "AWECloud Signaling Local CA"
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		commonName += " (" + hostname + ")"
+	}
+	now := ca.now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"AWECloud Signaling Desktop"},
+			CommonName:   commonName,
+		},
+		NotBefore:             now.Add(-time.Hour), // 容忍时钟偏差
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("创建 CA 证书失败: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("解析 CA 证书失败: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("序列化 CA 私钥失败: %w", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := writeFile(filepath.Join(dir, keyFile), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, certFile), certPEM); err != nil {
+		return err
+	}
+
+	ca.cert, ca.key, ca.certPEM = cert, key, certPEM
+	return nil
+}
+
+// CertPEM 返回 CA 证书（PEM），用于 kubeconfig 的 certificate-authority-data
+func (ca *CA) CertPEM() []byte {
+	return ca.certPEM
+}
+
+// Pool 返回只包含本地 CA 的证书池
+func (ca *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// Certificate 返回域名和 VIP 的叶子证书，没有或即将过期时重新签发
+// 适合在 tls.Config.GetCertificate 中调用，长期运行的代理也能按时更换证书
+func (ca *CA) Certificate(domain, ip string) (*tls.Certificate, error) {
+	key := domain + "|" + ip
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if cert, ok := ca.leaves[key]; ok && cert.Leaf.NotAfter.Sub(ca.now()) > leafRenewBefore {
+		return cert, nil
+	}
+	cert, err := ca.issue(domain, ip)
+	if err != nil {
+		return nil, err
+	}
+	ca.leaves[key] = cert
+	return cert, nil
+}
+
+// issue 签发叶子证书，SAN 包含域名、VIP 和 localhost
+func (ca *CA) issue(domain, ip string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成私钥失败: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := ca.now()
+	notAfter := now.Add(leafValidity)
+	if notAfter.After(ca.cert.NotAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"AWECloud Signaling Desktop"},
+			CommonName:   domain,
+		},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	if domain != "" {
+		template.DNSNames = append([]string{domain}, template.DNSNames...)
+	}
+	if addr := net.ParseIP(ip); addr != nil && !addr.Equal(net.IPv4(127, 0, 0, 1)) {
+		template.IPAddresses = append([]net.IP{addr}, template.IPAddresses...)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("签发证书失败: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("解析证书失败: %w", err)
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// randomSerial 生成 128 位随机序列号
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("生成证书序列号失败: %w", err)
+	}
+	return serial, nil
+}
+
+// writeFile 先写临时文件再重命名
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package localca
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadKeepsCAAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	first, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first.CertPEM()) != string(second.CertPEM()) {
+		t.Fatal("CA must be reused after restart")
+	}
+	info, err := os.Stat(filepath.Join(dir, keyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		t.Fatalf("CA key must be private, got %v", info.Mode().Perm())
+	}
+}
+
+func TestLoadReplacesBrokenOrExpiringCA(t *testing.T) {
+	dir := t.TempDir()
+	original, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 剩余有效期不足时重新生成
+	later := func() time.Time { return time.Now().Add(caValidity - caRenewBefore/2) }
+	renewed, err := load(dir, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(renewed.CertPEM()) == string(original.CertPEM()) {
+		t.Fatal("expiring CA must be replaced")
+	}
+
+	os.WriteFile(filepath.Join(dir, keyFile), []byte("garbage"), 0600)
+	if _, err := Load(dir); err != nil {
+		t.Fatalf("broken CA must be regenerated: %v", err)
+	}
+}
+
+func TestCertificateVerifiesForDomainAndVIP(t *testing.T) {
+	ca, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ca.Certificate("kubernetes.beijing.beagle", "127.1.0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"kubernetes.beijing.beagle", "127.1.0.5", "localhost"} {
+		if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: ca.Pool()}); err != nil {
+			t.Fatalf("certificate must be valid for %s: %v", name, err)
+		}
+	}
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "127.1.0.6", Roots: ca.Pool()}); err == nil {
+		t.Fatal("certificate must not be valid for another VIP")
+	}
+
+	again, _ := ca.Certificate("kubernetes.beijing.beagle", "127.1.0.5")
+	if again != cert {
+		t.Fatal("certificate must be cached until it is close to expiry")
+	}
+}
+
+func TestCertificateRotatesBeforeExpiry(t *testing.T) {
+	ca, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := ca.Certificate("kubernetes.beagle", "127.1.0.1")
+
+	ca.now = func() time.Time { return time.Now().Add(leafValidity - leafRenewBefore + time.Hour) }
+	rotated, err := ca.Certificate("kubernetes.beagle", "127.1.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated == first || !rotated.Leaf.NotAfter.After(first.Leaf.NotAfter) {
+		t.Fatal("certificate close to expiry must be re-issued")
+	}
+}
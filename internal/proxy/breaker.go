@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// breaker.go 拨号重试和熔断
+// 拨号失败时按指数退避加随机抖动重试几次（隧道刚建立、对端 NAT 打洞时偶发失败）；
+// 同一目标连续多个连接都拨号失败后熔断：冷却期内新连接立即关闭，不再每个都等待拨号超时。
+// 冷却期结束后放行一个试探连接，成功则恢复，失败则以加倍的冷却期再次熔断。
+// 熔断时通知调用方，调用方据此重新向 Server 解析域名（Agent 可能换了 IP）
+
+// 拨号重试参数
+const (
+	dialAttempts    = 3                          // 每个连接最多拨号次数
+	dialTimeout     = 10 * time.Second           // 每个连接的拨号总时间
+	attemptTimeout  = dialTimeout / dialAttempts // 单次拨号的超时，对端离线时拨号会一直挂起，不能让一次拨号用完总时间
+	dialBackoffBase = 200 * time.Millisecond     // 第一次重试前的等待时间，之后每次加倍
+)
+
+// 熔断参数
+const (
+	breakerThreshold   = 3                // 连续失败多少个连接后熔断
+	breakerCooldown    = 10 * time.Second // 第一次熔断的冷却期
+	breakerMaxCooldown = 2 * time.Minute  // 冷却期上限
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 正常
+	BreakerOpen     = "open"      // 熔断中，新连接立即失败
+	BreakerHalfOpen = "half-open" // 冷却期结束，正在用一个连接试探
+)
+
+// errBreakerOpen 熔断期间拒绝连接
+var errBreakerOpen = errors.New("目标熔断中")
+
+// breaker 单个目标的熔断器
+type breaker struct {
+	state     string
+	failures  int           // 连续失败的连接数
+	cooldown  time.Duration // 当前冷却期
+	openUntil time.Time     // 冷却期结束时间
+	probing   bool          // 半开状态下是否已有试探连接
+	mu        sync.Mutex
+}
+
+// allow 报告是否允许新连接拨号，熔断冷却期结束后只放行一个试探连接
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if now.Before(b.openUntil) {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// success 记录连接拨号成功，熔断器恢复
+func (b *breaker) success() {
+	b.mu.Lock()
+	b.state = BreakerClosed
+	b.failures = 0
+	b.cooldown = 0
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// failure 记录连接拨号失败，返回熔断器是否因此进入熔断
+func (b *breaker) failure(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen {
+		return false // 熔断前已开始拨号的连接，不重复计算冷却期
+	}
+	b.failures++
+	if b.state != BreakerHalfOpen && b.failures < breakerThreshold {
+		return false
+	}
+	// 试探失败或连续失败达到阈值：冷却期加倍
+	if b.cooldown == 0 {
+		b.cooldown = breakerCooldown
+	} else {
+		b.cooldown = min(b.cooldown*2, breakerMaxCooldown)
+	}
+	b.state = BreakerOpen
+	b.openUntil = now.Add(b.cooldown)
+	b.probing = false
+	return true
+}
+
+// release 放弃试探（试探连接没有得到结果），允许下一个连接试探
+func (b *breaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// status 返回熔断器状态和熔断结束时间
+func (b *breaker) status() (string, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == "" {
+		return BreakerClosed, time.Time{}
+	}
+	if b.state == BreakerOpen {
+		return b.state, b.openUntil
+	}
+	return b.state, time.Time{}
+}
+
+// SetOnBreakerOpen 设置熔断回调（在新协程中调用），调用方可重新解析域名并通过 UpdateRemote 更新远程地址
+func (m *Manager) SetOnBreakerOpen(onOpen func(Target)) {
+	m.mu.Lock()
+	m.onBreakerOpen = onOpen
+	m.mu.Unlock()
+}
+
+// UpdateRemote 更新 TCP 代理的远程地址并恢复熔断器，之后的新连接使用新地址；代理不存在时返回 false
+func (m *Manager) UpdateRemote(vip string, port int, remoteAddr string) bool {
+	m.mu.Lock()
+	e, ok := m.proxies[fmt.Sprintf("%s:%d", vip, port)]
+	if ok {
+		e.target.RemoteAddr = remoteAddr
+	}
+	m.mu.Unlock()
+	if ok {
+		e.breaker.success() // 旧地址的失败记录不再适用
+	}
+	return ok
+}
+
+// dialRemote 拨号远程，失败时退避重试，并更新熔断器
+func (m *Manager) dialRemote(ctx context.Context, e *entry, target Target) (net.Conn, error) {
+	if !e.breaker.allow(time.Now()) {
+		return nil, errBreakerOpen
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	var err error
+	for attempt := range dialAttempts {
+		if attempt > 0 {
+			select {
+			case <-dialCtx.Done():
+			case <-time.After(backoff(attempt)):
+			}
+		}
+		if dialCtx.Err() != nil {
+			break
+		}
+		attemptCtx, cancelAttempt := context.WithTimeout(dialCtx, attemptTimeout)
+		conn, dialErr := m.dial(attemptCtx, "tcp", target.RemoteAddr)
+		cancelAttempt()
+		if dialErr == nil {
+			e.breaker.success()
+			return conn, nil
+		}
+		err = dialErr
+	}
+	if ctx.Err() != nil {
+		// 连接被强制关闭或代理停止，不计入熔断
+		e.breaker.release()
+		return nil, ctx.Err()
+	}
+	if dialCtx.Err() != nil && err == nil {
+		err = dialCtx.Err()
+	}
+
+	if e.breaker.failure(time.Now()) {
+		_, until := e.breaker.status()
+		log.Printf("[Proxy] 目标熔断至 %s (%s → %s): %v", until.Format(time.TimeOnly), target.Domain, target.RemoteAddr, err)
+		m.mu.RLock()
+		onOpen := m.onBreakerOpen
+		m.mu.RUnlock()
+		if onOpen != nil {
+			go onOpen(target)
+		}
+	}
+	return nil, err
+}
+
+// backoff 返回第 attempt 次重试前的等待时间：指数退避，随机抖动 ±50%
+func backoff(attempt int) time.Duration {
+	d := dialBackoffBase << (attempt - 1)
+	return d/2 + rand.N(d)
+}
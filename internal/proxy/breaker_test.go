@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	var b breaker
+	now := time.Now()
+
+	for i := range breakerThreshold {
+		if !b.allow(now) {
+			t.Fatalf("connection %d rejected before the breaker opened", i)
+		}
+		if opened := b.failure(now); opened != (i == breakerThreshold-1) {
+			t.Fatalf("failure %d: opened = %v", i, opened)
+		}
+	}
+	if state, until := b.status(); state != BreakerOpen || !until.Equal(now.Add(breakerCooldown)) {
+		t.Fatalf("status = %s until %v, want open for %v", state, until, breakerCooldown)
+	}
+	if b.allow(now.Add(breakerCooldown - time.Second)) {
+		t.Fatal("connection allowed during the cooldown")
+	}
+
+	// 冷却期结束只放行一个试探连接，试探失败后冷却期加倍
+	later := now.Add(breakerCooldown)
+	if !b.allow(later) {
+		t.Fatal("probe rejected after the cooldown")
+	}
+	if b.allow(later) {
+		t.Fatal("second probe allowed while the first is in flight")
+	}
+	if !b.failure(later) {
+		t.Fatal("failed probe did not reopen the breaker")
+	}
+	if _, until := b.status(); !until.Equal(later.Add(2 * breakerCooldown)) {
+		t.Fatalf("reopened until %v, want doubled cooldown", until)
+	}
+
+	later = later.Add(2 * breakerCooldown)
+	if !b.allow(later) {
+		t.Fatal("probe rejected after the second cooldown")
+	}
+	b.success()
+	if state, _ := b.status(); state != BreakerClosed || !b.allow(later) || !b.allow(later) {
+		t.Fatalf("breaker %s after a successful probe, want closed", state)
+	}
+}
+
+func TestDialRetriesTransientFailures(t *testing.T) {
+	echo := tcpEcho(t)
+	var dials atomic.Int32
+	m := NewManager(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if dials.Add(1) < dialAttempts {
+			return nil, errors.New("no route yet")
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	})
+	t.Cleanup(m.StopAll)
+	target := Target{Domain: "pg.beagle", VIP: "127.0.0.1", Port: freePort(t), RemoteAddr: echo}
+	if err := m.StartProxy(target); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.VIP, strconv.Itoa(target.Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo = %q, %v after retries", buf, err)
+	}
+	if stats, _ := m.Stats(target); stats.DialFailures != 0 || stats.Breaker != BreakerClosed {
+		t.Fatalf("stats = %+v, want no failures and a closed breaker", stats)
+	}
+}
+
+func TestHangingDialIsRetried(t *testing.T) {
+	echo := tcpEcho(t)
+	var dials atomic.Int32
+	m := NewManager(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if dials.Add(1) == 1 {
+			// 对端离线时拨号一直挂起，直到超时
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	})
+	t.Cleanup(m.StopAll)
+	target := Target{Domain: "pg.beagle", VIP: "127.0.0.1", Port: freePort(t), RemoteAddr: echo}
+	if err := m.StartProxy(target); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.VIP, strconv.Itoa(target.Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo = %q, %v, want the retry to connect after the first dial timed out", buf, err)
+	}
+	if n := dials.Load(); n != 2 {
+		t.Fatalf("dialed %d times, want 2", n)
+	}
+}
+
+func TestBreakerFailsFastAndReresolves(t *testing.T) {
+	echo := tcpEcho(t)
+	var dials atomic.Int32
+	m := NewManager(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials.Add(1)
+		if addr != echo {
+			return nil, errors.New("peer offline")
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	})
+	t.Cleanup(m.StopAll)
+	opened := make(chan Target, 1)
+	m.SetOnBreakerOpen(func(target Target) { opened <- target })
+
+	target := Target{Domain: "pg.beagle", VIP: "127.0.0.1", Port: freePort(t), RemoteAddr: "100.64.0.9:5432"}
+	if err := m.StartProxy(target); err != nil {
+		t.Fatal(err)
+	}
+	addr := net.JoinHostPort(target.VIP, strconv.Itoa(target.Port))
+	connect := func() {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Read(make([]byte, 1)) // 等待代理关闭连接
+	}
+
+	for range breakerThreshold {
+		connect()
+	}
+	select {
+	case got := <-opened:
+		if got.Domain != target.Domain || got.RemoteAddr != target.RemoteAddr {
+			t.Fatalf("breaker callback got %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("breaker did not open")
+	}
+
+	stats, _ := m.Stats(target)
+	if stats.Breaker != BreakerOpen || stats.BreakerOpenUntil.IsZero() {
+		t.Fatalf("stats = %+v, want an open breaker", stats)
+	}
+	before := dials.Load()
+	start := time.Now()
+	connect()
+	if dials.Load() != before || time.Since(start) > time.Second {
+		t.Fatal("connection was not rejected immediately while the breaker is open")
+	}
+
+	// 重新解析到新地址后熔断器恢复，新连接使用新地址
+	if !m.UpdateRemote(target.VIP, target.Port, echo) {
+		t.Fatal("UpdateRemote did not find the proxy")
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ok"))
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ok" {
+		t.Fatalf("echo = %q, %v after UpdateRemote", buf, err)
+	}
+	if stats, _ := m.Stats(target); stats.Breaker != BreakerClosed {
+		t.Fatalf("breaker = %s after UpdateRemote, want closed", stats.Breaker)
+	}
+}
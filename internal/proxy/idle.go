@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// idle.go 空闲代理回收
+// 代理超过空闲时间没有新连接、且没有活动连接时停止监听，由调用方通过回调释放 VIP；
+// 域名下次被 DNS 解析时重新分配 VIP 并启动代理，对用户透明
+
+// DefaultIdleTimeout 默认的空闲回收时间
+const DefaultIdleTimeout = 30 * time.Minute
+
+// usage 代理的使用情况
+type usage struct {
+	lastUsed time.Time // 最后一次建立或关闭连接的时间
+	active   int       // 活动连接数
+	mu       sync.Mutex
+}
+
+// begin 记录一个新连接
+func (u *usage) begin() {
+	u.mu.Lock()
+	u.active++
+	u.lastUsed = time.Now()
+	u.mu.Unlock()
+}
+
+// end 记录一个连接关闭，空闲时间从最后一个连接关闭时开始计算
+func (u *usage) end() {
+	u.mu.Lock()
+	u.active--
+	u.lastUsed = time.Now()
+	u.mu.Unlock()
+}
+
+// idle 报告代理在 now 时是否已空闲超过 timeout
+func (u *usage) idle(now time.Time, timeout time.Duration) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.active == 0 && now.Sub(u.lastUsed) >= timeout
+}
+
+// reapInterval 返回空闲检查间隔：回收时间的四分之一，限制在 1 秒到 1 分钟之间
+func reapInterval(timeout time.Duration) time.Duration {
+	return min(max(timeout/4, time.Second), time.Minute)
+}
+
+// runReaper 每隔回收时间对应的检查间隔调用一次 reap，直到 ctx 结束
+// timeout 每轮重新读取，回收时间可以随时调整
+func runReaper(ctx context.Context, timeout func() time.Duration, reap func(now time.Time)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reapInterval(timeout())):
+		}
+		reap(time.Now())
+	}
+}
+
+// idleProxy 参与空闲回收的一个代理
+type idleProxy struct {
+	vip  string
+	idle func(now time.Time) bool // 在 now 时是否已空闲超过回收时间
+	stop func()                   // 从管理器中移除代理
+}
+
+// reapIdleProxies 对在 now 时可以回收的代理调用 stop
+// 同一 VIP 上的代理（同一域名的多个端口）只有全部空闲时才一起回收，避免 VIP 仍在使用而部分端口已停止
+func reapIdleProxies(proxies []idleProxy, now time.Time) {
+	busy := make(map[string]bool) // 有代理仍在使用的 VIP
+	for _, p := range proxies {
+		if !p.idle(now) {
+			busy[p.vip] = true
+		}
+	}
+	for _, p := range proxies {
+		if !busy[p.vip] {
+			p.stop()
+		}
+	}
+}
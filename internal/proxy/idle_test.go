@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// freePort 返回 127.0.0.1 上一个空闲的 TCP 端口
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func newIdleTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m := NewManager(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	})
+	m.idleTimeout = time.Minute
+	t.Cleanup(m.StopAll)
+	return m
+}
+
+func TestReapIdleStopsUnusedProxies(t *testing.T) {
+	m := newIdleTestManager(t)
+	idle := Target{Domain: "idle.beagle", VIP: "127.0.0.1", Port: freePort(t), RemoteAddr: "127.0.0.1:1"}
+	pinned := Target{Domain: "pinned.beagle", VIP: "127.0.0.2", Port: freePort(t), RemoteAddr: "127.0.0.1:1", KeepAlive: true}
+	for _, target := range []Target{idle, pinned} {
+		if err := m.StartProxy(target); err != nil {
+			t.Skipf("cannot listen on %s: %v", target.VIP, err)
+		}
+	}
+
+	if reaped := m.reapIdle(time.Now()); len(reaped) != 0 {
+		t.Fatalf("fresh proxies must not be reaped, got %v", reaped)
+	}
+	reaped := m.reapIdle(time.Now().Add(2 * time.Minute))
+	if len(reaped) != 1 || reaped[0].Domain != "idle.beagle" {
+		t.Fatalf("expected only the idle proxy to be reaped, got %v", reaped)
+	}
+	if m.Count() != 1 {
+		t.Fatalf("KeepAlive proxy must survive, got %d proxies", m.Count())
+	}
+}
+
+func TestReapIdleKeepsVIPWithActiveConnection(t *testing.T) {
+	m := newIdleTestManager(t)
+	first := Target{Domain: "svc.beagle", VIP: "127.0.0.1", Port: freePort(t), RemoteAddr: "127.0.0.1:1"}
+	second := first
+	second.Port = freePort(t)
+	for _, target := range []Target{first, second} {
+		if err := m.StartProxy(target); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 第一个端口有活动连接时，同一 VIP 上的其他端口也不回收
+	m.mu.RLock()
+	busy := m.proxies[fmt.Sprintf("%s:%d", first.VIP, first.Port)]
+	m.mu.RUnlock()
+	busy.begin()
+
+	later := time.Now().Add(2 * time.Minute)
+	if reaped := m.reapIdle(later); len(reaped) != 0 {
+		t.Fatalf("VIP with an active connection must not be reaped, got %v", reaped)
+	}
+
+	busy.end()
+	if reaped := m.reapIdle(time.Now().Add(2 * time.Minute)); len(reaped) != 2 {
+		t.Fatalf("expected both ports to be reaped together, got %v", reaped)
+	}
+}
@@ -1,4 +1,4 @@
-// Package proxy 提供本地 TCP 代理功能
+// Package proxy 提供本地 TCP / UDP 代理功能
 // 在 VIP 地址上监听，将流量通过 tsnet 转发到远程 Agent
 package proxy
 
@@ -10,6 +10,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -22,6 +23,9 @@ import (
 // DialFunc 通过 tsnet 拨号的函数签名
 type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
 
+// CertFunc 为 TLS 代理提供证书的函数签名（按域名和 VIP 签发，每次 TLS 握手时调用）
+type CertFunc func(domain, vip string) (*tls.Certificate, error)
+
 // Target 代理目标信息
 type Target struct {
 	Domain     string // 域名（如 pg.yygl.beijing.beagle）
@@ -29,6 +33,11 @@ type Target struct {
 	RemoteAddr string // 远程地址（Agent Tailscale IP:端口）
 	Port       int    // 监听端口（与远程端口相同）
 	TLS        bool   // 是否在本地做 TLS 终止（k8sapi 类型需要）
+	KeepAlive  bool   // 不参与空闲回收（生命周期由调用方管理，如 ContainerSSH 路由）
+	UDP        bool   // UDP 代理（由 StartUDPProxy 启动）
+
+	ProxyProtocol int  // 在远程连接上发送的 PROXY protocol 版本（1 / 2，0 不发送，仅 TCP）
+	ProxyTLV      bool // PROXY protocol v2 头部附加用户名和 Desktop ID TLV
 }
 
 // entry 单个代理实例
@@ -36,16 +45,29 @@ type entry struct {
 	target   Target
 	listener net.Listener
 	cancel   context.CancelFunc
-	lastUsed time.Time
-	mu       sync.Mutex
+	breaker  breaker
+	usage
+	traffic
 }
 
 // Manager 本地代理管理器
 // 管理多个 VIP:端口 → tsnet → Agent 的代理
 type Manager struct {
-	dial    DialFunc
-	proxies map[string]*entry // key: "vip:port"
-	mu      sync.RWMutex
+	dial     DialFunc
+	proxies  map[string]*entry // key: "vip:port"
+	zones    []string          // 内部域名后缀，用于本地 TLS 证书的 SAN
+	certs    CertFunc          // TLS 证书来源，为空时使用自签证书
+	identity IdentityFunc      // PROXY protocol 头部中的桌面身份
+	mu       sync.RWMutex
+
+	udpProxies        map[string]*udpEntry // UDP 代理，key: "vip:port"
+	udpSessionTimeout time.Duration        // UDP 会话空闲时间
+
+	idleTimeout time.Duration // 空闲回收时间，<= 0 时不回收
+	onIdle      func(Target)  // 代理被回收后调用
+	reaping     bool          // 回收协程是否已启动
+
+	onBreakerOpen func(Target) // 目标熔断后调用
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -58,14 +80,33 @@ func NewManager(dial DialFunc) *Manager {
 	return &Manager{
 		dial:    dial,
 		proxies: make(map[string]*entry),
+		zones:   []string{"beagle"},
 		ctx:     ctx,
 		cancel:  cancel,
+
+		udpProxies:        make(map[string]*udpEntry),
+		udpSessionTimeout: DefaultUDPSessionTimeout,
 	}
 }
 
+// SetZones 设置内部域名后缀，之后启动的 TLS 代理证书包含 *.<zone>
+func (m *Manager) SetZones(zones []string) {
+	m.mu.Lock()
+	m.zones = zones
+	m.mu.Unlock()
+}
+
+// SetCertFunc 设置 TLS 代理的证书来源（如本地 CA），之后启动的 TLS 代理生效
+func (m *Manager) SetCertFunc(certs CertFunc) {
+	m.mu.Lock()
+	m.certs = certs
+	m.mu.Unlock()
+}
+
 // StartProxy 启动一个本地代理
 // 在 vip:port 上监听，转发到 remoteAddr
-// 如果 target.TLS 为 true，使用自签证书做 TLS 终止（用于 k8sapi，kubectl 需要 HTTPS）
+// 如果 target.TLS 为 true，在本地做 TLS 终止（用于 k8sapi，kubectl 需要 HTTPS）：
+// 设置了证书来源时使用其签发的证书，否则使用自签证书
 func (m *Manager) StartProxy(target Target) error {
 	key := fmt.Sprintf("%s:%d", target.VIP, target.Port)
 
@@ -83,17 +124,14 @@ func (m *Manager) StartProxy(target Target) error {
 		return fmt.Errorf("监听 %s 失败: %w", listenAddr, err)
 	}
 
-	// 如果需要 TLS 终止，用自签证书包装 listener
-	// kubectl 使用 --insecure-skip-tls-verify 跳过证书验证
+	// 如果需要 TLS 终止，用 TLS 包装 listener
 	if target.TLS {
-		tlsCert, err := generateSelfSignedCert()
+		tlsConfig, err := m.tlsConfig(target)
 		if err != nil {
 			listener.Close()
-			return fmt.Errorf("生成自签证书失败: %w", err)
+			return err
 		}
-		listener = tls.NewListener(listener, &tls.Config{
-			Certificates: []tls.Certificate{tlsCert},
-		})
+		listener = tls.NewListener(listener, tlsConfig)
 		log.Printf("[Proxy] TLS 终止已启用: %s", listenAddr)
 	}
 
@@ -102,7 +140,7 @@ func (m *Manager) StartProxy(target Target) error {
 		target:   target,
 		listener: listener,
 		cancel:   cancel,
-		lastUsed: time.Now(),
+		usage:    usage{lastUsed: time.Now()},
 	}
 
 	m.mu.Lock()
@@ -143,29 +181,85 @@ func (m *Manager) StopAll() {
 		e.listener.Close()
 		delete(m.proxies, key)
 	}
+	udpProxies := m.udpProxies
+	m.udpProxies = make(map[string]*udpEntry)
 	m.mu.Unlock()
 
+	for _, e := range udpProxies {
+		e.close()
+	}
+
 	m.wg.Wait()
 	log.Printf("[Proxy] 所有代理已停止")
 }
 
-// GetStatus 获取所有代理状态
+// GetStatus 获取所有代理状态（包括 UDP 代理，Target.UDP 为 true）
 func (m *Manager) GetStatus() []Target {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	result := make([]Target, 0, len(m.proxies))
+	result := make([]Target, 0, len(m.proxies)+len(m.udpProxies))
 	for _, e := range m.proxies {
 		result = append(result, e.target)
 	}
+	for _, e := range m.udpProxies {
+		result = append(result, e.target)
+	}
+	return result
+}
+
+// Stats 获取代理的流量统计，代理不存在时返回 false（target.UDP 为 true 时查找 UDP 代理）
+func (m *Manager) Stats(target Target) (Stats, bool) {
+	key := fmt.Sprintf("%s:%d", target.VIP, target.Port)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if target.UDP {
+		if e, ok := m.udpProxies[key]; ok {
+			return e.snapshot(), true
+		}
+		return Stats{}, false
+	}
+	if e, ok := m.proxies[key]; ok {
+		s := e.snapshot()
+		s.Breaker, s.BreakerOpenUntil = e.breaker.status()
+		return s, true
+	}
+	return Stats{}, false
+}
+
+// CloseConn 强制关闭指定 ID 的活动连接（UDP 为会话），代理继续监听；连接不存在时返回 false
+func (m *Manager) CloseConn(id uint64) bool {
+	return closeConn(m.trafficOf(""), id)
+}
+
+// CloseDomainConns 强制关闭域名的全部活动连接，代理继续监听，返回关闭的连接数
+func (m *Manager) CloseDomainConns(domain string) int {
+	return closeAll(m.trafficOf(domain))
+}
+
+// trafficOf 返回域名下全部代理（TCP 和 UDP）的计数，domain 为空时返回全部代理的计数
+func (m *Manager) trafficOf(domain string) []*traffic {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []*traffic
+	for _, e := range m.proxies {
+		if domain == "" || e.target.Domain == domain {
+			result = append(result, &e.traffic)
+		}
+	}
+	for _, e := range m.udpProxies {
+		if domain == "" || e.target.Domain == domain {
+			result = append(result, &e.traffic)
+		}
+	}
 	return result
 }
 
-// Count 获取运行中的代理数量
+// Count 获取运行中的代理数量（包括 UDP 代理）
 func (m *Manager) Count() int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return len(m.proxies)
+	return len(m.proxies) + len(m.udpProxies)
 }
 
 // acceptLoop 接受连接循环
@@ -190,30 +284,137 @@ func (m *Manager) acceptLoop(ctx context.Context, e *entry) {
 			}
 		}
 
-		// 更新最后使用时间
-		e.mu.Lock()
-		e.lastUsed = time.Now()
-		e.mu.Unlock()
+		// 更新最后使用时间和活动连接数
+		e.begin()
+		connCtx, connCancel := context.WithCancel(ctx)
+		cc := e.countConn(conn, connCancel)
+		go func() {
+			defer e.end()
+			defer cc.done()
+			defer connCancel()
+			m.handleConn(connCtx, cc, e)
+		}()
+	}
+}
+
+// SetIdleTimeout 设置空闲回收时间，timeout <= 0 时不回收
+// 代理超过 timeout 没有新连接且没有活动连接时停止监听，之后调用 onIdle（调用方据此释放 VIP）
+func (m *Manager) SetIdleTimeout(timeout time.Duration, onIdle func(Target)) {
+	m.mu.Lock()
+	m.idleTimeout = timeout
+	m.onIdle = onIdle
+	start := timeout > 0 && !m.reaping
+	m.reaping = m.reaping || start
+	m.mu.Unlock()
+
+	if start {
+		m.wg.Add(1)
+		go m.reapLoop()
+	}
+}
+
+// reapLoop 定期回收空闲代理，直到 StopAll
+func (m *Manager) reapLoop() {
+	defer m.wg.Done()
+	timeout := func() time.Duration {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		return m.idleTimeout
+	}
+	runReaper(m.ctx, timeout, func(now time.Time) {
+		targets := m.reapIdle(now)
+		m.mu.RLock()
+		onIdle := m.onIdle
+		m.mu.RUnlock()
+		for _, target := range targets {
+			if onIdle != nil {
+				onIdle(target)
+			}
+		}
+	})
+}
+
+// reapIdle 停止在 now 时已空闲超过回收时间的代理（常驻代理除外），返回被停止的代理
+func (m *Manager) reapIdle(now time.Time) []Target {
+	m.mu.Lock()
+	if m.idleTimeout <= 0 {
+		m.mu.Unlock()
+		return nil
+	}
+	var reaped []*entry
+	var reapedUDP []*udpEntry
+	candidates := make([]idleProxy, 0, len(m.proxies)+len(m.udpProxies))
+	for key, e := range m.proxies {
+		candidates = append(candidates, idleProxy{
+			vip:  e.target.VIP,
+			idle: func(now time.Time) bool { return !e.target.KeepAlive && e.idle(now, m.idleTimeout) },
+			stop: func() {
+				delete(m.proxies, key)
+				reaped = append(reaped, e)
+			},
+		})
+	}
+	for key, e := range m.udpProxies {
+		candidates = append(candidates, idleProxy{
+			vip:  e.target.VIP,
+			idle: func(now time.Time) bool { return !e.target.KeepAlive && e.idle(now, m.idleTimeout) },
+			stop: func() {
+				delete(m.udpProxies, key)
+				reapedUDP = append(reapedUDP, e)
+			},
+		})
+	}
+	reapIdleProxies(candidates, now)
+	m.mu.Unlock()
 
-		go m.handleConn(ctx, conn, e.target)
+	targets := make([]Target, 0, len(reaped)+len(reapedUDP))
+	for _, e := range reaped {
+		e.cancel()
+		e.listener.Close()
+		log.Printf("[Proxy] 空闲回收: %s:%d (%s)", e.target.VIP, e.target.Port, e.target.Domain)
+		targets = append(targets, e.target)
+	}
+	for _, e := range reapedUDP {
+		e.close()
+		log.Printf("[Proxy] 空闲回收: UDP %s:%d (%s)", e.target.VIP, e.target.Port, e.target.Domain)
+		targets = append(targets, e.target)
 	}
+	return targets
 }
 
 // handleConn 处理单个连接
-func (m *Manager) handleConn(ctx context.Context, clientConn net.Conn, target Target) {
+func (m *Manager) handleConn(ctx context.Context, clientConn net.Conn, e *entry) {
 	defer clientConn.Close()
+	// 远程地址可能被 UpdateRemote 更新
+	m.mu.RLock()
+	target := e.target
+	m.mu.RUnlock()
 
-	// 通过 tsnet 拨号到远程 Agent
-	dialCtx, dialCancel := context.WithTimeout(ctx, 10*time.Second)
-	defer dialCancel()
-
-	remoteConn, err := m.dial(dialCtx, "tcp", target.RemoteAddr)
+	// 通过 tsnet 拨号到远程 Agent，失败时重试；目标熔断中时立即关闭客户端连接
+	remoteConn, err := m.dialRemote(ctx, e, target)
 	if err != nil {
+		if ctx.Err() != nil {
+			return // 连接被强制关闭或代理停止
+		}
+		if errors.Is(err, errBreakerOpen) {
+			e.fail(err, false)
+			return
+		}
 		log.Printf("[Proxy] 连接远程失败 (%s → %s): %v", target.Domain, target.RemoteAddr, err)
+		e.fail(fmt.Errorf("连接 %s 失败: %w", target.RemoteAddr, err), true)
 		return
 	}
 	defer remoteConn.Close()
 
+	// 远程要求 PROXY protocol 时先发送头部，携带桌面的隧道 IP 和身份
+	if target.ProxyProtocol != 0 {
+		if err := m.writeProxyHeader(remoteConn, clientConn.RemoteAddr(), target); err != nil {
+			log.Printf("[Proxy] PROXY protocol 头部发送失败 (%s): %v", target.Domain, err)
+			e.fail(err, false)
+			return
+		}
+	}
+
 	// 双向转发，等待两个方向都完成
 	done := make(chan struct{}, 2)
 	go func() {
@@ -245,16 +446,48 @@ func (m *Manager) handleConn(ctx context.Context, clientConn net.Conn, target Ta
 	}
 }
 
+// tlsConfig 返回 TLS 代理的配置
+// 有证书来源时每次握手取证书，证书到期前由来源更换；否则生成自签证书（kubectl 需要 --insecure-skip-tls-verify）
+func (m *Manager) tlsConfig(target Target) (*tls.Config, error) {
+	m.mu.RLock()
+	zones, certs := m.zones, m.certs
+	m.mu.RUnlock()
+
+	if certs != nil {
+		// 启动时先签发一次，证书来源不可用时直接报错而不是在握手时失败
+		if _, err := certs(target.Domain, target.VIP); err != nil {
+			return nil, fmt.Errorf("签发 TLS 证书失败: %w", err)
+		}
+		return &tls.Config{
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return certs(target.Domain, target.VIP)
+			},
+		}, nil
+	}
+
+	tlsCert, err := generateSelfSignedCert(zones)
+	if err != nil {
+		return nil, fmt.Errorf("生成自签证书失败: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{tlsCert}}, nil
+}
+
 // generateSelfSignedCert 生成自签 TLS 证书
-// 用于 K8S API 代理的本地 TLS 终止
+// 没有本地 CA 时用于 K8S API 代理的本地 TLS 终止
 // kubectl 使用 --insecure-skip-tls-verify 跳过证书验证
-func generateSelfSignedCert() (tls.Certificate, error) {
+// zones 为内部域名后缀，每个后缀生成一个 *.<zone> SAN
+func generateSelfSignedCert(zones []string) (tls.Certificate, error) {
 	// 生成 ECDSA 私钥
 	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		return tls.Certificate{}, fmt.Errorf("生成私钥失败: %w", err)
 	}
 
+	dnsNames := []string{"localhost"}
+	for _, zone := range zones {
+		dnsNames = append(dnsNames, "*."+zone)
+	}
+
 	// 创建证书模板
 	template := x509.Certificate{
 		SerialNumber: big.NewInt(1),
@@ -266,7 +499,7 @@ func generateSelfSignedCert() (tls.Certificate, error) {
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
-		DNSNames:              []string{"localhost", "*.beagle"},
+		DNSNames:              dnsNames,
 		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
 	}
 
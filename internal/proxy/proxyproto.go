@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+
+	proxyproto "github.com/pires/go-proxyproto"
+)
+
+// proxyproto.go 远程连接上的 PROXY protocol 头部
+// Agent 后面的服务看到的来源地址都是 Agent，堡垒机、数据库的审计日志无法区分是哪个桌面用户连接的。
+// 开启后拨通远程立即发送 PROXY protocol 头部，来源地址为桌面的隧道 IP（端口为本地客户端的端口），
+// 目标地址为远程地址；v2 可以附加自定义 TLV 携带用户名和 Desktop ID
+
+// PROXY protocol v2 自定义 TLV 类型（0xE0-0xEF 为应用自定义范围）
+const (
+	TLVUser    proxyproto.PP2Type = 0xE0 // 用户名
+	TLVDesktop proxyproto.PP2Type = 0xE1 // Desktop ID（十进制）
+)
+
+// Identity 桌面在 PROXY protocol 头部中的身份
+type Identity struct {
+	TunnelIP  string // 桌面的隧道 IP
+	User      string // 用户名
+	DesktopID uint64 // Desktop ID
+}
+
+// IdentityFunc 返回当前桌面身份的函数签名（隧道重连后 IP 可能变化，每个连接取一次）
+type IdentityFunc func() Identity
+
+// SetIdentityFunc 设置 PROXY protocol 头部使用的桌面身份来源
+func (m *Manager) SetIdentityFunc(identity IdentityFunc) {
+	m.mu.Lock()
+	m.identity = identity
+	m.mu.Unlock()
+}
+
+// ParseProxyProtocol 解析 Server 下发的 PROXY protocol 版本（v1 / v2 / 1 / 2），为空或无法识别时返回 0（不发送）
+func ParseProxyProtocol(version string) int {
+	switch version {
+	case "v1", "V1", "1":
+		return 1
+	case "v2", "V2", "2":
+		return 2
+	default:
+		return 0
+	}
+}
+
+// writeProxyHeader 在远程连接上发送 PROXY protocol 头部
+func (m *Manager) writeProxyHeader(w io.Writer, client net.Addr, target Target) error {
+	m.mu.RLock()
+	identity := m.identity
+	m.mu.RUnlock()
+	if identity == nil {
+		return fmt.Errorf("未设置桌面身份")
+	}
+	header, err := buildProxyHeader(identity(), client, target)
+	if err != nil {
+		return err
+	}
+	if _, err := header.WriteTo(w); err != nil {
+		return fmt.Errorf("发送 PROXY protocol 头部失败: %w", err)
+	}
+	return nil
+}
+
+// buildProxyHeader 构建 PROXY protocol 头部
+func buildProxyHeader(identity Identity, client net.Addr, target Target) (*proxyproto.Header, error) {
+	if target.ProxyProtocol != 1 && target.ProxyProtocol != 2 {
+		return nil, fmt.Errorf("不支持的 PROXY protocol 版本: %d", target.ProxyProtocol)
+	}
+	tunnelIP, err := netip.ParseAddr(identity.TunnelIP)
+	if err != nil {
+		return nil, fmt.Errorf("隧道 IP 无效 %q: %w", identity.TunnelIP, err)
+	}
+	remote, err := netip.ParseAddrPort(target.RemoteAddr)
+	if err != nil {
+		return nil, fmt.Errorf("远程地址无效 %q: %w", target.RemoteAddr, err)
+	}
+	if tunnelIP.Is4() != remote.Addr().Unmap().Is4() {
+		return nil, fmt.Errorf("隧道 IP %s 与远程地址 %s 的地址族不同", tunnelIP, remote)
+	}
+
+	var sourcePort int
+	if tcp, ok := client.(*net.TCPAddr); ok {
+		sourcePort = tcp.Port
+	}
+	header := proxyproto.HeaderProxyFromAddrs(byte(target.ProxyProtocol),
+		&net.TCPAddr{IP: tunnelIP.AsSlice(), Port: sourcePort},
+		net.TCPAddrFromAddrPort(netip.AddrPortFrom(remote.Addr().Unmap(), remote.Port())))
+
+	// v1 没有 TLV
+	if target.ProxyProtocol == 2 && target.ProxyTLV {
+		var tlvs []proxyproto.TLV
+		if identity.User != "" {
+			tlvs = append(tlvs, proxyproto.TLV{Type: TLVUser, Value: []byte(identity.User)})
+		}
+		if identity.DesktopID != 0 {
+			tlvs = append(tlvs, proxyproto.TLV{Type: TLVDesktop, Value: []byte(strconv.FormatUint(identity.DesktopID, 10))})
+		}
+		if err := header.SetTLVs(tlvs); err != nil {
+			return nil, fmt.Errorf("构建 PROXY protocol TLV 失败: %w", err)
+		}
+	}
+	return header, nil
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	proxyproto "github.com/pires/go-proxyproto"
+)
+
+// proxyBackend 启动一个读取 PROXY protocol 头部后回显数据的 TCP 服务，收到的头部发送到返回的通道
+func proxyBackend(t *testing.T) (string, <-chan *proxyproto.Header) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	headers := make(chan *proxyproto.Header, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		header, err := proxyproto.Read(reader)
+		if err != nil {
+			header = nil
+		}
+		headers <- header
+		io.Copy(conn, reader)
+	}()
+	return l.Addr().String(), headers
+}
+
+func TestProxyProtocolHeaderCarriesDesktopIdentity(t *testing.T) {
+	for _, version := range []int{1, 2} {
+		t.Run("v"+strconv.Itoa(version), func(t *testing.T) {
+			m := newIdleTestManager(t)
+			m.SetIdentityFunc(func() Identity {
+				return Identity{TunnelIP: "100.64.0.7", User: "alice@example.com", DesktopID: 42}
+			})
+			remote, headers := proxyBackend(t)
+			target := Target{Domain: "bastion.beagle", VIP: "127.0.0.1", Port: freePort(t), RemoteAddr: remote,
+				ProxyProtocol: version, ProxyTLV: true}
+			if err := m.StartProxy(target); err != nil {
+				t.Fatal(err)
+			}
+
+			conn, err := net.Dial("tcp", net.JoinHostPort(target.VIP, strconv.Itoa(target.Port)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.Write([]byte("ping"))
+			buf := make([]byte, 4)
+			if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+				t.Fatalf("payload must follow the header unchanged, got %q: %v", buf, err)
+			}
+
+			header := <-headers
+			if header == nil || int(header.Version) != version {
+				t.Fatalf("expected a v%d header, got %+v", version, header)
+			}
+			source := header.SourceAddr.(*net.TCPAddr)
+			if source.IP.String() != "100.64.0.7" || source.Port != conn.LocalAddr().(*net.TCPAddr).Port {
+				t.Fatalf("source must be the tunnel IP with the client port, got %s", source)
+			}
+			if header.DestinationAddr.String() != remote {
+				t.Fatalf("destination must be the remote address, got %s", header.DestinationAddr)
+			}
+
+			tlvs, _ := header.TLVs()
+			if version == 1 {
+				if len(tlvs) != 0 {
+					t.Fatalf("v1 has no TLVs, got %v", tlvs)
+				}
+				return
+			}
+			values := map[proxyproto.PP2Type]string{}
+			for _, tlv := range tlvs {
+				values[tlv.Type] = string(tlv.Value)
+			}
+			if values[TLVUser] != "alice@example.com" || values[TLVDesktop] != "42" {
+				t.Fatalf("unexpected TLVs %v", values)
+			}
+		})
+	}
+}
+
+func TestBuildProxyHeaderRejectsUnknownTunnelIP(t *testing.T) {
+	target := Target{RemoteAddr: "100.64.0.9:22", ProxyProtocol: 2}
+	if _, err := buildProxyHeader(Identity{}, &net.TCPAddr{}, target); err == nil {
+		t.Fatal("a header without the tunnel IP must not be sent")
+	}
+	if _, err := buildProxyHeader(Identity{TunnelIP: "fd7a:115c:a1e0::1"}, &net.TCPAddr{}, target); err == nil {
+		t.Fatal("mixed address families must be rejected")
+	}
+}
+
+func TestParseProxyProtocol(t *testing.T) {
+	for input, want := range map[string]int{"v1": 1, "2": 2, "V2": 2, "": 0, "v3": 0} {
+		if got := ParseProxyProtocol(input); got != want {
+			t.Fatalf("ParseProxyProtocol(%q) = %d, want %d", input, got, want)
+		}
+	}
+}
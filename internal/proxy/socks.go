@@ -0,0 +1,329 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"tailscale.com/net/socks5"
+)
+
+// socks.go 本地 SOCKS5 代理
+// 自带 DNS 解析的应用（Java、启用 DoH 的 Firefox、Docker 构建）不走系统 DNS，无法通过 VIP 访问内部资源；
+// 这些应用可以配置 SOCKS5 代理，由代理按目标地址拨号。协议处理使用 tailscale 的 socks5 实现，
+// 目标地址的解析和访问范围由调用方的拨号函数决定。
+// 配置中只保存密码的哈希，用户名密码认证（RFC 1929）由 socksConn 完成，socks5.Server 只处理认证之后的请求
+
+// SOCKSServer 本地 SOCKS5 代理
+type SOCKSServer struct {
+	dial     DialFunc
+	listener net.Listener
+	auth     bool // 是否要求用户名密码认证
+	mu       sync.Mutex
+	traffic
+}
+
+// NewSOCKSServer 创建 SOCKS5 代理，CONNECT 的目标地址（域名或 IP）原样交给 dial
+func NewSOCKSServer(dial DialFunc) *SOCKSServer {
+	return &SOCKSServer{dial: dial}
+}
+
+// Start 在 addr 上监听，username 非空时要求用户名密码认证，密码按 passwordHash（HashSOCKSPassword 的结果）校验
+func (s *SOCKSServer) Start(addr, username, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener != nil {
+		return fmt.Errorf("SOCKS5 代理已在运行: %s", s.listener.Addr())
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("监听 %s 失败: %w", addr, err)
+	}
+	srv := &socks5.Server{
+		Logf:   func(format string, args ...any) { log.Printf("[SOCKS5] "+format, args...) },
+		Dialer: s.dialTarget,
+	}
+	var creds *socksCredentials
+	if username != "" {
+		creds = &socksCredentials{username: username, passwordHash: passwordHash}
+	}
+	s.listener = l
+	s.auth = creds != nil
+	go srv.Serve(&socksListener{Listener: l, server: s, creds: creds})
+
+	log.Printf("[SOCKS5] 已启动: %s (认证: %v)", l.Addr(), s.auth)
+	return nil
+}
+
+// Stop 停止监听并关闭全部连接
+func (s *SOCKSServer) Stop() {
+	s.mu.Lock()
+	l := s.listener
+	s.listener = nil
+	s.mu.Unlock()
+
+	if l != nil {
+		l.Close()
+		s.killAll()
+		log.Printf("[SOCKS5] 已停止")
+	}
+}
+
+// Addr 返回监听地址，未运行时返回空字符串
+func (s *SOCKSServer) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Auth 报告是否要求用户名密码认证
+func (s *SOCKSServer) Auth() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.auth
+}
+
+// Stats 获取流量统计（活动连接为 SOCKS5 客户端连接）
+func (s *SOCKSServer) Stats() Stats {
+	return s.snapshot()
+}
+
+// dialTarget 拨号 CONNECT 的目标，失败时记录
+func (s *SOCKSServer) dialTarget(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := s.dial(ctx, network, addr)
+	if err != nil {
+		log.Printf("[SOCKS5] 连接 %s 失败: %v", addr, err)
+		s.fail(fmt.Errorf("连接 %s 失败: %w", addr, err), true)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// socksListener 登记接受的客户端连接，统计字节数
+type socksListener struct {
+	net.Listener
+	server *SOCKSServer
+	creds  *socksCredentials // 为 nil 时不认证
+}
+
+func (l *socksListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &socksConn{countingConn: l.server.countConn(conn, func() {}), creds: l.creds}, nil
+}
+
+// socksConn 关闭时注销的客户端连接（socks5.Server 在连接处理结束后关闭连接）
+// 需要认证时，socks5.Server 第一次读取前先与客户端完成用户名密码认证，
+// 然后向 socks5.Server 提供一个只含“无需认证”方法的问候，并丢弃它的方法选择应答
+type socksConn struct {
+	*countingConn
+	once sync.Once
+
+	creds     *socksCredentials
+	handshake sync.Once
+	authErr   error
+	greeting  []byte // 认证通过后提供给 socks5.Server 的问候
+	discard   int    // 待丢弃的 socks5.Server 应答字节数
+}
+
+// SOCKS5 协议常量
+const (
+	socksVersion      = 5
+	socksNoAuth       = 0x00
+	socksPasswordAuth = 0x02
+	socksNoMethod     = 0xff
+	socksAuthVersion  = 1
+)
+
+// errSOCKSAuth 用户名或密码错误
+var errSOCKSAuth = errors.New("SOCKS5 用户名或密码错误")
+
+func (c *socksConn) Read(p []byte) (int, error) {
+	if c.creds != nil {
+		c.handshake.Do(c.authenticate)
+		if c.authErr != nil {
+			return 0, c.authErr
+		}
+		if len(c.greeting) > 0 {
+			n := copy(p, c.greeting)
+			c.greeting = c.greeting[n:]
+			return n, nil
+		}
+	}
+	return c.countingConn.Read(p)
+}
+
+func (c *socksConn) Write(p []byte) (int, error) {
+	if c.discard > 0 {
+		n := min(len(p), c.discard)
+		c.discard -= n
+		if n == len(p) {
+			return n, nil
+		}
+		written, err := c.countingConn.Write(p[n:])
+		return n + written, err
+	}
+	return c.countingConn.Write(p)
+}
+
+// authenticate 完成方法协商和用户名密码认证（RFC 1929），结果记录在 authErr
+func (c *socksConn) authenticate() {
+	// socks5.Server 读取问候后写回的方法选择（或失败时的拒绝应答）都不发给客户端
+	c.discard = 2
+
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.countingConn, hdr[:]); err != nil {
+		c.authErr = err
+		return
+	}
+	if hdr[0] != socksVersion {
+		c.authErr = fmt.Errorf("不支持的 SOCKS 版本: %d", hdr[0])
+		return
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(c.countingConn, methods); err != nil {
+		c.authErr = err
+		return
+	}
+	if !bytes.Contains(methods, []byte{socksPasswordAuth}) {
+		c.countingConn.Write([]byte{socksVersion, socksNoMethod})
+		c.authErr = errors.New("客户端不支持用户名密码认证")
+		return
+	}
+	c.countingConn.Write([]byte{socksVersion, socksPasswordAuth})
+
+	username, password, err := readSOCKSAuth(c.countingConn)
+	if err != nil {
+		c.authErr = err
+		return
+	}
+	if !c.creds.check(username, password) {
+		c.countingConn.Write([]byte{socksAuthVersion, 1})
+		c.authErr = errSOCKSAuth
+		return
+	}
+	c.countingConn.Write([]byte{socksAuthVersion, 0})
+	c.greeting = []byte{socksVersion, 1, socksNoAuth}
+}
+
+// readSOCKSAuth 读取用户名密码认证请求
+func readSOCKSAuth(r io.Reader) (username, password string, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return "", "", err
+	}
+	if hdr[0] != socksAuthVersion {
+		return "", "", fmt.Errorf("不支持的认证版本: %d", hdr[0])
+	}
+	user := make([]byte, hdr[1])
+	if _, err := io.ReadFull(r, user); err != nil {
+		return "", "", err
+	}
+	var n [1]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return "", "", err
+	}
+	pass := make([]byte, n[0])
+	if _, err := io.ReadFull(r, pass); err != nil {
+		return "", "", err
+	}
+	return string(user), string(pass), nil
+}
+
+// socksCredentials 用户名和密码哈希
+// 每次校验密码哈希需要几百毫秒，校验通过的密码记录 SHA-256 摘要，之后的连接直接比较摘要
+type socksCredentials struct {
+	username     string
+	passwordHash string
+	verified     atomic.Pointer[[sha256.Size]byte]
+}
+
+// check 报告用户名和密码是否正确
+func (c *socksCredentials) check(username, password string) bool {
+	if subtle.ConstantTimeCompare([]byte(username), []byte(c.username)) != 1 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(password))
+	if verified := c.verified.Load(); verified != nil && subtle.ConstantTimeCompare(sum[:], verified[:]) == 1 {
+		return true
+	}
+	if !verifySOCKSPassword(c.passwordHash, password) {
+		return false
+	}
+	c.verified.Store(&sum)
+	return true
+}
+
+// socksHashIterations PBKDF2 迭代次数（测试时调低）
+var socksHashIterations = 600_000
+
+// socksHashPrefix 密码哈希格式：pbkdf2-sha256$迭代次数$盐$哈希（盐和哈希为 base64）
+const socksHashPrefix = "pbkdf2-sha256"
+
+// HashSOCKSPassword 返回 SOCKS5 密码的哈希（PBKDF2-SHA256，随机盐），配置文件中只保存哈希
+func HashSOCKSPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("生成密码盐失败: %w", err)
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, socksHashIterations, sha256.Size)
+	if err != nil {
+		return "", fmt.Errorf("计算密码哈希失败: %w", err)
+	}
+	return strings.Join([]string{
+		socksHashPrefix,
+		strconv.Itoa(socksHashIterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$"), nil
+}
+
+// verifySOCKSPassword 报告密码是否与 HashSOCKSPassword 生成的哈希匹配，哈希格式无效时返回 false
+func verifySOCKSPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != socksHashPrefix {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	return err == nil && subtle.ConstantTimeCompare(key, want) == 1
+}
+
+func (c *socksConn) Close() error {
+	err := c.countingConn.Close()
+	c.once.Do(c.done)
+	if errors.Is(err, net.ErrClosed) {
+		return nil // 已被强制关闭
+	}
+	return err
+}
@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// socksConnect 通过 SOCKS5 代理 CONNECT 到 host:port，user 非空时使用用户名密码认证，返回代理的应答码
+func socksConnect(t *testing.T, proxyAddr, user, password, host string, port int) (net.Conn, byte) {
+	t.Helper()
+	conn, err := net.Dial("tcp", proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	method := byte(0x00)
+	if user != "" {
+		method = 0x02
+	}
+	conn.Write([]byte{5, 1, method})
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply[1] != method {
+		return conn, 0xff
+	}
+	if user != "" {
+		auth := append([]byte{1, byte(len(user))}, user...)
+		auth = append(append(auth, byte(len(password))), password...)
+		conn.Write(auth)
+		if _, err := io.ReadFull(conn, reply); err != nil || reply[1] != 0 {
+			return conn, 0xff
+		}
+	}
+
+	req := append([]byte{5, 1, 0, 3, byte(len(host))}, host...)
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	conn.Write(req)
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		t.Fatal(err)
+	}
+	// 跳过绑定地址
+	switch head[3] {
+	case 1:
+		io.ReadFull(conn, make([]byte, 4+2))
+	case 4:
+		io.ReadFull(conn, make([]byte, 16+2))
+	case 3:
+		n := make([]byte, 1)
+		io.ReadFull(conn, n)
+		io.ReadFull(conn, make([]byte, int(n[0])+2))
+	}
+	return conn, head[1]
+}
+
+// socksHash 返回密码哈希（测试中降低迭代次数）
+func socksHash(t *testing.T, password string) string {
+	t.Helper()
+	original := socksHashIterations
+	socksHashIterations = 1000
+	t.Cleanup(func() { socksHashIterations = original })
+	hash, err := HashSOCKSPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestSOCKSPasswordHash(t *testing.T) {
+	hash := socksHash(t, "secret")
+	if strings.Contains(hash, "secret") {
+		t.Fatalf("hash must not contain the password: %s", hash)
+	}
+	if !verifySOCKSPassword(hash, "secret") || verifySOCKSPassword(hash, "Secret") {
+		t.Fatal("hash must match only the original password")
+	}
+	if again := socksHash(t, "secret"); again == hash {
+		t.Fatal("hashes of the same password must use different salts")
+	}
+	for _, invalid := range []string{"", "secret", "pbkdf2-sha256$x$c2FsdA$a2V5", "md5$1$c2FsdA$a2V5"} {
+		if verifySOCKSPassword(invalid, "secret") {
+			t.Fatalf("invalid hash %q must not verify", invalid)
+		}
+	}
+}
+
+func TestSOCKSServerConnectsThroughDialer(t *testing.T) {
+	echo := tcpEcho(t)
+	var dialed []string
+	s := NewSOCKSServer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		if !strings.HasPrefix(addr, "pg.beagle:") {
+			return nil, errors.New("not a tunnel address")
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, echo)
+	})
+	if err := s.Start("127.0.0.1:0", "alice", socksHash(t, "secret")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+	if !s.Auth() {
+		t.Fatal("credentials were set, authentication must be required")
+	}
+
+	conn, code := socksConnect(t, s.Addr(), "alice", "secret", "pg.beagle", 5432)
+	if code != 0 {
+		t.Fatalf("CONNECT reply = %d", code)
+	}
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo through SOCKS5 = %q, %v", buf, err)
+	}
+	if len(dialed) != 1 || dialed[0] != "pg.beagle:5432" {
+		t.Fatalf("dialer got %v, want the unresolved name", dialed)
+	}
+	eventually(t, "the connection to be counted", func() bool {
+		stats := s.Stats()
+		return stats.ActiveConns == 1 && stats.BytesIn > 0 && stats.BytesOut > 0
+	})
+
+	if _, code := socksConnect(t, s.Addr(), "alice", "secret", "example.com", 443); code == 0 {
+		t.Fatal("CONNECT to an address the dialer rejects must fail")
+	}
+	eventually(t, "the dial failure to be recorded", func() bool {
+		stats := s.Stats()
+		return stats.DialFailures == 1 && strings.Contains(stats.LastError, "example.com:443")
+	})
+
+	if _, code := socksConnect(t, s.Addr(), "alice", "wrong", "pg.beagle", 5432); code == 0 {
+		t.Fatal("wrong password must be rejected")
+	}
+	if _, code := socksConnect(t, s.Addr(), "", "", "pg.beagle", 5432); code == 0 {
+		t.Fatal("unauthenticated clients must be rejected")
+	}
+}
+
+func TestSOCKSServerStopClosesConnections(t *testing.T) {
+	echo := tcpEcho(t)
+	s := NewSOCKSServer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, echo)
+	})
+	if err := s.Start("127.0.0.1:0", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	addr := s.Addr()
+	conn, code := socksConnect(t, addr, "", "", "web.beagle", 80)
+	if code != 0 {
+		t.Fatalf("CONNECT reply = %d", code)
+	}
+
+	s.Stop()
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("client connection must be closed after Stop")
+	}
+	if s.Addr() != "" {
+		t.Fatal("Addr must be empty after Stop")
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Fatal("listener must be closed after Stop")
+	}
+	eventually(t, "the connection to be unregistered", func() bool { return s.Stats().ActiveConns == 0 })
+
+	// 停止后可以在新地址上重新启动
+	if err := s.Start(net.JoinHostPort("127.0.0.1", strconv.Itoa(freePort(t))), "", ""); err != nil {
+		t.Fatal(err)
+	}
+	s.Stop()
+}
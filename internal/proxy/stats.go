@@ -0,0 +1,227 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stats.go 代理的流量统计和活动连接登记
+// 每个代理实例累计字节数、连接数、拨号失败次数和最近一次错误，同时记录每个活动连接的客户端地址、开始时间和字节数
+// 活动连接有进程内唯一的 ID，可以单独强制关闭（如卡住的 kubectl exec），不影响代理的监听
+// 方向以本地客户端为准：BytesIn 为从客户端读取、转发到远程的字节数，BytesOut 为写回客户端的字节数
+
+// Stats 代理实例的统计信息
+type Stats struct {
+	BytesIn      int64       // 从客户端收到的字节数（上行）
+	BytesOut     int64       // 发给客户端的字节数（下行）
+	ActiveConns  int         // 活动连接数（UDP 为活动会话数）
+	TotalConns   int64       // 累计连接数
+	DialFailures int64       // 拨号远程失败次数
+	LastError    string      // 最近一次错误
+	LastErrorAt  time.Time   // 最近一次错误的时间
+	Conns        []ConnStats // 活动连接，按建立顺序排序
+
+	Breaker          string    // 熔断器状态（BreakerClosed / BreakerOpen / BreakerHalfOpen），只有 TCP 代理有
+	BreakerOpenUntil time.Time // 熔断结束时间（熔断中时有效）
+}
+
+// ConnStats 单个活动连接的统计信息
+type ConnStats struct {
+	ID         uint64    // 连接 ID（进程内唯一）
+	ClientAddr string    // 客户端地址
+	StartedAt  time.Time // 连接开始时间
+	BytesIn    int64     // 从客户端收到的字节数
+	BytesOut   int64     // 发给客户端的字节数
+}
+
+// connSeq 连接 ID 序号，所有代理管理器共用，保证 ID 在进程内唯一
+var connSeq atomic.Uint64
+
+// liveConn 活动连接的计数
+type liveConn struct {
+	id         uint64
+	close      func() // 强制关闭连接
+	clientAddr string
+	startedAt  time.Time
+	bytesIn    atomic.Int64
+	bytesOut   atomic.Int64
+}
+
+// traffic 代理实例的计数
+type traffic struct {
+	bytesIn      atomic.Int64
+	bytesOut     atomic.Int64
+	totalConns   atomic.Int64
+	dialFailures atomic.Int64
+
+	mu        sync.Mutex
+	lastErr   string
+	lastErrAt time.Time
+	conns     map[uint64]*liveConn // key: 连接 ID
+}
+
+// track 登记一个新连接，close 用于强制关闭
+func (t *traffic) track(clientAddr string, close func()) *liveConn {
+	c := &liveConn{id: connSeq.Add(1), close: close, clientAddr: clientAddr, startedAt: time.Now()}
+	t.totalConns.Add(1)
+	t.mu.Lock()
+	if t.conns == nil {
+		t.conns = make(map[uint64]*liveConn)
+	}
+	t.conns[c.id] = c
+	t.mu.Unlock()
+	return c
+}
+
+// untrack 注销一个已关闭的连接
+func (t *traffic) untrack(c *liveConn) {
+	t.mu.Lock()
+	delete(t.conns, c.id)
+	t.mu.Unlock()
+}
+
+// kill 强制关闭指定 ID 的连接，连接不存在时返回 false
+// 连接在处理协程退出时注销，这里只触发关闭
+func (t *traffic) kill(id uint64) bool {
+	t.mu.Lock()
+	c, ok := t.conns[id]
+	t.mu.Unlock()
+	if ok {
+		c.close()
+	}
+	return ok
+}
+
+// killAll 强制关闭全部活动连接，返回关闭的连接数
+func (t *traffic) killAll() int {
+	t.mu.Lock()
+	conns := make([]*liveConn, 0, len(t.conns))
+	for _, c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+	for _, c := range conns {
+		c.close()
+	}
+	return len(conns)
+}
+
+// closeConn 在一组计数中强制关闭指定 ID 的连接，连接不存在时返回 false
+func closeConn(ts []*traffic, id uint64) bool {
+	for _, t := range ts {
+		if t.kill(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// closeAll 强制关闭一组计数中的全部活动连接，返回关闭的连接数
+func closeAll(ts []*traffic) int {
+	closed := 0
+	for _, t := range ts {
+		closed += t.killAll()
+	}
+	return closed
+}
+
+// addIn 记录从客户端收到的字节
+func (t *traffic) addIn(c *liveConn, n int) {
+	if n > 0 {
+		c.bytesIn.Add(int64(n))
+		t.bytesIn.Add(int64(n))
+	}
+}
+
+// addOut 记录发给客户端的字节
+func (t *traffic) addOut(c *liveConn, n int) {
+	if n > 0 {
+		c.bytesOut.Add(int64(n))
+		t.bytesOut.Add(int64(n))
+	}
+}
+
+// fail 记录一次错误，dial 为 true 时计入拨号失败次数
+func (t *traffic) fail(err error, dial bool) {
+	if dial {
+		t.dialFailures.Add(1)
+	}
+	t.mu.Lock()
+	t.lastErr = err.Error()
+	t.lastErrAt = time.Now()
+	t.mu.Unlock()
+}
+
+// snapshot 返回当前统计信息
+func (t *traffic) snapshot() Stats {
+	t.mu.Lock()
+	s := Stats{
+		LastError:   t.lastErr,
+		LastErrorAt: t.lastErrAt,
+		Conns:       make([]ConnStats, 0, len(t.conns)),
+	}
+	for _, c := range t.conns {
+		s.Conns = append(s.Conns, ConnStats{
+			ID:         c.id,
+			ClientAddr: c.clientAddr,
+			StartedAt:  c.startedAt,
+			BytesIn:    c.bytesIn.Load(),
+			BytesOut:   c.bytesOut.Load(),
+		})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(s.Conns, func(i, j int) bool { return s.Conns[i].ID < s.Conns[j].ID })
+	s.ActiveConns = len(s.Conns)
+	s.BytesIn = t.bytesIn.Load()
+	s.BytesOut = t.bytesOut.Load()
+	s.TotalConns = t.totalConns.Load()
+	s.DialFailures = t.dialFailures.Load()
+	return s
+}
+
+// countingConn 统计读写字节数的客户端连接
+type countingConn struct {
+	net.Conn
+	traffic *traffic
+	live    *liveConn
+}
+
+// countConn 登记客户端连接并包装为计数连接，连接关闭后需调用 done
+// 强制关闭时先取消 cancel（处理协程据此关闭远程连接），再关闭客户端连接
+func (t *traffic) countConn(conn net.Conn, cancel context.CancelFunc) *countingConn {
+	live := t.track(conn.RemoteAddr().String(), func() {
+		cancel()
+		conn.Close()
+	})
+	return &countingConn{Conn: conn, traffic: t, live: live}
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.traffic.addIn(c.live, n)
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.traffic.addOut(c.live, n)
+	return n, err
+}
+
+// CloseWrite 半关闭写方向（底层连接支持时）
+func (c *countingConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// done 注销连接
+func (c *countingConn) done() {
+	c.traffic.untrack(c.live)
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eventually 等待 cond 成立，超时后报告 what
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// tcpEcho 启动一个把数据原样发回的 TCP 服务，返回地址
+func tcpEcho(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestStatsCountBytesAndLiveConnections(t *testing.T) {
+	m := newIdleTestManager(t)
+	target := Target{Domain: "pg.beagle", VIP: "127.0.0.1", Port: freePort(t), RemoteAddr: tcpEcho(t)}
+	if err := m.StartProxy(target); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.VIP, strconv.Itoa(target.Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "5 bytes each way on one live connection", func() bool {
+		stats, _ := m.Stats(target)
+		return stats.ActiveConns == 1 && len(stats.Conns) == 1 &&
+			stats.BytesIn == 5 && stats.BytesOut == 5 &&
+			stats.Conns[0].BytesIn == 5 && stats.Conns[0].ClientAddr == conn.LocalAddr().String()
+	})
+
+	conn.Close()
+	eventually(t, "the connection to be unregistered", func() bool {
+		stats, _ := m.Stats(target)
+		return stats.ActiveConns == 0 && stats.TotalConns == 1 && stats.BytesIn == 5
+	})
+}
+
+func TestStatsRecordDialFailures(t *testing.T) {
+	m := NewManager(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("peer offline")
+	})
+	t.Cleanup(m.StopAll)
+	target := Target{Domain: "pg.beagle", VIP: "127.0.0.1", Port: freePort(t), RemoteAddr: "100.64.0.9:5432"}
+	if err := m.StartProxy(target); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.VIP, strconv.Itoa(target.Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Read(make([]byte, 1)) // 拨号失败后代理关闭连接
+
+	eventually(t, "the dial failure to be recorded", func() bool {
+		stats, _ := m.Stats(target)
+		return stats.DialFailures == 1 && strings.Contains(stats.LastError, "peer offline") && !stats.LastErrorAt.IsZero()
+	})
+	if _, ok := m.Stats(Target{VIP: target.VIP, Port: target.Port, UDP: true}); ok {
+		t.Fatal("no UDP proxy runs on this port")
+	}
+}
+
+func TestCloseConnKeepsListener(t *testing.T) {
+	m := newIdleTestManager(t)
+	target := Target{Domain: "k8s.beagle", VIP: "127.0.0.1", Port: freePort(t), RemoteAddr: tcpEcho(t)}
+	if err := m.StartProxy(target); err != nil {
+		t.Fatal(err)
+	}
+	addr := net.JoinHostPort(target.VIP, strconv.Itoa(target.Port))
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.Write([]byte("x"))
+		io.ReadFull(conn, make([]byte, 1))
+		return conn
+	}
+	stuck, other := dial(), dial()
+
+	var ids []uint64
+	eventually(t, "two registered connections", func() bool {
+		stats, _ := m.Stats(target)
+		ids = ids[:0]
+		for _, c := range stats.Conns {
+			ids = append(ids, c.ID)
+		}
+		return len(ids) == 2
+	})
+
+	if !m.CloseConn(ids[0]) {
+		t.Fatal("expected the first connection to be closed")
+	}
+	stuck.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := stuck.Read(make([]byte, 1)); err == nil {
+		t.Fatal("the closed connection must not receive data")
+	}
+	eventually(t, "the closed connection to be unregistered", func() bool {
+		stats, _ := m.Stats(target)
+		return stats.ActiveConns == 1 && stats.Conns[0].ID == ids[1] && stats.DialFailures == 0
+	})
+	if m.CloseConn(ids[0]) {
+		t.Fatal("closing an unknown connection must report false")
+	}
+
+	// 其他连接和监听不受影响
+	other.Write([]byte("y"))
+	if _, err := io.ReadFull(other, make([]byte, 1)); err != nil {
+		t.Fatalf("other connection must keep working: %v", err)
+	}
+	dial()
+
+	if n := m.CloseDomainConns("k8s.beagle"); n != 2 {
+		t.Fatalf("expected 2 connections closed for the domain, got %d", n)
+	}
+	eventually(t, "all connections of the domain to be closed", func() bool {
+		stats, _ := m.Stats(target)
+		return stats.ActiveConns == 0
+	})
+	if m.Count() != 1 {
+		t.Fatal("closing connections must keep the listener")
+	}
+}
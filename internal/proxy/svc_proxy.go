@@ -37,6 +37,8 @@ type svcEntry struct {
 	target   SVCTarget
 	listener net.Listener
 	cancel   context.CancelFunc
+	usage
+	traffic
 }
 
 // SVCProxyManager K8S Service gRPC 代理管理器
@@ -45,6 +47,10 @@ type SVCProxyManager struct {
 	proxies map[string]*svcEntry // key: "vip:port"
 	mu      sync.RWMutex
 
+	idleTimeout time.Duration   // 空闲回收时间，<= 0 时不回收
+	onIdle      func(SVCTarget) // 代理被回收后调用
+	reaping     bool            // 回收协程是否已启动
+
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
@@ -84,6 +90,7 @@ func (m *SVCProxyManager) StartSVCProxy(target SVCTarget) error {
 		target:   target,
 		listener: listener,
 		cancel:   cancel,
+		usage:    usage{lastUsed: time.Now()},
 	}
 
 	m.mu.Lock()
@@ -99,6 +106,24 @@ func (m *SVCProxyManager) StartSVCProxy(target SVCTarget) error {
 	return nil
 }
 
+// StopSVCProxy 停止一个 SVCProxy 代理
+func (m *SVCProxyManager) StopSVCProxy(vip string, port int) {
+	key := fmt.Sprintf("%s:%d", vip, port)
+
+	m.mu.Lock()
+	e, exists := m.proxies[key]
+	if exists {
+		delete(m.proxies, key)
+	}
+	m.mu.Unlock()
+
+	if exists {
+		e.cancel()
+		e.listener.Close()
+		log.Printf("[SVCProxy] 已停止: %s (%s)", key, e.target.Domain)
+	}
+}
+
 // StopAll 停止所有 SVCProxy 代理
 func (m *SVCProxyManager) StopAll() {
 	m.cancel()
@@ -121,6 +146,39 @@ func (m *SVCProxyManager) Count() int {
 	return len(m.proxies)
 }
 
+// Stats 获取 SVCProxy 代理的流量统计，代理不存在时返回 false
+func (m *SVCProxyManager) Stats(vip string, port int) (Stats, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if e, ok := m.proxies[fmt.Sprintf("%s:%d", vip, port)]; ok {
+		return e.snapshot(), true
+	}
+	return Stats{}, false
+}
+
+// CloseConn 强制关闭指定 ID 的活动连接，代理继续监听；连接不存在时返回 false
+func (m *SVCProxyManager) CloseConn(id uint64) bool {
+	return closeConn(m.trafficOf(""), id)
+}
+
+// CloseDomainConns 强制关闭域名的全部活动连接，代理继续监听，返回关闭的连接数
+func (m *SVCProxyManager) CloseDomainConns(domain string) int {
+	return closeAll(m.trafficOf(domain))
+}
+
+// trafficOf 返回域名下全部代理的计数，domain 为空时返回全部代理的计数
+func (m *SVCProxyManager) trafficOf(domain string) []*traffic {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []*traffic
+	for _, e := range m.proxies {
+		if domain == "" || e.target.Domain == domain {
+			result = append(result, &e.traffic)
+		}
+	}
+	return result
+}
+
 // GetStatus 获取所有运行中的 SVCProxy 代理目标信息
 func (m *SVCProxyManager) GetStatus() []SVCTarget {
 	m.mu.RLock()
@@ -154,13 +212,91 @@ func (m *SVCProxyManager) acceptLoop(ctx context.Context, e *svcEntry) {
 			}
 		}
 
-		go m.handleConn(ctx, conn, e.target)
+		e.begin()
+		connCtx, connCancel := context.WithCancel(ctx)
+		cc := e.countConn(conn, connCancel)
+		go func() {
+			defer e.end()
+			defer cc.done()
+			defer connCancel()
+			m.handleConn(connCtx, cc, e)
+		}()
 	}
 }
 
+// SetIdleTimeout 设置空闲回收时间，timeout <= 0 时不回收
+// 代理超过 timeout 没有新连接且没有活动连接时停止监听，之后调用 onIdle（调用方据此释放 VIP）
+func (m *SVCProxyManager) SetIdleTimeout(timeout time.Duration, onIdle func(SVCTarget)) {
+	m.mu.Lock()
+	m.idleTimeout = timeout
+	m.onIdle = onIdle
+	start := timeout > 0 && !m.reaping
+	m.reaping = m.reaping || start
+	m.mu.Unlock()
+
+	if start {
+		m.wg.Add(1)
+		go m.reapLoop()
+	}
+}
+
+// reapLoop 定期回收空闲代理，直到 StopAll
+func (m *SVCProxyManager) reapLoop() {
+	defer m.wg.Done()
+	timeout := func() time.Duration {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		return m.idleTimeout
+	}
+	runReaper(m.ctx, timeout, func(now time.Time) {
+		targets := m.reapIdle(now)
+		m.mu.RLock()
+		onIdle := m.onIdle
+		m.mu.RUnlock()
+		for _, target := range targets {
+			if onIdle != nil {
+				onIdle(target)
+			}
+		}
+	})
+}
+
+// reapIdle 停止在 now 时已空闲超过回收时间的代理，返回被停止的代理
+func (m *SVCProxyManager) reapIdle(now time.Time) []SVCTarget {
+	m.mu.Lock()
+	if m.idleTimeout <= 0 {
+		m.mu.Unlock()
+		return nil
+	}
+	var reaped []*svcEntry
+	candidates := make([]idleProxy, 0, len(m.proxies))
+	for key, e := range m.proxies {
+		candidates = append(candidates, idleProxy{
+			vip:  e.target.VIP,
+			idle: func(now time.Time) bool { return e.idle(now, m.idleTimeout) },
+			stop: func() {
+				delete(m.proxies, key)
+				reaped = append(reaped, e)
+			},
+		})
+	}
+	reapIdleProxies(candidates, now)
+	m.mu.Unlock()
+
+	targets := make([]SVCTarget, 0, len(reaped))
+	for _, e := range reaped {
+		e.cancel()
+		e.listener.Close()
+		log.Printf("[SVCProxy] 空闲回收: %s:%d (%s)", e.target.VIP, e.target.Port, e.target.Domain)
+		targets = append(targets, e.target)
+	}
+	return targets
+}
+
 // handleConn 处理单个 TCP 连接，桥接到 Agent gRPC SVCProxy
-func (m *SVCProxyManager) handleConn(ctx context.Context, clientConn net.Conn, target SVCTarget) {
+func (m *SVCProxyManager) handleConn(ctx context.Context, clientConn net.Conn, e *svcEntry) {
 	defer clientConn.Close()
+	target := e.target
 
 	// 1. 通过 tsnet 拨号到 Agent gRPC 端口
 	grpcAddr := fmt.Sprintf("%s:%d", target.AgentIP, target.GRPCPort)
@@ -173,6 +309,7 @@ func (m *SVCProxyManager) handleConn(ctx context.Context, clientConn net.Conn, t
 	)
 	if err != nil {
 		log.Printf("[SVCProxy] gRPC 连接失败 (%s): %v", grpcAddr, err)
+		e.fail(fmt.Errorf("gRPC 连接 %s 失败: %w", grpcAddr, err), true)
 		return
 	}
 	defer grpcConn.Close()
@@ -185,6 +322,7 @@ func (m *SVCProxyManager) handleConn(ctx context.Context, clientConn net.Conn, t
 	stream, err := svcClient.SVCProxy(streamCtx)
 	if err != nil {
 		log.Printf("[SVCProxy] 建立流失败 (%s): %v", target.Domain, err)
+		e.fail(fmt.Errorf("建立 SVCProxy 流失败: %w", err), true)
 		return
 	}
 
@@ -197,6 +335,7 @@ func (m *SVCProxyManager) handleConn(ctx context.Context, clientConn net.Conn, t
 		EndpointName: target.EndpointName,
 	}); err != nil {
 		log.Printf("[SVCProxy] 发送首包失败 (%s): %v", target.Domain, err)
+		e.fail(fmt.Errorf("发送首包失败: %w", err), true)
 		return
 	}
 
@@ -218,6 +357,7 @@ func (m *SVCProxyManager) handleConn(ctx context.Context, clientConn net.Conn, t
 	case resp := <-firstRespCh:
 		if resp.Error != "" {
 			log.Printf("[SVCProxy] Agent 拒绝连接 (%s): %s", target.Domain, resp.Error)
+			e.fail(fmt.Errorf("Agent 拒绝连接: %s", resp.Error), false)
 			return
 		}
 		// Agent 可能发送了数据，写入客户端
@@ -228,7 +368,11 @@ func (m *SVCProxyManager) handleConn(ctx context.Context, clientConn net.Conn, t
 			return
 		}
 	case err := <-firstErrCh:
+		if ctx.Err() != nil {
+			return // 连接被强制关闭或代理停止
+		}
 		log.Printf("[SVCProxy] 接收首响应失败 (%s): %v", target.Domain, err)
+		e.fail(fmt.Errorf("接收首响应失败: %w", err), true)
 		return
 	case <-time.After(10 * time.Second):
 		// 超时说明 Agent 没有立即返回错误，连接正常建立
@@ -275,6 +419,7 @@ func (m *SVCProxyManager) handleConn(ctx context.Context, clientConn net.Conn, t
 			}
 			if msg.Error != "" {
 				log.Printf("[SVCProxy] Agent 错误 (%s): %s", target.Domain, msg.Error)
+				e.fail(fmt.Errorf("Agent 错误: %s", msg.Error), false)
 				return
 			}
 			if msg.IsClose {
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/open-beagle/awecloud-signaling-desktop/internal/localca"
+)
+
+func TestTLSProxyServesCertificateFromCertFunc(t *testing.T) {
+	ca, err := localca.Load(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newIdleTestManager(t)
+	m.SetCertFunc(ca.Certificate)
+
+	target := Target{Domain: "kubernetes.beijing.beagle", VIP: "127.0.0.1", Port: freePort(t), RemoteAddr: tcpEcho(t), TLS: true}
+	if err := m.StartProxy(target); err != nil {
+		t.Fatal(err)
+	}
+
+	// kubeconfig 的 server 使用 VIP，kubectl 按 IP 校验证书
+	conn, err := tls.Dial("tcp", net.JoinHostPort(target.VIP, strconv.Itoa(target.Port)), &tls.Config{RootCAs: ca.Pool()})
+	if err != nil {
+		t.Fatalf("TLS handshake must verify against the local CA: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("unexpected echo %q: %v", buf, err)
+	}
+}
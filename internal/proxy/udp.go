@@ -0,0 +1,334 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// udp.go 本地 UDP 转发
+// 在 VIP:端口 上监听 UDP，按客户端地址建立会话：每个客户端地址通过 tsnet 拨号一个独立的 UDP 连接，
+// 远程的回包按会话写回对应的客户端地址。UDP 没有连接关闭，会话在双向都没有数据超过 udpSessionTimeout 后关闭
+// 活动会话计入代理的活动连接数，参与空闲回收的方式与 TCP 代理相同
+
+// DefaultUDPSessionTimeout 默认的 UDP 会话空闲时间（与常见 NAT 的 UDP 映射超时一致）
+const DefaultUDPSessionTimeout = 2 * time.Minute
+
+// UDP 转发限制
+const (
+	maxUDPPacket   = 64 * 1024 // 单个数据报最大长度
+	maxUDPSessions = 1024      // 单个代理的最大会话数（包括拨号中的会话），超出后丢弃新客户端的数据报
+	maxUDPPending  = 16        // 会话拨号期间缓存的数据报数，超出后丢弃
+)
+
+// udpEntry 单个 UDP 代理实例
+type udpEntry struct {
+	target   Target
+	conn     net.PacketConn
+	cancel   context.CancelFunc
+	sessions map[string]*udpSession // key: 客户端地址
+	mu       sync.Mutex
+	usage
+	traffic
+}
+
+// udpSession 单个客户端地址的 UDP 会话
+// 会话先登记再在独立协程中拨号，拨号期间 remote 为 nil，收到的数据报缓存在 pending 中，拨号完成后按顺序发出
+type udpSession struct {
+	client     net.Addr
+	remote     net.Conn
+	live       *liveConn
+	pending    [][]byte
+	lastActive time.Time
+	mu         sync.Mutex
+}
+
+// enqueue 返回可以直接写入的远程连接；会话仍在拨号时复制数据报到待发队列（队列满时丢弃），返回 nil
+func (s *udpSession) enqueue(data []byte) net.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.remote != nil {
+		return s.remote
+	}
+	if len(s.pending) < maxUDPPending {
+		s.pending = append(s.pending, append([]byte(nil), data...))
+	}
+	return nil
+}
+
+// closeRemote 关闭会话的远程连接，拨号中的会话在拨号完成后由拨号协程关闭
+func (s *udpSession) closeRemote() {
+	s.mu.Lock()
+	remote := s.remote
+	s.mu.Unlock()
+	if remote != nil {
+		remote.Close()
+	}
+}
+
+// touch 记录会话有数据收发
+func (s *udpSession) touch() {
+	s.mu.Lock()
+	s.lastActive = time.Now()
+	s.mu.Unlock()
+}
+
+// idleFor 返回会话在 now 时已经没有数据收发的时间
+func (s *udpSession) idleFor(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return now.Sub(s.lastActive)
+}
+
+// SetUDPSessionTimeout 设置 UDP 会话空闲时间，之后建立的会话生效，<= 0 时使用默认值
+func (m *Manager) SetUDPSessionTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultUDPSessionTimeout
+	}
+	m.mu.Lock()
+	m.udpSessionTimeout = timeout
+	m.mu.Unlock()
+}
+
+// StartUDPProxy 启动一个本地 UDP 代理
+// 在 vip:port 上监听 UDP，转发到 target.RemoteAddr（target.TLS 对 UDP 无效）
+func (m *Manager) StartUDPProxy(target Target) error {
+	target.UDP = true
+	target.TLS = false
+	key := fmt.Sprintf("%s:%d", target.VIP, target.Port)
+
+	m.mu.Lock()
+	if _, exists := m.udpProxies[key]; exists {
+		m.mu.Unlock()
+		return nil // 已存在，跳过
+	}
+	m.mu.Unlock()
+
+	conn, err := net.ListenPacket("udp", key)
+	if err != nil {
+		return fmt.Errorf("监听 UDP %s 失败: %w", key, err)
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	e := &udpEntry{
+		target:   target,
+		conn:     conn,
+		cancel:   cancel,
+		sessions: make(map[string]*udpSession),
+		usage:    usage{lastUsed: time.Now()},
+	}
+
+	m.mu.Lock()
+	if _, exists := m.udpProxies[key]; exists {
+		m.mu.Unlock()
+		cancel()
+		conn.Close()
+		return nil
+	}
+	m.udpProxies[key] = e
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.udpReadLoop(ctx, e)
+
+	log.Printf("[Proxy] UDP 已启动: %s → %s (%s)", key, target.RemoteAddr, target.Domain)
+	return nil
+}
+
+// StopUDPProxy 停止一个 UDP 代理及其全部会话
+func (m *Manager) StopUDPProxy(vip string, port int) {
+	key := fmt.Sprintf("%s:%d", vip, port)
+
+	m.mu.Lock()
+	e, exists := m.udpProxies[key]
+	if exists {
+		delete(m.udpProxies, key)
+	}
+	m.mu.Unlock()
+
+	if exists {
+		e.close()
+		log.Printf("[Proxy] UDP 已停止: %s (%s)", key, e.target.Domain)
+	}
+}
+
+// close 停止监听并关闭全部会话
+func (e *udpEntry) close() {
+	e.cancel()
+	e.conn.Close()
+
+	e.mu.Lock()
+	sessions := e.sessions
+	e.sessions = make(map[string]*udpSession)
+	e.mu.Unlock()
+	for _, s := range sessions {
+		s.closeRemote()
+	}
+}
+
+// udpReadLoop 读取客户端数据报，按客户端地址转发到对应会话
+func (m *Manager) udpReadLoop(ctx context.Context, e *udpEntry) {
+	defer m.wg.Done()
+
+	buf := make([]byte, maxUDPPacket)
+	for {
+		n, addr, err := e.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("[Proxy] UDP 读取失败 (%s): %v", e.target.Domain, err)
+			continue
+		}
+
+		s, err := m.udpSession(ctx, e, addr)
+		if err != nil {
+			e.fail(err, false)
+			log.Printf("[Proxy] UDP 会话建立失败 (%s, %s → %s): %v", e.target.Domain, addr, e.target.RemoteAddr, err)
+			continue
+		}
+		// 会话仍在拨号：数据报已缓存，拨号完成后发出，读取循环不等待拨号
+		remote := s.enqueue(buf[:n])
+		if remote == nil {
+			continue
+		}
+		if _, err := remote.Write(buf[:n]); err != nil {
+			log.Printf("[Proxy] UDP 转发失败 (%s → %s): %v", addr, e.target.RemoteAddr, err)
+			e.fail(fmt.Errorf("转发到 %s 失败: %w", e.target.RemoteAddr, err), false)
+			continue
+		}
+		e.addIn(s.live, n)
+		s.touch()
+	}
+}
+
+// udpSession 返回客户端地址的会话，不存在时登记新会话并在独立协程中通过 tsnet 拨号
+// 拨号不阻塞读取循环：某个客户端的拨号变慢（tsnet 等待路由、DERP 中继）不影响其他客户端的会话
+func (m *Manager) udpSession(ctx context.Context, e *udpEntry, addr net.Addr) (*udpSession, error) {
+	key := addr.String()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if s, exists := e.sessions[key]; exists {
+		return s, nil
+	}
+	if len(e.sessions) >= maxUDPSessions {
+		return nil, fmt.Errorf("会话数已达上限 %d", maxUDPSessions)
+	}
+
+	s := &udpSession{client: addr, lastActive: time.Now()}
+	e.sessions[key] = s
+	m.wg.Add(1)
+	go m.udpDial(ctx, e, s)
+	return s, nil
+}
+
+// udpDial 为会话拨号，成功后发出拨号期间缓存的数据报并转为回包循环；失败时注销会话，客户端再发数据时重新拨号
+func (m *Manager) udpDial(ctx context.Context, e *udpEntry, s *udpSession) {
+	key := s.client.String()
+
+	dialCtx, dialCancel := context.WithTimeout(ctx, 10*time.Second)
+	remote, err := m.dial(dialCtx, "udp", e.target.RemoteAddr)
+	dialCancel()
+	if err != nil {
+		defer m.wg.Done()
+		e.mu.Lock()
+		if e.sessions[key] == s {
+			delete(e.sessions, key)
+		}
+		e.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		e.dialFailures.Add(1)
+		err = fmt.Errorf("连接 %s 失败: %w", e.target.RemoteAddr, err)
+		e.fail(err, false)
+		log.Printf("[Proxy] UDP 会话建立失败 (%s, %s → %s): %v", e.target.Domain, s.client, e.target.RemoteAddr, err)
+		return
+	}
+
+	m.mu.RLock()
+	timeout := m.udpSessionTimeout
+	m.mu.RUnlock()
+
+	// 会话计入活动连接数，会话存在期间代理不会被空闲回收
+	e.begin()
+
+	// 强制关闭会话只需关闭远程连接，回包循环退出时注销会话；客户端再发数据时重新建立会话
+	live := e.track(key, func() { remote.Close() })
+	s.mu.Lock()
+	s.remote = remote
+	s.live = live
+	pending := s.pending
+	s.pending = nil
+	for _, data := range pending {
+		if _, err := remote.Write(data); err != nil {
+			log.Printf("[Proxy] UDP 转发失败 (%s → %s): %v", s.client, e.target.RemoteAddr, err)
+			e.fail(fmt.Errorf("转发到 %s 失败: %w", e.target.RemoteAddr, err), false)
+			continue
+		}
+		e.addIn(live, len(data))
+	}
+	s.mu.Unlock()
+
+	// 代理在拨号期间停止时 close 看不到远程连接，这里关闭
+	if ctx.Err() != nil {
+		remote.Close()
+	}
+	m.udpReplyLoop(ctx, e, s, timeout)
+}
+
+// udpReplyLoop 把远程的回包写回客户端地址，会话空闲超过 timeout 或代理停止后关闭会话
+// 由 udpDial 在拨号成功后调用，退出时结束会话
+func (m *Manager) udpReplyLoop(ctx context.Context, e *udpEntry, s *udpSession, timeout time.Duration) {
+	defer m.wg.Done()
+	defer e.end()
+	defer func() {
+		s.remote.Close()
+		e.untrack(s.live)
+		e.mu.Lock()
+		if e.sessions[s.client.String()] == s {
+			delete(e.sessions, s.client.String())
+		}
+		e.mu.Unlock()
+	}()
+
+	buf := make([]byte, maxUDPPacket)
+	for {
+		// 读超时按最后一次收发计算，客户端持续发送但远程不回包时会话也保持
+		s.remote.SetReadDeadline(time.Now().Add(timeout - s.idleFor(time.Now())))
+		n, err := s.remote.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, os.ErrDeadlineExceeded) && s.idleFor(time.Now()) < timeout {
+				continue
+			}
+			if !errors.Is(err, os.ErrDeadlineExceeded) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("[Proxy] UDP 会话读取失败 (%s ← %s): %v", s.client, e.target.RemoteAddr, err)
+				e.fail(fmt.Errorf("读取 %s 失败: %w", e.target.RemoteAddr, err), false)
+			}
+			return
+		}
+		s.touch()
+		written, err := e.conn.WriteTo(buf[:n], s.client)
+		e.addOut(s.live, written)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("[Proxy] UDP 回包失败 (%s ← %s): %v", s.client, e.target.RemoteAddr, err)
+		}
+	}
+}
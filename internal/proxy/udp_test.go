@@ -0,0 +1,200 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// udpEcho 启动一个把数据报原样发回的 UDP 服务，返回地址
+func udpEcho(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, maxUDPPacket)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(buf[:n], addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// freeUDPPort 返回 127.0.0.1 上一个空闲的 UDP 端口
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// udpExchange 从新的客户端端口发送 payload 并等待回包
+func udpExchange(t *testing.T, client net.Conn, payload string) string {
+	t.Helper()
+	if _, err := client.Write([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatalf("no reply for %q: %v", payload, err)
+	}
+	return string(buf[:n])
+}
+
+func TestUDPProxyForwardsPerClientSessions(t *testing.T) {
+	m := newIdleTestManager(t)
+	target := Target{Domain: "dns.beagle", VIP: "127.0.0.1", Port: freeUDPPort(t), RemoteAddr: udpEcho(t), UDP: true}
+	if err := m.StartUDPProxy(target); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := net.JoinHostPort(target.VIP, strconv.Itoa(target.Port))
+	first, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	if got := udpExchange(t, first, "ping-1"); got != "ping-1" {
+		t.Fatalf("unexpected reply %q", got)
+	}
+	if got := udpExchange(t, second, "ping-2"); got != "ping-2" {
+		t.Fatalf("unexpected reply %q", got)
+	}
+	if got := udpExchange(t, first, "ping-3"); got != "ping-3" {
+		t.Fatalf("unexpected reply %q", got)
+	}
+	// 计数在转发之后更新，可能略晚于客户端收到回包
+	eventually(t, "one session per client address and 18 bytes each way", func() bool {
+		stats, _ := m.Stats(target)
+		return stats.ActiveConns == 2 && stats.TotalConns == 2 && stats.BytesIn == 18 && stats.BytesOut == 18
+	})
+
+	status := m.GetStatus()
+	if len(status) != 1 || !status[0].UDP {
+		t.Fatalf("expected the UDP proxy in status, got %v", status)
+	}
+}
+
+func TestUDPSessionExpiresWhenIdle(t *testing.T) {
+	m := newIdleTestManager(t)
+	m.SetUDPSessionTimeout(200 * time.Millisecond)
+	target := Target{Domain: "dns.beagle", VIP: "127.0.0.1", Port: freeUDPPort(t), RemoteAddr: udpEcho(t), UDP: true}
+	if err := m.StartUDPProxy(target); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := net.Dial("udp", net.JoinHostPort(target.VIP, strconv.Itoa(target.Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	udpExchange(t, client, "hello")
+
+	// 会话存在期间代理计为使用中，不参与空闲回收
+	if reaped := m.reapIdle(time.Now().Add(2 * time.Minute)); len(reaped) != 0 {
+		t.Fatalf("UDP proxy with a live session must not be reaped, got %v", reaped)
+	}
+
+	eventually(t, "idle UDP session to be closed", func() bool {
+		stats, _ := m.Stats(target)
+		return stats.ActiveConns == 0
+	})
+
+	if reaped := m.reapIdle(time.Now().Add(2 * time.Minute)); len(reaped) != 1 || !reaped[0].UDP {
+		t.Fatalf("expected the idle UDP proxy to be reaped, got %v", reaped)
+	}
+}
+
+func TestSlowUDPDialDoesNotBlockOtherClients(t *testing.T) {
+	m := newIdleTestManager(t)
+	echo := udpEcho(t)
+	release := make(chan struct{})
+	var dials atomic.Int32
+	m.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		// 第一个会话的拨号一直阻塞到 release
+		if dials.Add(1) == 1 {
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	target := Target{Domain: "dns.beagle", VIP: "127.0.0.1", Port: freeUDPPort(t), RemoteAddr: echo, UDP: true}
+	if err := m.StartUDPProxy(target); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := net.JoinHostPort(target.VIP, strconv.Itoa(target.Port))
+	slow, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	fast, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+
+	if _, err := slow.Write([]byte("queued")); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the slow dial to start", func() bool { return dials.Load() == 1 })
+	if got := udpExchange(t, fast, "fast"); got != "fast" {
+		t.Fatalf("unexpected reply %q", got)
+	}
+
+	// 拨号完成后发出拨号期间缓存的数据报
+	close(release)
+	slow.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	n, err := slow.Read(buf)
+	if err != nil || string(buf[:n]) != "queued" {
+		t.Fatalf("expected the datagram sent during the dial to be forwarded, got %q (err=%v)", buf[:n], err)
+	}
+}
+
+func TestStopUDPProxyKeepsTCPOnSamePort(t *testing.T) {
+	m := newIdleTestManager(t)
+	port := freePort(t)
+	tcp := Target{Domain: "dns.beagle", VIP: "127.0.0.1", Port: port, RemoteAddr: "127.0.0.1:1"}
+	if err := m.StartProxy(tcp); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.StartUDPProxy(tcp); err != nil {
+		t.Skipf("UDP port %d is in use: %v", port, err)
+	}
+	if m.Count() != 2 {
+		t.Fatalf("expected TCP and UDP proxies on the same port, got %d", m.Count())
+	}
+
+	m.StopUDPProxy(tcp.VIP, tcp.Port)
+	status := m.GetStatus()
+	if len(status) != 1 || status[0].UDP {
+		t.Fatalf("stopping UDP must keep the TCP proxy, got %v", status)
+	}
+}
@@ -0,0 +1,464 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/net/tsaddr"
+)
+
+// web.go 按 Host 路由的 HTTP 反向代理
+// 多个 Web 域名共用一个 VIP 的 80 端口（有证书来源时还有 443 端口），按请求的 Host 选择后端，
+// 浏览器地址栏是 http://grafana.beagle 而不是 http://127.1.0.5:3000。
+// 转发时添加 X-Forwarded-For / Host / Proto 头部，WebSocket 等协议升级请求由 httputil.ReverseProxy 透传；
+// 后端不可达时返回说明原因的错误页面，而不是直接断开连接
+
+// Web 代理默认端口
+const (
+	DefaultWebHTTPPort  = 80
+	DefaultWebHTTPSPort = 443
+)
+
+// WebRoute 单个 Web 域名的路由
+type WebRoute struct {
+	Domain     string // 域名（匹配请求的 Host，不含端口）
+	RemoteAddr string // 后端地址（Agent 隧道 IP:端口）
+	TLS        bool   // 后端是否为 HTTPS（由 Server 下发，只支持隧道地址，见 transport）
+}
+
+// webRoute 路由及其统计
+type webRoute struct {
+	route WebRoute
+	traffic
+}
+
+// webRequest 请求上下文中的路由（路由可能在请求处理期间被替换，每个请求使用开始时的快照）
+type webRequest struct {
+	rt    *webRoute
+	route WebRoute
+}
+
+type webRequestKey struct{}
+
+// errWebDial 连接后端失败（区分后端不可达和后端响应异常）
+var errWebDial = errors.New("连接后端失败")
+
+// WebProxy 按 Host 路由的 HTTP 反向代理
+type WebProxy struct {
+	dial    DialFunc
+	certs   CertFunc
+	vip     string
+	https   bool
+	routes  map[string]*webRoute // key: 小写域名
+	servers []*http.Server
+	proxy   *httputil.ReverseProxy
+	mu      sync.RWMutex
+}
+
+// NewWebProxy 创建 Web 代理，后端连接通过 dial 建立
+func NewWebProxy(dial DialFunc) *WebProxy {
+	p := &WebProxy{
+		dial:   dial,
+		routes: make(map[string]*webRoute),
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite:      p.rewrite,
+		Transport:    p.transport(),
+		ErrorHandler: p.handleError,
+	}
+	return p
+}
+
+// SetCertFunc 设置 HTTPS 证书来源，需在 Start 之前调用，未设置时只监听 HTTP
+func (p *WebProxy) SetCertFunc(certs CertFunc) {
+	p.mu.Lock()
+	p.certs = certs
+	p.mu.Unlock()
+}
+
+// Start 在 vip 的 httpPort 上监听 HTTP，有证书来源且 httpsPort > 0 时同时在 httpsPort 上监听 HTTPS
+// 已启动时直接返回
+func (p *WebProxy) Start(vip string, httpPort, httpsPort int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.servers != nil {
+		return nil
+	}
+
+	httpAddr := net.JoinHostPort(vip, strconv.Itoa(httpPort))
+	l, err := net.Listen("tcp", httpAddr)
+	if err != nil {
+		return fmt.Errorf("监听 %s 失败: %w", httpAddr, err)
+	}
+	servers := []*http.Server{p.newServer(nil)}
+	go servers[0].Serve(l)
+
+	https := false
+	if p.certs != nil && httpsPort > 0 {
+		httpsAddr := net.JoinHostPort(vip, strconv.Itoa(httpsPort))
+		if tl, err := net.Listen("tcp", httpsAddr); err != nil {
+			// HTTPS 只是附加入口，失败时保留 HTTP
+			log.Printf("[WebProxy] Warning: 监听 %s 失败，只提供 HTTP: %v", httpsAddr, err)
+		} else {
+			srv := p.newServer(&tls.Config{GetCertificate: p.certificate})
+			servers = append(servers, srv)
+			go srv.ServeTLS(tl, "", "")
+			https = true
+		}
+	}
+
+	p.vip, p.https, p.servers = vip, https, servers
+	log.Printf("[WebProxy] 已启动: %s (HTTPS: %v)", httpAddr, https)
+	return nil
+}
+
+// newServer 创建 HTTP 服务
+func (p *WebProxy) newServer(tlsConfig *tls.Config) *http.Server {
+	return &http.Server{
+		Handler:           p,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 30 * time.Second,
+		ErrorLog:          log.New(log.Writer(), "[WebProxy] ", 0),
+	}
+}
+
+// Stop 停止监听并关闭全部请求（包括已升级的 WebSocket 连接），路由保留
+func (p *WebProxy) Stop() {
+	p.mu.Lock()
+	servers := p.servers
+	p.servers = nil
+	p.mu.Unlock()
+
+	for _, srv := range servers {
+		srv.Close()
+	}
+	// 升级后的连接已被接管，http.Server 不再管理，取消请求上下文关闭它们
+	closeAll(p.trafficOf(""))
+	if servers != nil {
+		log.Printf("[WebProxy] 已停止")
+	}
+}
+
+// VIP 返回监听的 VIP，未启动时返回空字符串
+func (p *WebProxy) VIP() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.servers == nil {
+		return ""
+	}
+	return p.vip
+}
+
+// HTTPS 报告是否在监听 HTTPS
+func (p *WebProxy) HTTPS() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.servers != nil && p.https
+}
+
+// AddRoute 添加或更新域名的路由，更新时保留统计
+func (p *WebProxy) AddRoute(route WebRoute) {
+	route.Domain = normalizeHost(route.Domain)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if rt, ok := p.routes[route.Domain]; ok {
+		if rt.route != route {
+			rt.route = route
+			log.Printf("[WebProxy] 路由已更新: %s → %s", route.Domain, route.RemoteAddr)
+		}
+		return
+	}
+	p.routes[route.Domain] = &webRoute{route: route}
+	log.Printf("[WebProxy] 路由已添加: %s → %s", route.Domain, route.RemoteAddr)
+}
+
+// RemoveRoute 删除域名的路由并关闭其活动请求
+func (p *WebProxy) RemoveRoute(domain string) {
+	domain = normalizeHost(domain)
+
+	p.mu.Lock()
+	rt, ok := p.routes[domain]
+	delete(p.routes, domain)
+	p.mu.Unlock()
+
+	if ok {
+		rt.killAll()
+		log.Printf("[WebProxy] 路由已删除: %s", domain)
+	}
+}
+
+// ClearRoutes 删除全部路由，返回删除的路由数（活动请求不中断）
+func (p *WebProxy) ClearRoutes() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := len(p.routes)
+	p.routes = make(map[string]*webRoute)
+	return n
+}
+
+// HasRoute 报告域名是否有路由
+func (p *WebProxy) HasRoute(domain string) bool {
+	_, ok := p.lookup(normalizeHost(domain))
+	return ok
+}
+
+// Routes 返回全部路由，按域名排序
+func (p *WebProxy) Routes() []WebRoute {
+	p.mu.RLock()
+	routes := make([]WebRoute, 0, len(p.routes))
+	for _, rt := range p.routes {
+		routes = append(routes, rt.route)
+	}
+	p.mu.RUnlock()
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Domain < routes[j].Domain })
+	return routes
+}
+
+// Stats 获取域名路由的统计（活动连接为进行中的请求），路由不存在时返回 false
+func (p *WebProxy) Stats(domain string) (Stats, bool) {
+	p.mu.RLock()
+	rt, ok := p.routes[normalizeHost(domain)]
+	p.mu.RUnlock()
+	if !ok {
+		return Stats{}, false
+	}
+	return rt.snapshot(), true
+}
+
+// CloseConn 强制关闭指定 ID 的进行中请求（如卡住的 WebSocket），请求不存在时返回 false
+func (p *WebProxy) CloseConn(id uint64) bool {
+	return closeConn(p.trafficOf(""), id)
+}
+
+// CloseDomainConns 强制关闭域名的全部进行中请求，返回关闭的请求数
+func (p *WebProxy) CloseDomainConns(domain string) int {
+	return closeAll(p.trafficOf(domain))
+}
+
+// trafficOf 返回域名路由的计数，domain 为空时返回全部路由的计数
+func (p *WebProxy) trafficOf(domain string) []*traffic {
+	domain = normalizeHost(domain)
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var result []*traffic
+	for host, rt := range p.routes {
+		if domain == "" || host == domain {
+			result = append(result, &rt.traffic)
+		}
+	}
+	return result
+}
+
+// lookup 返回域名的路由和路由快照
+func (p *WebProxy) lookup(domain string) (webRequest, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	rt, ok := p.routes[domain]
+	if !ok {
+		return webRequest{}, false
+	}
+	return webRequest{rt: rt, route: rt.route}, true
+}
+
+// ServeHTTP 按 Host 选择路由并转发
+func (p *WebProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := normalizeHost(r.Host)
+	req, ok := p.lookup(host)
+	if !ok {
+		writeErrorPage(w, http.StatusNotFound, host, "没有找到这个站点",
+			"该域名没有对应的 Web 资源，请确认域名拼写正确、资源已授权给当前用户。")
+		return
+	}
+
+	// 不验证后端证书只对隧道内的地址安全，其他地址的 HTTPS 后端不转发
+	if req.route.TLS && !tunnelAddr(req.route.RemoteAddr) {
+		log.Printf("[WebProxy] 拒绝转发 (%s → %s): HTTPS 后端不是隧道地址", req.route.Domain, req.route.RemoteAddr)
+		writeErrorPage(w, http.StatusBadGateway, host, "无法安全连接到服务",
+			"该服务的 HTTPS 后端地址不在隧道内，无法确认服务身份。请联系资源管理员检查资源配置。")
+		return
+	}
+
+	// 请求登记为活动连接，强制关闭时取消请求上下文（ReverseProxy 据此关闭后端连接）
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	live := req.rt.track(r.RemoteAddr, cancel)
+	defer req.rt.untrack(live)
+
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &countingBody{ReadCloser: r.Body, traffic: &req.rt.traffic, live: live}
+	}
+	w = &countingResponseWriter{ResponseWriter: w, traffic: &req.rt.traffic, live: live}
+	p.proxy.ServeHTTP(w, r.WithContext(context.WithValue(ctx, webRequestKey{}, &req)))
+}
+
+// rewrite 设置后端地址和 X-Forwarded-* 头部
+// Host 头部改为后端地址（后端按自己的地址处理请求），原始域名在 X-Forwarded-Host 中
+func (p *WebProxy) rewrite(pr *httputil.ProxyRequest) {
+	req := pr.In.Context().Value(webRequestKey{}).(*webRequest)
+	scheme := "http"
+	if req.route.TLS {
+		scheme = "https"
+	}
+	pr.SetURL(&url.URL{Scheme: scheme, Host: req.route.RemoteAddr})
+	pr.SetXForwarded()
+}
+
+// transport 返回通过隧道连接后端的 Transport
+func (p *WebProxy) transport() *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			conn, err := p.dial(dialCtx, network, addr)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", errWebDial, err)
+			}
+			return conn, nil
+		},
+		// 不验证后端证书：后端证书签发给内网名称（多为自签），无法按 Agent 隧道地址验证。
+		// 后端身份由隧道保证（连接只到 Agent 的隧道地址，已经过 WireGuard 加密和认证），
+		// ServeHTTP 只把隧道地址的 HTTPS 后端交给这里，见 tunnelAddr
+		TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConnsPerHost: 8,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// handleError 转发失败时记录错误并返回错误页面
+func (p *WebProxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Context().Err() != nil {
+		return // 浏览器已断开或请求被强制关闭
+	}
+	req := r.Context().Value(webRequestKey{}).(*webRequest)
+	log.Printf("[WebProxy] 转发失败 (%s → %s): %v", req.route.Domain, req.route.RemoteAddr, err)
+
+	dial := errors.Is(err, errWebDial)
+	req.rt.fail(fmt.Errorf("转发到 %s 失败: %w", req.route.RemoteAddr, err), dial)
+
+	switch {
+	case dial:
+		writeErrorPage(w, http.StatusBadGateway, req.route.Domain, "无法连接到服务",
+			"隧道另一端的 Agent 可能已离线，或服务没有启动。请稍后重试，或联系资源管理员。")
+	case errors.Is(err, context.DeadlineExceeded):
+		writeErrorPage(w, http.StatusGatewayTimeout, req.route.Domain, "服务响应超时",
+			"服务在规定时间内没有响应，请稍后重试。")
+	default:
+		writeErrorPage(w, http.StatusBadGateway, req.route.Domain, "服务响应异常",
+			"已连接到服务，但没有收到有效的 HTTP 响应。请确认该资源是 Web 服务。")
+	}
+}
+
+// certificate 按 SNI 签发证书，只为已有路由的域名签发；没有 SNI（通过 IP 访问）时签发只含 VIP 的证书
+func (p *WebProxy) certificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	p.mu.RLock()
+	certs, vip := p.certs, p.vip
+	p.mu.RUnlock()
+
+	domain := normalizeHost(hello.ServerName)
+	if domain != "" && !p.HasRoute(domain) {
+		return nil, fmt.Errorf("未知的站点: %s", domain)
+	}
+	return certs(domain, vip)
+}
+
+// tunnelAddr 报告后端地址是否为隧道（Tailscale）地址
+func tunnelAddr(remoteAddr string) bool {
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	return err == nil && tsaddr.IsTailscaleIP(addrPort.Addr().Unmap())
+}
+
+// normalizeHost 去掉 Host 中的端口和末尾的点，转为小写
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// errorPage 错误页面模板
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "PingFang SC", "Microsoft YaHei", sans-serif; background: #f5f6f8; color: #303133; margin: 0; }
+main { max-width: 560px; margin: 12vh auto; background: #fff; border-radius: 8px; padding: 32px 40px; box-shadow: 0 2px 12px rgba(0, 0, 0, .08); }
+h1 { font-size: 22px; margin: 0 0 12px; }
+p { line-height: 1.6; color: #606266; }
+code { background: #f0f2f5; padding: 2px 6px; border-radius: 4px; }
+footer { margin-top: 24px; font-size: 12px; color: #909399; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+{{if .Domain}}<p><code>{{.Domain}}</code></p>{{end}}
+<p>{{.Message}}</p>
+<footer>{{.Status}} · AWECloud Signaling Desktop</footer>
+</main>
+</body>
+</html>
+`))
+
+// writeErrorPage 返回错误页面
+func writeErrorPage(w http.ResponseWriter, status int, domain, title, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	errorPage.Execute(w, map[string]string{
+		"Title":   title,
+		"Domain":  domain,
+		"Message": message,
+		"Status":  fmt.Sprintf("%d %s", status, http.StatusText(status)),
+	})
+}
+
+// countingBody 统计请求体字节数
+type countingBody struct {
+	io.ReadCloser
+	traffic *traffic
+	live    *liveConn
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.traffic.addIn(b.live, n)
+	return n, err
+}
+
+// countingResponseWriter 统计响应体字节数（协议升级后的字节不经过这里，不计入）
+type countingResponseWriter struct {
+	http.ResponseWriter
+	traffic *traffic
+	live    *liveConn
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.traffic.addOut(w.live, n)
+	return n, err
+}
+
+// Unwrap 供 http.ResponseController 取得底层连接（Flush、WebSocket 升级时 Hijack）
+func (w *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/open-beagle/awecloud-signaling-desktop/internal/localca"
+)
+
+// startWebProxy 启动使用本机拨号的 Web 代理，返回代理、HTTP 地址和 HTTPS 地址（certs 为空时不监听 HTTPS）
+func startWebProxy(t *testing.T, dial DialFunc, certs CertFunc) (*WebProxy, string, string) {
+	t.Helper()
+	if dial == nil {
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+	p := NewWebProxy(dial)
+	httpsPort := 0
+	if certs != nil {
+		p.SetCertFunc(certs)
+		httpsPort = freePort(t)
+	}
+	httpPort := freePort(t)
+	if err := p.Start("127.0.0.1", httpPort, httpsPort); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Stop)
+	return p, net.JoinHostPort("127.0.0.1", strconv.Itoa(httpPort)), net.JoinHostPort("127.0.0.1", strconv.Itoa(httpsPort))
+}
+
+// webGet 以 host 为 Host 头部请求代理
+func webGet(t *testing.T, addr, host string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "http://"+addr+"/path?q=1", nil)
+	req.Host = host
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestWebProxyRoutesByHost(t *testing.T) {
+	backend := func(name string) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s host=%s proto=%s for=%t",
+				name, r.URL.RequestURI(), r.Header.Get("X-Forwarded-Host"), r.Header.Get("X-Forwarded-Proto"), r.Header.Get("X-Forwarded-For") != "")
+		}))
+		t.Cleanup(srv.Close)
+		return srv.Listener.Addr().String()
+	}
+	p, addr, _ := startWebProxy(t, nil, nil)
+	p.AddRoute(WebRoute{Domain: "Grafana.Beagle.", RemoteAddr: backend("grafana")})
+	p.AddRoute(WebRoute{Domain: "kibana.beagle", RemoteAddr: backend("kibana")})
+
+	if _, body := webGet(t, addr, "grafana.beagle"); body != "grafana /path?q=1 host=grafana.beagle proto=http for=true" {
+		t.Fatalf("grafana.beagle got %q", body)
+	}
+	if _, body := webGet(t, addr, "KIBANA.beagle:80"); !strings.HasPrefix(body, "kibana ") {
+		t.Fatalf("kibana.beagle got %q", body)
+	}
+
+	resp, body := webGet(t, addr, "unknown.beagle")
+	if resp.StatusCode != http.StatusNotFound || !strings.Contains(body, "unknown.beagle") {
+		t.Fatalf("unknown host: %d %q", resp.StatusCode, body)
+	}
+
+	stats, ok := p.Stats("grafana.beagle")
+	if !ok || stats.TotalConns != 1 || stats.BytesOut == 0 || stats.ActiveConns != 0 {
+		t.Fatalf("grafana stats = %+v, %v", stats, ok)
+	}
+}
+
+func TestWebProxyErrorPageWhenAgentUnreachable(t *testing.T) {
+	p, addr, _ := startWebProxy(t, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("peer offline")
+	}, nil)
+	p.AddRoute(WebRoute{Domain: "grafana.beagle", RemoteAddr: "100.64.0.9:3000"})
+
+	resp, body := webGet(t, addr, "grafana.beagle")
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(body, "无法连接到服务") || !strings.Contains(body, "grafana.beagle") {
+		t.Fatalf("error page does not explain the failure: %q", body)
+	}
+	stats, _ := p.Stats("grafana.beagle")
+	if stats.DialFailures != 1 || !strings.Contains(stats.LastError, "peer offline") {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestWebProxyUpgradesWebSocket(t *testing.T) {
+	// 后端接受协议升级后原样回写收到的数据
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+	t.Cleanup(srv.Close)
+
+	p, addr, _ := startWebProxy(t, nil, nil)
+	p.AddRoute(WebRoute{Domain: "ws.beagle", RemoteAddr: srv.Listener.Addr().String()})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET /socket HTTP/1.1\r\nHost: ws.beagle\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade response: %v, %v", resp, err)
+	}
+	conn.Write([]byte("frame"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "frame" {
+		t.Fatalf("echo over upgraded connection = %q, %v", buf, err)
+	}
+}
+
+func TestWebProxyServesHTTPSFromLocalCA(t *testing.T) {
+	ca, err := localca.Load(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("X-Forwarded-Proto"))
+	}))
+	t.Cleanup(srv.Close)
+
+	p, _, httpsAddr := startWebProxy(t, nil, ca.Certificate)
+	if !p.HTTPS() {
+		t.Fatal("HTTPS listener did not start")
+	}
+	p.AddRoute(WebRoute{Domain: "grafana.beagle", RemoteAddr: srv.Listener.Addr().String()})
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: ca.Pool(), ServerName: "grafana.beagle"},
+	}}
+	defer client.CloseIdleConnections()
+	req, _ := http.NewRequest("GET", "https://"+httpsAddr+"/", nil)
+	req.Host = "grafana.beagle"
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("HTTPS request must verify against the local CA: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "https" {
+		t.Fatalf("X-Forwarded-Proto = %q, want https", body)
+	}
+
+	// 没有路由的域名不签发证书
+	conn, err := tls.Dial("tcp", httpsAddr, &tls.Config{RootCAs: ca.Pool(), ServerName: "unknown.beagle"})
+	if err == nil {
+		conn.Close()
+		t.Fatal("handshake for an unrouted domain must fail")
+	}
+}
+
+func TestWebProxyHTTPSBackendOnlyThroughTunnel(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure")
+	}))
+	t.Cleanup(backend.Close)
+
+	// 隧道地址拨号到本机的 HTTPS 后端
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == "100.64.0.5:443" {
+			addr = backend.Listener.Addr().String()
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	p, httpAddr, _ := startWebProxy(t, dial, nil)
+	p.AddRoute(WebRoute{Domain: "tunnel.beagle", RemoteAddr: "100.64.0.5:443", TLS: true})
+	p.AddRoute(WebRoute{Domain: "direct.beagle", RemoteAddr: backend.Listener.Addr().String(), TLS: true})
+
+	if resp, body := webGet(t, httpAddr, "tunnel.beagle"); resp.StatusCode != http.StatusOK || body != "secure" {
+		t.Fatalf("tunnel HTTPS backend: status %d, body %q", resp.StatusCode, body)
+	}
+	if resp, body := webGet(t, httpAddr, "direct.beagle"); resp.StatusCode != http.StatusBadGateway || !strings.Contains(body, "direct.beagle") {
+		t.Fatalf("HTTPS backend outside the tunnel must not be forwarded, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,273 @@
+// Package sysjournal 记录对系统的修改（系统 DNS、loopback alias、kubeconfig），用于异常退出后回滚
+//
+// 每次修改系统之前先写入日志，正常撤销后删除记录。进程崩溃或被强制结束时记录会留在日志中，
+// 下次启动（或用户手动"修复网络设置"）时，对所属进程已退出的记录执行回滚
+package sysjournal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/open-beagle/awecloud-signaling-desktop/internal/config"
+	"github.com/shirou/gopsutil/process"
+)
+
+// journalFile 日志文件名（位于 config.GetAppDir()）
+const journalFile = "system-changes.json"
+
+// Kind 系统修改类型
+type Kind string
+
+const (
+	KindDNS           Kind = "dns"            // 系统 DNS 配置（resolved drop-in、/etc/resolver、NRPT 等），Target 为域名后缀
+	KindLoopbackAlias Kind = "loopback-alias" // loopback 别名（macOS lo0 alias），Target 为 VIP
+	KindKubeconfig    Kind = "kubeconfig"     // kubeconfig 中写入的集群块，Target 为文件路径
+)
+
+// Entry 一条系统修改记录
+type Entry struct {
+	Kind         Kind      `json:"kind"`
+	Target       string    `json:"target"`
+	Data         string    `json:"data,omitempty"` // 回滚需要的附加信息
+	PID          int       `json:"pid"`            // 执行修改的进程
+	ProcessStart int64     `json:"process_start"`  // 进程启动时间（毫秒），用于识别 PID 复用
+	Time         time.Time `json:"time"`           // 记录时间
+}
+
+// RevertFunc 回滚一条记录，需要幂等（修改可能只执行了一半，或已被手动撤销）
+type RevertFunc func(entry *Entry) error
+
+// RepairResult 一条记录的回滚结果
+type RepairResult struct {
+	Kind   Kind   `json:"kind"`
+	Target string `json:"target"`
+	PID    int    `json:"pid"`
+	Error  string `json:"error,omitempty"` // 回滚失败原因，为空表示成功
+}
+
+// Journal 系统修改日志，记录保存在 JSON 文件中，每次变更立即落盘
+type Journal struct {
+	path         string
+	pid          int
+	processStart int64
+
+	reverters map[Kind]RevertFunc
+	alive     func(pid int, start int64) bool // 记录所属进程是否仍在运行（测试时替换）
+
+	mu sync.Mutex
+}
+
+// Open 打开应用目录下的系统修改日志
+func Open() (*Journal, error) {
+	appDir, err := config.GetAppDir()
+	if err != nil {
+		return nil, fmt.Errorf("获取应用目录失败: %w", err)
+	}
+	return New(filepath.Join(appDir, journalFile)), nil
+}
+
+// New 创建使用指定文件的系统修改日志
+func New(path string) *Journal {
+	pid := os.Getpid()
+	return &Journal{
+		path:         path,
+		pid:          pid,
+		processStart: processStartTime(pid),
+		reverters:    make(map[Kind]RevertFunc),
+		alive:        processAlive,
+	}
+}
+
+// SetReverter 设置某类记录的回滚函数
+func (j *Journal) SetReverter(kind Kind, fn RevertFunc) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.reverters[kind] = fn
+}
+
+// Record 在修改系统之前记录，同一进程对同一目标的重复记录只更新附加信息
+func (j *Journal) Record(kind Kind, target, data string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, err := j.load()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Kind == kind && e.Target == target && e.PID == j.pid {
+			if e.Data == data {
+				return nil
+			}
+			e.Data = data
+			return j.save(entries)
+		}
+	}
+
+	entries = append(entries, &Entry{
+		Kind:         kind,
+		Target:       target,
+		Data:         data,
+		PID:          j.pid,
+		ProcessStart: j.processStart,
+		Time:         time.Now(),
+	})
+	return j.save(entries)
+}
+
+// Lookup 返回当前进程对目标的记录，不存在时返回 nil
+func (j *Journal) Lookup(kind Kind, target string) *Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, err := j.load()
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if e.Kind == kind && e.Target == target && e.PID == j.pid {
+			return e
+		}
+	}
+	return nil
+}
+
+// Remove 修改已正常撤销（或不再需要回滚）后删除当前进程的记录，target 为空时删除该类型的全部记录
+func (j *Journal) Remove(kind Kind, target string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, err := j.load()
+	if err != nil {
+		return err
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.Kind == kind && (target == "" || e.Target == target) && e.PID == j.pid {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	if len(kept) == len(entries) {
+		return nil
+	}
+	return j.save(kept)
+}
+
+// Recover 回滚所属进程已退出的记录，回滚成功的记录从日志中删除，失败的保留到下次
+// 仍在运行的进程（包括当前进程）的记录不受影响
+func (j *Journal) Recover() []*RepairResult {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, err := j.load()
+	if err != nil {
+		log.Printf("[SysJournal] 读取系统修改日志失败: %v", err)
+		return nil
+	}
+
+	results := make([]*RepairResult, 0)
+	kept := make([]*Entry, 0, len(entries))
+	for _, e := range entries {
+		if e.PID == j.pid || j.alive(e.PID, e.ProcessStart) {
+			kept = append(kept, e)
+			continue
+		}
+
+		result := &RepairResult{Kind: e.Kind, Target: e.Target, PID: e.PID}
+		results = append(results, result)
+
+		revert, ok := j.reverters[e.Kind]
+		if !ok {
+			result.Error = fmt.Sprintf("不支持的修改类型: %s", e.Kind)
+			kept = append(kept, e)
+			continue
+		}
+		if err := revert(e); err != nil {
+			log.Printf("[SysJournal] 回滚 %s %s 失败: %v", e.Kind, e.Target, err)
+			result.Error = err.Error()
+			kept = append(kept, e)
+			continue
+		}
+		log.Printf("[SysJournal] 已回滚进程 %d 遗留的修改: %s %s", e.PID, e.Kind, e.Target)
+	}
+
+	if len(kept) != len(entries) {
+		if err := j.save(kept); err != nil {
+			log.Printf("[SysJournal] 保存系统修改日志失败: %v", err)
+		}
+	}
+	return results
+}
+
+// load 读取日志文件，文件不存在时返回空列表
+func (j *Journal) load() ([]*Entry, error) {
+	data, err := os.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取系统修改日志失败: %w", err)
+	}
+	var entries []*Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		// 日志损坏时无法得知修改了什么，丢弃后由各平台的清理函数兜底
+		log.Printf("[SysJournal] 系统修改日志损坏，已忽略: %v", err)
+		return nil, nil
+	}
+	return entries, nil
+}
+
+// save 写入日志文件（先写临时文件再重命名，避免写到一半崩溃留下损坏的日志）
+func (j *Journal) save(entries []*Entry) error {
+	if len(entries) == 0 {
+		if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除系统修改日志失败: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化系统修改日志失败: %w", err)
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("写入系统修改日志失败: %w", err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("写入系统修改日志失败: %w", err)
+	}
+	return nil
+}
+
+// processStartTime 返回进程启动时间（毫秒），获取失败时返回 0
+func processStartTime(pid int) int64 {
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return 0
+	}
+	start, err := p.CreateTime()
+	if err != nil {
+		return 0
+	}
+	return start
+}
+
+// processAlive 进程是否仍在运行，PID 相同但启动时间不同说明 PID 已被其他进程复用
+func processAlive(pid int, start int64) bool {
+	exists, err := process.PidExists(int32(pid))
+	if err != nil || !exists {
+		return false
+	}
+	if start == 0 {
+		return true
+	}
+	current := processStartTime(pid)
+	return current == 0 || current == start
+}
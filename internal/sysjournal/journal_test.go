@@ -0,0 +1,116 @@
+package sysjournal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestJournal(t *testing.T) *Journal {
+	j := New(filepath.Join(t.TempDir(), journalFile))
+	j.alive = func(pid int, start int64) bool { return false }
+	return j
+}
+
+func TestRecordAndRemove(t *testing.T) {
+	j := newTestJournal(t)
+
+	if err := j.Record(KindLoopbackAlias, "127.1.0.1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Record(KindLoopbackAlias, "127.1.0.1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Record(KindKubeconfig, "/home/u/.kube/config", "created"); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := j.load()
+	if len(entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(entries))
+	}
+	if e := j.Lookup(KindKubeconfig, "/home/u/.kube/config"); e == nil || e.Data != "created" {
+		t.Errorf("Lookup = %+v", e)
+	}
+
+	if err := j.Remove(KindLoopbackAlias, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Remove(KindKubeconfig, "/home/u/.kube/config"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(j.path); !os.IsNotExist(err) {
+		t.Errorf("journal file should be removed when empty: %v", err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	j := newTestJournal(t)
+	j.save([]*Entry{
+		{Kind: KindDNS, Target: "beagle", PID: 100},
+		{Kind: KindLoopbackAlias, Target: "127.1.0.1", PID: 100},
+		{Kind: KindLoopbackAlias, Target: "127.1.0.2", PID: 200},
+		{Kind: KindKubeconfig, Target: "/tmp/config", PID: 100},
+	})
+	j.alive = func(pid int, start int64) bool { return pid == 200 }
+
+	var reverted []string
+	j.SetReverter(KindDNS, func(e *Entry) error {
+		reverted = append(reverted, e.Target)
+		return nil
+	})
+	j.SetReverter(KindLoopbackAlias, func(e *Entry) error {
+		return errors.New("permission denied")
+	})
+
+	results := j.Recover()
+	if len(results) != 3 {
+		t.Fatalf("results = %d, want 3", len(results))
+	}
+	if len(reverted) != 1 || reverted[0] != "beagle" {
+		t.Errorf("reverted = %v", reverted)
+	}
+	for _, r := range results {
+		if (r.Kind == KindDNS) != (r.Error == "") {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+
+	// 回滚失败、无回滚函数和仍在运行的进程的记录保留
+	entries, _ := j.load()
+	if len(entries) != 3 {
+		t.Errorf("kept entries = %d, want 3", len(entries))
+	}
+	for _, e := range entries {
+		if e.Kind == KindDNS {
+			t.Errorf("reverted entry kept: %+v", e)
+		}
+	}
+}
+
+func TestRecoverSkipsCurrentProcess(t *testing.T) {
+	j := newTestJournal(t)
+	if err := j.Record(KindDNS, "beagle", ""); err != nil {
+		t.Fatal(err)
+	}
+	j.SetReverter(KindDNS, func(e *Entry) error {
+		t.Errorf("current process entry reverted: %+v", e)
+		return nil
+	})
+	if results := j.Recover(); len(results) != 0 {
+		t.Errorf("results = %v, want none", results)
+	}
+}
+
+func TestCorruptJournal(t *testing.T) {
+	j := newTestJournal(t)
+	if err := os.WriteFile(j.path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Record(KindDNS, "beagle", ""); err != nil {
+		t.Fatal(err)
+	}
+	if e := j.Lookup(KindDNS, "beagle"); e == nil {
+		t.Error("entry not recorded after corrupt journal")
+	}
+}
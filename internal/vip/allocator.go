@@ -1,41 +1,100 @@
 // Package vip 提供 VIP（Virtual IP）地址分配功能
-// 使用 127.1.0.0/16 地址段，为每个远程服务分配唯一的本地地址
+// 默认使用 127.1.0.0/16 地址段（可配置），为每个远程服务分配唯一的本地地址
 package vip
 
 import (
+	"encoding/binary"
 	"fmt"
 	"log"
+	"net"
 	"sync"
+	"time"
 )
 
+// DefaultCIDR VIP 地址段
+const DefaultCIDR = "127.1.0.0/16"
+
+// DefaultQuarantine 释放的 VIP 可以被回收的最短隔离期
+// 地址只在地址段耗尽时才回收：释放时间超过隔离期的地址中最早释放的一个让给新域名。
+// 隔离期内地址仍保留给原域名（再次解析得到同一 VIP），不会分配给其他域名，
+// 避免客户端缓存的旧地址（DNS 缓存、known_hosts）指向另一个服务
+const DefaultQuarantine = 7 * 24 * time.Hour
+
 // AllocateCallback VIP 分配后的回调函数类型
 // macOS 平台用于在分配 VIP 后自动添加 loopback alias
 type AllocateCallback func(vip string) error
 
 // Allocator VIP 地址分配器
-// 将域名映射到 127.1.x.x 地址，避免端口冲突
+// 将域名映射到地址段内的地址，避免端口冲突
+// 域名第一次分配的 VIP 会保留给该域名：Release 后再次分配仍得到同一地址，
+// 只有地址段耗尽时才回收隔离期已过的地址。设置 Store 后分配结果持久化，重启后保持不变，
+// 直到 Reset 清空（App.ResetVIPMap）
 type Allocator struct {
-	// 域名 → VIP 映射
+	// 域名 → VIP 映射（当前生效，本地 DNS 据此应答）
 	domainToVIP map[string]string
 	// VIP → 域名 反向映射
 	vipToDomain map[string]string
 
-	// 下一个可分配的地址序号（从 1 开始）
-	nextIndex int
+	// 域名 → VIP 的固定分配（包括隔离期内已 Release 的域名），持久化到 store
+	assigned map[string]string
+	// VIP → 域名 的固定分配，新域名不会分配到这些地址
+	reserved map[string]string
+	// 本次运行中已 Release 的域名 → 释放时间，地址段耗尽时按释放时间回收
+	released map[string]time.Time
+
+	network *net.IPNet // VIP 地址段
+	base    uint32     // 地址段的第一个地址
+	used    []uint64   // 地址段内各地址是否已固定分配（位图，按相对 base 的序号）
+	cursor  int        // 下次开始查找空闲地址的序号，循环使用地址段，回收的地址尽量晚复用
+
+	quarantine time.Duration    // 隔离期
+	now        func() time.Time // 当前时间（测试时替换）
 
 	// VIP 分配后的回调（macOS 用于添加 loopback alias）
 	onAllocate AllocateCallback
+	// VIP 被回收（不再属于任何域名）后的回调（macOS 用于删除 loopback alias）
+	onRecycle AllocateCallback
+
+	// 分配结果的持久化文件，为 nil 时只保存在内存中
+	store *Store
+
+	// 持有写锁期间回收的 VIP，unlock 时在锁外执行回收回调
+	recycled []string
 
 	mu sync.RWMutex
+	// 串行执行分配 / 回收回调；回调（macOS 上是提权的 ifconfig）不在 mu 内执行
+	hookMu sync.Mutex
 }
 
-// NewAllocator 创建 VIP 分配器
+// NewAllocator 使用默认地址段创建 VIP 分配器
 func NewAllocator() *Allocator {
+	a, _ := NewAllocatorWithCIDR(DefaultCIDR)
+	return a
+}
+
+// NewAllocatorWithCIDR 使用指定地址段创建 VIP 分配器（地址段需先通过 ValidatePool 校验）
+func NewAllocatorWithCIDR(cidr string) (*Allocator, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 VIP 地址段 %q: %w", cidr, err)
+	}
+	if network.IP.To4() == nil {
+		return nil, fmt.Errorf("VIP 地址段必须是 IPv4: %s", cidr)
+	}
+	ones, bits := network.Mask.Size()
+	size := 1 << (bits - ones)
 	return &Allocator{
 		domainToVIP: make(map[string]string),
 		vipToDomain: make(map[string]string),
-		nextIndex:   1,
-	}
+		assigned:    make(map[string]string),
+		reserved:    make(map[string]string),
+		released:    make(map[string]time.Time),
+		network:     network,
+		base:        binary.BigEndian.Uint32(network.IP.To4()),
+		used:        make([]uint64, (size+63)/64),
+		quarantine:  DefaultQuarantine,
+		now:         time.Now,
+	}, nil
 }
 
 // SetOnAllocate 设置 VIP 分配后的回调函数
@@ -46,41 +105,254 @@ func (a *Allocator) SetOnAllocate(cb AllocateCallback) {
 	a.onAllocate = cb
 }
 
+// SetOnRecycle 设置 VIP 被回收后的回调函数
+// macOS 平台用于删除不再属于任何域名的 loopback alias
+func (a *Allocator) SetOnRecycle(cb AllocateCallback) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.onRecycle = cb
+}
+
+// SetQuarantine 设置释放的 VIP 可以被回收的最短隔离期，0 表示地址段耗尽时可以立即复用已释放的地址
+func (a *Allocator) SetQuarantine(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.quarantine = d
+}
+
+// SetStore 设置持久化文件并恢复其中的分配
+// 恢复的分配保持固定，不会过期回收（只有 Reset 清空）；
+// 无效地址、不在 VIP 地址段内或与其他域名重复的分配会被丢弃并记录日志，返回恢复的分配数
+func (a *Allocator) SetStore(store *Store) (int, error) {
+	assignments, err := store.Load()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.store = store
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for domain, vip := range assignments {
+		if err := a.checkAssignment(domain, vip); err != nil {
+			log.Printf("[VIP] 丢弃冲突的分配 %s -> %s: %v", domain, vip, err)
+			continue
+		}
+		a.reserve(domain, vip)
+		restored++
+	}
+	if restored != len(assignments) {
+		a.save()
+	}
+	return restored, nil
+}
+
+// checkAssignment 检查恢复的分配是否可用
+func (a *Allocator) checkAssignment(domain, vip string) error {
+	if domain == "" {
+		return fmt.Errorf("域名为空")
+	}
+	index, ok := a.indexOf(vip)
+	if !ok {
+		return fmt.Errorf("不是 VIP 地址段 %s 内可分配的地址", a.network)
+	}
+	if other, ok := a.reserved[vip]; ok && other != domain {
+		return fmt.Errorf("地址已分配给 %s", other)
+	}
+	if a.isUsed(index) && a.reserved[vip] != domain {
+		return fmt.Errorf("地址已被占用")
+	}
+	if current, ok := a.domainToVIP[domain]; ok && current != vip {
+		return fmt.Errorf("域名当前使用 %s", current)
+	}
+	if other, ok := a.vipToDomain[vip]; ok && other != domain {
+		return fmt.Errorf("地址正被 %s 使用", other)
+	}
+	return nil
+}
+
+// save 持久化固定分配，调用方需持有写锁；失败只记录日志（不影响本次运行）
+func (a *Allocator) save() {
+	if a.store == nil {
+		return
+	}
+	if err := a.store.Save(a.assigned); err != nil {
+		log.Printf("[VIP] 保存 VIP 分配失败: %v", err)
+	}
+}
+
 // Allocate 为域名分配 VIP 地址
 // 如果域名已分配，返回已有的 VIP；否则分配新的
 func (a *Allocator) Allocate(domain string) (string, error) {
 	a.mu.Lock()
-	defer a.mu.Unlock()
+	vip, fresh, err := a.allocate(domain)
+	a.unlock()
+
+	// 触发回调（macOS 用于添加 loopback alias），返回前地址已可用
+	if fresh {
+		a.runHook(vip, true)
+	}
+	return vip, err
+}
 
+// allocate 为域名分配 VIP，fresh 表示映射是本次新建的（需要触发分配回调），调用方需持有写锁
+func (a *Allocator) allocate(domain string) (vip string, fresh bool, err error) {
 	// 已分配，直接返回
 	if vip, ok := a.domainToVIP[domain]; ok {
-		return vip, nil
+		return vip, false, nil
 	}
 
-	// 分配新 VIP
-	if a.nextIndex > 65534 {
-		return "", fmt.Errorf("VIP 地址耗尽（最多 65534 个）")
+	// 之前分配过（Release 过，或从持久化文件恢复），沿用原来的 VIP
+	vip, ok := a.assigned[domain]
+	if ok {
+		delete(a.released, domain)
+	} else {
+		// 分配新 VIP：从上次分配的位置往后找空闲地址，地址段耗尽时回收一个隔离期已过的地址
+		index, ok := a.nextFree()
+		if !ok && a.reclaim() {
+			index, ok = a.nextFree()
+		}
+		if !ok {
+			return "", false, fmt.Errorf("VIP 地址耗尽（地址段 %s）", a.network)
+		}
+		vip = a.addressOf(index)
+		a.cursor = index + 1
+		a.reserve(domain, vip)
+		a.save()
 	}
 
-	// 127.1.x.x：高字节 = index/256, 低字节 = index%256
-	// 跳过 .0 和 .255 避免广播地址问题
-	hi := (a.nextIndex-1)/254 + 0 // 0-255
-	lo := (a.nextIndex-1)%254 + 1 // 1-254
-
-	vip := fmt.Sprintf("127.1.%d.%d", hi, lo)
-	a.nextIndex++
-
 	a.domainToVIP[domain] = vip
 	a.vipToDomain[vip] = domain
+	return vip, true, nil
+}
+
+// reserve 将 VIP 固定分配给域名，调用方需持有写锁
+func (a *Allocator) reserve(domain, vip string) {
+	a.assigned[domain] = vip
+	a.reserved[vip] = domain
+	if index, ok := a.indexOf(vip); ok {
+		a.used[index/64] |= 1 << (index % 64)
+	}
+}
+
+// recycle 回收域名的 VIP，之后地址可以分配给其他域名，调用方需持有写锁
+// 回收回调在 unlock 时执行
+func (a *Allocator) recycle(domain string) {
+	vip, ok := a.assigned[domain]
+	if !ok {
+		return
+	}
+	delete(a.assigned, domain)
+	delete(a.reserved, vip)
+	delete(a.released, domain)
+	if index, ok := a.indexOf(vip); ok {
+		a.used[index/64] &^= 1 << (index % 64)
+	}
+	a.recycled = append(a.recycled, vip)
+	log.Printf("[VIP] 已回收: %s (%s)", vip, domain)
+}
+
+// reclaim 回收隔离期已过的域名中最早释放的一个，返回是否回收了地址，调用方需持有写锁
+func (a *Allocator) reclaim() bool {
+	now := a.now()
+	oldest, oldestAt := "", time.Time{}
+	for domain, since := range a.released {
+		if now.Sub(since) < a.quarantine {
+			continue
+		}
+		if oldest == "" || since.Before(oldestAt) {
+			oldest, oldestAt = domain, since
+		}
+	}
+	if oldest == "" {
+		return false
+	}
+	a.recycle(oldest)
+	return true
+}
+
+// unlock 释放写锁，然后在锁外执行持锁期间回收的 VIP 的回收回调
+func (a *Allocator) unlock() {
+	recycled := a.recycled
+	a.recycled = nil
+	a.mu.Unlock()
+	for _, vip := range recycled {
+		a.runHook(vip, false)
+	}
+}
+
+// runHook 在锁外执行分配（allocated 为 true）或回收回调
+// 回调按 hookMu 串行执行，执行前重新检查地址当前是否已分配：
+// 已重新分配给其他域名的地址不删除 alias，已被回收的地址不添加 alias，最后一次执行的回调总是与分配状态一致
+func (a *Allocator) runHook(vip string, allocated bool) {
+	a.hookMu.Lock()
+	defer a.hookMu.Unlock()
+
+	a.mu.RLock()
+	_, reserved := a.reserved[vip]
+	cb := a.onRecycle
+	if allocated {
+		cb = a.onAllocate
+	}
+	a.mu.RUnlock()
+
+	if cb == nil || reserved != allocated {
+		return
+	}
+	if err := cb(vip); err != nil {
+		if allocated {
+			log.Printf("[VIP] 分配回调失败 (%s): %v", vip, err)
+		} else {
+			log.Printf("[VIP] 回收回调失败 (%s): %v", vip, err)
+		}
+	}
+}
 
-	// 触发回调（macOS 用于添加 loopback alias）
-	if a.onAllocate != nil {
-		if err := a.onAllocate(vip); err != nil {
-			log.Printf("[VIP] 分配回调失败 (%s -> %s): %v", domain, vip, err)
+// nextFree 从 cursor 开始循环查找空闲且可分配的地址序号
+func (a *Allocator) nextFree() (int, bool) {
+	size := a.size()
+	for i := 0; i < size; i++ {
+		index := (a.cursor + i) % size
+		if !a.isUsed(index) && a.usable(index) {
+			return index, true
 		}
 	}
+	return 0, false
+}
+
+// size 返回地址段的地址数
+func (a *Allocator) size() int {
+	ones, bits := a.network.Mask.Size()
+	return 1 << (bits - ones)
+}
 
-	return vip, nil
+// isUsed 报告序号对应的地址是否已固定分配
+func (a *Allocator) isUsed(index int) bool {
+	return a.used[index/64]&(1<<(index%64)) != 0
+}
+
+// usable 报告序号对应的地址是否可分配：跳过 .0 和 .255 避免广播地址问题
+func (a *Allocator) usable(index int) bool {
+	last := byte(a.base + uint32(index))
+	return last != 0 && last != 255
+}
+
+// addressOf 返回序号对应的地址
+func (a *Allocator) addressOf(index int) string {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, a.base+uint32(index))
+	return ip.String()
+}
+
+// indexOf 返回地址在地址段内的序号，不是地址段内可分配的地址时 ok 为 false
+func (a *Allocator) indexOf(vip string) (int, bool) {
+	ip := net.ParseIP(vip).To4()
+	if ip == nil || !a.network.Contains(ip) {
+		return 0, false
+	}
+	index := int(binary.BigEndian.Uint32(ip) - a.base)
+	return index, a.usable(index)
 }
 
 // Resolve 根据 VIP 查找域名
@@ -91,6 +363,11 @@ func (a *Allocator) Resolve(vip string) (string, bool) {
 	return domain, ok
 }
 
+// Network 返回 VIP 地址段（本地 DNS 用于判断反向查询是否由本地应答）
+func (a *Allocator) Network() *net.IPNet {
+	return a.network
+}
+
 // GetVIP 根据域名查找 VIP（不分配）
 func (a *Allocator) GetVIP(domain string) (string, bool) {
 	a.mu.RLock()
@@ -99,8 +376,11 @@ func (a *Allocator) GetVIP(domain string) (string, bool) {
 	return vip, ok
 }
 
-// Release removes a stale DNS mapping. Platform loopback aliases may remain
-// until Cleanup, but without this mapping the local DNS server returns NXDOMAIN.
+// Release removes a stale DNS mapping. Without this mapping the local DNS server
+// returns NXDOMAIN (or resolves the domain again). The address stays assigned to
+// the domain, so allocating it again yields the same VIP; it is only recycled (and
+// its platform loopback alias removed) when the pool runs out of free addresses
+// and the quarantine period has passed.
 func (a *Allocator) Release(domain string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -110,6 +390,35 @@ func (a *Allocator) Release(domain string) {
 	}
 	delete(a.domainToVIP, domain)
 	delete(a.vipToDomain, vip)
+	if _, ok := a.assigned[domain]; ok {
+		a.released[domain] = a.now()
+	}
+}
+
+// Reset 清空全部分配（包括持久化文件），之后的域名重新从第一个地址开始分配
+// 返回清空前生效的映射（域名 → VIP），调用方据此停止这些 VIP 上的代理
+func (a *Allocator) Reset() (map[string]string, error) {
+	a.mu.Lock()
+	defer a.unlock()
+
+	active := a.domainToVIP
+	for domain := range a.assigned {
+		a.recycle(domain)
+	}
+	a.domainToVIP = make(map[string]string)
+	a.vipToDomain = make(map[string]string)
+	a.assigned = make(map[string]string)
+	a.reserved = make(map[string]string)
+	a.released = make(map[string]time.Time)
+	clear(a.used)
+	a.cursor = 0
+
+	if a.store != nil {
+		if err := a.store.Delete(); err != nil {
+			return active, err
+		}
+	}
+	return active, nil
 }
 
 // GetAll 获取所有映射（用于调试/展示）
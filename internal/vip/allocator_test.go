@@ -1,7 +1,11 @@
 package vip
 
 import (
+	"fmt"
+	"net"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestReleaseRemovesBothVIPMappings(t *testing.T) {
@@ -20,3 +24,133 @@ func TestReleaseRemovesBothVIPMappings(t *testing.T) {
 		t.Fatal("expected reverse VIP mapping to be released")
 	}
 }
+
+func TestReleasedVIPIsRecycledAfterQuarantine(t *testing.T) {
+	allocator, err := NewAllocatorWithCIDR("127.9.0.0/28")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	allocator.now = func() time.Time { return now }
+	allocator.SetQuarantine(time.Hour)
+	var recycled []string
+	allocator.SetOnRecycle(func(vip string) error {
+		recycled = append(recycled, vip)
+		return nil
+	})
+
+	// /28 中 .0 不可分配，可用 .1 ~ .15
+	var addresses []string
+	for i := 1; i <= 15; i++ {
+		address, err := allocator.Allocate(fmt.Sprintf("d%d.beagle", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		addresses = append(addresses, address)
+	}
+	if _, err := allocator.Allocate("full.beagle"); err == nil {
+		t.Fatal("expected pool to be exhausted")
+	}
+
+	// 隔离期内释放的地址不分配给其他域名
+	allocator.Release("d3.beagle")
+	if _, err := allocator.Allocate("full.beagle"); err == nil {
+		t.Fatal("quarantined VIP must not be handed to another domain")
+	}
+
+	now = now.Add(2 * time.Hour)
+	address, err := allocator.Allocate("full.beagle")
+	if err != nil || address != addresses[2] {
+		t.Fatalf("expected recycled %s, got %s (err=%v)", addresses[2], address, err)
+	}
+	// 回收后立即分配给了新域名，loopback alias 仍在使用，不触发回收回调
+	if len(recycled) != 0 {
+		t.Fatalf("recycle callback must not run for a reused VIP, got %v", recycled)
+	}
+	if again, _ := allocator.Allocate("d3.beagle"); again == addresses[2] {
+		t.Fatal("domain must not reclaim a VIP recycled to another domain")
+	}
+}
+
+func TestRecycleCallbackRunsOutsideLock(t *testing.T) {
+	allocator := NewAllocator()
+	var recycled []string
+	allocator.SetOnRecycle(func(vip string) error {
+		// 回调中访问分配器：在锁内执行回调时会死锁
+		if _, ok := allocator.Resolve(vip); ok {
+			t.Errorf("recycled VIP %s must not resolve", vip)
+		}
+		recycled = append(recycled, vip)
+		return nil
+	})
+	address, err := allocator.Allocate("a.beagle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		allocator.Reset()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reset deadlocked in the recycle callback")
+	}
+	if len(recycled) != 1 || recycled[0] != address {
+		t.Fatalf("recycle callback must report %s, got %v", address, recycled)
+	}
+}
+
+func TestAllocateSkipsNetworkAndBroadcastAddresses(t *testing.T) {
+	allocator, err := NewAllocatorWithCIDR("127.9.0.0/23")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 508; i++ {
+		address, err := allocator.Allocate(fmt.Sprintf("d%d.beagle", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(address, ".0") || strings.HasSuffix(address, ".255") || seen[address] {
+			t.Fatalf("unexpected address %s", address)
+		}
+		seen[address] = true
+	}
+	if _, err := allocator.Allocate("extra.beagle"); err == nil {
+		t.Fatal("expected pool to be exhausted after 508 addresses")
+	}
+}
+
+func TestValidatePool(t *testing.T) {
+	original := interfaceAddrs
+	t.Cleanup(func() { interfaceAddrs = original })
+	interfaceAddrs = func() (map[string][]net.Addr, error) {
+		_, docker, _ := net.ParseCIDR("127.200.0.1/16")
+		return map[string][]net.Addr{"docker0": {docker}}, nil
+	}
+
+	tests := []struct {
+		pool string
+		ok   bool
+	}{
+		{"127.1.0.0/16", true},
+		{"127.77.10.0/24", true},
+		{"10.1.0.0/16", false},    // 不在 loopback 地址段
+		{"127.0.0.0/16", false},   // 包含 127.0.0.1
+		{"127.53.0.0/16", false},  // 包含本地 DNS 地址
+		{"127.200.0.0/24", false}, // 与 docker0 冲突
+		{"127.0.0.0/8", false},    // 过大
+		{"127.1.0.0/30", false},   // 过小
+		{"fd00::/64", false},      // 非 IPv4
+		{"not-a-cidr", false},
+	}
+	for _, tt := range tests {
+		err := ValidatePool(tt.pool, "127.53.0.2")
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidatePool(%q) = %v, want ok=%v", tt.pool, err, tt.ok)
+		}
+	}
+}
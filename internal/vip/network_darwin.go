@@ -2,7 +2,7 @@
 
 // macOS VIP 网络配置：通过 ifconfig lo0 alias 添加 loopback 别名
 // macOS 默认只有 127.0.0.1，127.1.x.x 需要逐个添加
-// alias 不持久化，重启后自动消失，异常退出残留无害
+// alias 不持久化，重启后自动消失；异常退出的残留记录在系统修改日志中，下次启动时删除
 package vip
 
 import (
@@ -13,12 +13,14 @@ import (
 	"sync"
 
 	"github.com/open-beagle/awecloud-signaling-desktop/internal/privilege"
+	"github.com/open-beagle/awecloud-signaling-desktop/internal/sysjournal"
 )
 
 // NetworkConfig macOS 网络配置管理器
 type NetworkConfig struct {
-	aliases []string   // 已添加的 loopback alias 列表
-	mu      sync.Mutex // 保护 aliases 列表
+	aliases []string            // 已添加的 loopback alias 列表
+	journal *sysjournal.Journal // 系统修改日志，可为空
+	mu      sync.Mutex          // 保护 aliases 列表
 }
 
 // NewNetworkConfig 创建网络配置管理器
@@ -28,6 +30,13 @@ func NewNetworkConfig() *NetworkConfig {
 	}
 }
 
+// SetJournal 设置系统修改日志，添加 alias 前先记录，异常退出后由下次启动回滚
+func (n *NetworkConfig) SetJournal(j *sysjournal.Journal) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.journal = j
+}
+
 // Setup macOS 上初始化时不需要预配置（alias 按需添加）
 func (n *NetworkConfig) Setup() error {
 	log.Printf("[Network] macOS 网络配置管理器已初始化（VIP alias 按需添加）")
@@ -58,6 +67,11 @@ func (n *NetworkConfig) Cleanup() {
 
 	log.Printf("[Network] 已清理 %d 个 loopback alias", len(n.aliases))
 	n.aliases = n.aliases[:0]
+	if n.journal != nil {
+		if err := n.journal.Remove(sysjournal.KindLoopbackAlias, ""); err != nil {
+			log.Printf("[Network] 删除 loopback alias 修改记录失败: %v", err)
+		}
+	}
 }
 
 // AddAlias 为指定 VIP 添加 loopback alias
@@ -72,6 +86,13 @@ func (n *NetworkConfig) AddAlias(vip string) error {
 		}
 	}
 
+	// 先记录再修改，记录失败不影响使用（只是异常退出后无法自动回滚）
+	if n.journal != nil {
+		if err := n.journal.Record(sysjournal.KindLoopbackAlias, vip, ""); err != nil {
+			log.Printf("[Network] 记录 loopback alias %s 失败: %v", vip, err)
+		}
+	}
+
 	// 检查系统上是否已存在（可能是上次异常退出残留）
 	if isAliasExists(vip) {
 		log.Printf("[Network] loopback alias %s 已存在，跳过添加", vip)
@@ -89,6 +110,46 @@ func (n *NetworkConfig) AddAlias(vip string) error {
 	return nil
 }
 
+// DropAlias 删除已添加的 loopback alias（VIP 被回收、不再属于任何域名时调用）
+func (n *NetworkConfig) DropAlias(vip string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	index := -1
+	for i, existing := range n.aliases {
+		if existing == vip {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil
+	}
+
+	if err := RemoveAlias(vip); err != nil {
+		return err
+	}
+	n.aliases = append(n.aliases[:index], n.aliases[index+1:]...)
+	if n.journal != nil {
+		if err := n.journal.Remove(sysjournal.KindLoopbackAlias, vip); err != nil {
+			log.Printf("[Network] 删除 loopback alias 修改记录失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// RemoveAlias 删除 loopback alias（回滚异常退出遗留的 alias），不存在时直接返回
+func RemoveAlias(vip string) error {
+	if !isAliasExists(vip) {
+		return nil
+	}
+	if _, err := privilege.RunWithPrivilege(fmt.Sprintf("ifconfig lo0 -alias %s", vip)); err != nil {
+		return fmt.Errorf("删除 loopback alias %s 失败: %w", vip, err)
+	}
+	log.Printf("[Network] 已删除 loopback alias: %s", vip)
+	return nil
+}
+
 // isAliasExists 检查 loopback alias 是否已存在
 func isAliasExists(vip string) bool {
 	cmd := exec.Command("ifconfig", "lo0")
@@ -4,7 +4,11 @@
 // Linux 的 127.0.0.0/8 整个地址段默认可用
 package vip
 
-import "log"
+import (
+	"log"
+
+	"github.com/open-beagle/awecloud-signaling-desktop/internal/sysjournal"
+)
 
 // NetworkConfig Linux 网络配置管理器
 type NetworkConfig struct{}
@@ -27,3 +31,16 @@ func (n *NetworkConfig) Cleanup() {}
 func (n *NetworkConfig) AddAlias(vip string) error {
 	return nil
 }
+
+// DropAlias Linux 上不添加 alias，无需删除
+func (n *NetworkConfig) DropAlias(vip string) error {
+	return nil
+}
+
+// SetJournal Linux 上不添加 alias，无需记录
+func (n *NetworkConfig) SetJournal(j *sysjournal.Journal) {}
+
+// RemoveAlias Linux 上不添加 alias，无需删除
+func RemoveAlias(vip string) error {
+	return nil
+}
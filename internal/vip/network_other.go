@@ -3,7 +3,11 @@
 // 其他平台 VIP 网络配置：空实现
 package vip
 
-import "log"
+import (
+	"log"
+
+	"github.com/open-beagle/awecloud-signaling-desktop/internal/sysjournal"
+)
 
 // NetworkConfig 其他平台网络配置管理器
 type NetworkConfig struct{}
@@ -26,3 +30,16 @@ func (n *NetworkConfig) Cleanup() {}
 func (n *NetworkConfig) AddAlias(vip string) error {
 	return nil
 }
+
+// DropAlias 其他平台空实现
+func (n *NetworkConfig) DropAlias(vip string) error {
+	return nil
+}
+
+// SetJournal 其他平台上不添加 alias，无需记录
+func (n *NetworkConfig) SetJournal(j *sysjournal.Journal) {}
+
+// RemoveAlias 其他平台上不添加 alias，无需删除
+func RemoveAlias(vip string) error {
+	return nil
+}
@@ -0,0 +1,82 @@
+package vip
+
+import (
+	"fmt"
+	"net"
+)
+
+// pool.go VIP 地址段校验
+// 代理只在 loopback 上监听，地址段必须位于 127.0.0.0/8 内，且不能与本机已在使用的地址冲突：
+//   - 不能包含 127.0.0.1（本机服务普遍监听）和调用方保留的地址（如本地 DNS 的监听地址）
+//   - 不能与非 loopback 接口上配置的网络重叠（部分容器、VPN 工具会把 127.x 地址配置到虚拟网卡上）
+
+// 地址段大小限制：至少 16 个地址，最多 /16（位图和分配时的线性查找都按地址数开销）
+const (
+	minPoolPrefix = 16
+	maxPoolPrefix = 28
+)
+
+// loopbackNetwork 127.0.0.0/8
+var loopbackNetwork = &net.IPNet{IP: net.IPv4(127, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)}
+
+// interfaceAddrs 返回本机接口及其地址（测试时替换）
+var interfaceAddrs = func() (map[string][]net.Addr, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]net.Addr, len(ifaces))
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			// loopback 上的别名可能是本程序上次添加的 VIP，不视为冲突
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		result[iface.Name] = addrs
+	}
+	return result, nil
+}
+
+// ValidatePool 校验 VIP 地址段，reserved 为调用方已占用、不能分配为 VIP 的地址
+func ValidatePool(cidr string, reserved ...string) error {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("无效的 VIP 地址段 %q: %w", cidr, err)
+	}
+	if network.IP.To4() == nil {
+		return fmt.Errorf("VIP 地址段必须是 IPv4: %s", cidr)
+	}
+	ones, _ := network.Mask.Size()
+	if ones < minPoolPrefix || ones > maxPoolPrefix {
+		return fmt.Errorf("VIP 地址段前缀长度必须在 /%d 到 /%d 之间: %s", minPoolPrefix, maxPoolPrefix, cidr)
+	}
+	if !loopbackNetwork.Contains(network.IP) {
+		return fmt.Errorf("VIP 地址段必须位于 127.0.0.0/8 内: %s", cidr)
+	}
+
+	for _, addr := range append([]string{"127.0.0.1"}, reserved...) {
+		if ip := net.ParseIP(addr); ip != nil && network.Contains(ip) {
+			return fmt.Errorf("VIP 地址段 %s 包含已占用的地址 %s", network, addr)
+		}
+	}
+
+	ifaces, err := interfaceAddrs()
+	if err != nil {
+		return fmt.Errorf("读取本机网络接口失败: %w", err)
+	}
+	for name, addrs := range ifaces {
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ipNet.Contains(network.IP) || network.Contains(ipNet.IP) {
+				return fmt.Errorf("VIP 地址段 %s 与网络接口 %s 的地址 %s 冲突", network, name, ipNet)
+			}
+		}
+	}
+	return nil
+}
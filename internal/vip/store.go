@@ -0,0 +1,103 @@
+package vip
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// store.go 按 Server 持久化域名 → VIP 分配，重启后同一域名仍使用同一 VIP
+// SSH known_hosts、数据库客户端保存的连接串、GenerateKubeconfig 写入的地址都依赖 VIP 不变
+// 每个 Server 地址对应一个文件，切换 Server 不会串用其他 Server 的分配
+
+// Store VIP 分配的持久化文件
+type Store struct {
+	path   string
+	server string
+}
+
+// storeFile 持久化文件内容
+type storeFile struct {
+	Server      string            `json:"server"`      // 所属 Server 地址
+	Assignments map[string]string `json:"assignments"` // 域名 → VIP
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// StoreFileName 返回 Server 对应的持久化文件名，地址中文件名不允许的字符替换为下划线
+func StoreFileName(server string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, strings.ToLower(strings.TrimSpace(server)))
+	if name == "" {
+		name = "default"
+	}
+	return name + ".json"
+}
+
+// NewStore 创建 Server 的 VIP 分配持久化文件
+func NewStore(path, server string) *Store {
+	return &Store{path: path, server: server}
+}
+
+// Path 返回持久化文件路径
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Load 读取已保存的分配，文件不存在时返回空映射
+// 文件属于其他 Server（文件名冲突）时返回错误，不使用其中的分配
+func (s *Store) Load() (map[string]string, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取 VIP 分配失败: %w", err)
+	}
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("VIP 分配文件损坏: %w", err)
+	}
+	if file.Server != s.server {
+		return nil, fmt.Errorf("VIP 分配文件属于其他 Server: %s", file.Server)
+	}
+	if file.Assignments == nil {
+		file.Assignments = map[string]string{}
+	}
+	return file.Assignments, nil
+}
+
+// Save 保存全部分配（先写临时文件再重命名，避免写到一半崩溃留下损坏的文件）
+func (s *Store) Save(assignments map[string]string) error {
+	data, err := json.MarshalIndent(storeFile{
+		Server:      s.server,
+		Assignments: assignments,
+		UpdatedAt:   time.Now(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化 VIP 分配失败: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("写入 VIP 分配失败: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("写入 VIP 分配失败: %w", err)
+	}
+	return nil
+}
+
+// Delete 删除持久化文件（不存在时不报错）
+func (s *Store) Delete() error {
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除 VIP 分配失败: %w", err)
+	}
+	return nil
+}
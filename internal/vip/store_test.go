@@ -0,0 +1,143 @@
+package vip
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAssignmentsSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), StoreFileName("signaling.example.com:8081"))
+
+	first := NewAllocator()
+	if _, err := first.SetStore(NewStore(path, "signaling.example.com:8081")); err != nil {
+		t.Fatal(err)
+	}
+	pg, _ := first.Allocate("pg.yygl.beijing.beagle")
+	redis, _ := first.Allocate("redis.yygl.beijing.beagle")
+
+	// 重启后按相反顺序解析，地址保持不变
+	second := NewAllocator()
+	restored, err := second.SetStore(NewStore(path, "signaling.example.com:8081"))
+	if err != nil || restored != 2 {
+		t.Fatalf("expected 2 restored assignments, got %d (err=%v)", restored, err)
+	}
+	if got, _ := second.Allocate("redis.yygl.beijing.beagle"); got != redis {
+		t.Fatalf("expected %s after restart, got %s", redis, got)
+	}
+	if got, _ := second.Allocate("pg.yygl.beijing.beagle"); got != pg {
+		t.Fatalf("expected %s after restart, got %s", pg, got)
+	}
+	// 新域名不能拿到已固定分配给其他域名的地址
+	if got, _ := second.Allocate("mysql.yygl.beijing.beagle"); got == pg || got == redis {
+		t.Fatalf("new domain must not reuse a reserved VIP, got %s", got)
+	}
+}
+
+func TestReleasedDomainKeepsItsVIP(t *testing.T) {
+	allocator := NewAllocator()
+	first, _ := allocator.Allocate("a.beagle")
+	allocator.Release("a.beagle")
+	other, _ := allocator.Allocate("b.beagle")
+	again, _ := allocator.Allocate("a.beagle")
+	if again != first || other == first {
+		t.Fatalf("expected a.beagle to get %s again and b.beagle a different VIP, got %s / %s", first, again, other)
+	}
+}
+
+func TestRestoredAssignmentsDoNotExpire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vip.json")
+	first := NewAllocator()
+	first.SetStore(NewStore(path, "server"))
+	pg, _ := first.Allocate("pg.beagle")
+	first.Release("pg.beagle")
+
+	// 重启后长时间不再访问该域名，地址段未耗尽时分配一直保留
+	second := NewAllocator()
+	now := time.Now()
+	second.now = func() time.Time { return now }
+	if _, err := second.SetStore(NewStore(path, "server")); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * DefaultQuarantine)
+	second.Allocate("other.beagle")
+	if got, _ := second.Allocate("pg.beagle"); got != pg {
+		t.Fatalf("expected restored %s to survive the quarantine period, got %s", pg, got)
+	}
+	saved, _ := NewStore(path, "server").Load()
+	if saved["pg.beagle"] != pg {
+		t.Fatalf("restored assignment must stay in the file, got %v", saved)
+	}
+}
+
+func TestSetStoreDropsConflictingAssignments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vip.json")
+	store := NewStore(path, "server")
+	if err := store.Save(map[string]string{
+		"a.beagle": "127.1.0.1",
+		"b.beagle": "127.1.0.1",   // 与 a.beagle 重复
+		"c.beagle": "10.0.0.1",    // 不在 VIP 地址段内
+		"d.beagle": "127.1.0.255", // 广播地址
+		"e.beagle": "not-an-ip",
+		"f.beagle": "127.1.0.7",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	allocator := NewAllocator()
+	restored, err := allocator.SetStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a / b 只能保留其中一个（map 遍历顺序不确定）
+	if restored != 2 {
+		t.Fatalf("expected 2 valid assignments, got %d", restored)
+	}
+	saved, _ := store.Load()
+	if len(saved) != 2 || saved["f.beagle"] != "127.1.0.7" {
+		t.Fatalf("conflicting assignments must be dropped from the file, got %v", saved)
+	}
+}
+
+func TestStoreRejectsOtherServerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vip.json")
+	if err := NewStore(path, "server-a").Save(map[string]string{"a.beagle": "127.1.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	allocator := NewAllocator()
+	if _, err := allocator.SetStore(NewStore(path, "server-b")); err == nil {
+		t.Fatal("expected error for a file written for another server")
+	}
+	if _, ok := allocator.GetVIP("a.beagle"); ok {
+		t.Fatal("assignments of another server must not be used")
+	}
+}
+
+func TestResetClearsAssignmentsAndFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vip.json")
+	allocator := NewAllocator()
+	allocator.SetStore(NewStore(path, "server"))
+	allocator.Allocate("a.beagle")
+	allocator.Allocate("b.beagle")
+
+	active, err := allocator.Reset()
+	if err != nil || len(active) != 2 {
+		t.Fatalf("expected 2 active mappings, got %v (err=%v)", active, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("reset must delete the persisted assignments")
+	}
+	if got, _ := allocator.Allocate("b.beagle"); got != "127.1.0.1" {
+		t.Fatalf("expected allocation to restart from 127.1.0.1, got %s", got)
+	}
+}
+
+func TestStoreFileName(t *testing.T) {
+	if got := StoreFileName("Signaling.Example.com:8081"); got != "signaling.example.com_8081.json" {
+		t.Fatalf("unexpected file name %q", got)
+	}
+	if got := StoreFileName(""); got != "default.json" {
+		t.Fatalf("unexpected file name %q", got)
+	}
+}
@@ -311,6 +311,7 @@ type DesktopAuthenticateResponse struct {
 	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`                      // 响应消息
 	AuthKey       string                 `protobuf:"bytes,3,opt,name=auth_key,json=authKey,proto3" json:"auth_key,omitempty"`       // Tailscale PreAuthKey（如需重新连接）
 	ServerUrl     string                 `protobuf:"bytes,4,opt,name=server_url,json=serverUrl,proto3" json:"server_url,omitempty"` // Headscale 服务器地址
+	DnsZones      []string               `protobuf:"bytes,5,rep,name=dns_zones,json=dnsZones,proto3" json:"dns_zones,omitempty"`    // 本地 DNS 拦截的内部域名后缀（如 beagle、corp.internal），为空时使用默认 beagle
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -373,6 +374,13 @@ func (x *DesktopAuthenticateResponse) GetServerUrl() string {
 	return ""
 }
 
+func (x *DesktopAuthenticateResponse) GetDnsZones() []string {
+	if x != nil {
+		return x.DnsZones
+	}
+	return nil
+}
+
 // DesktopHeartbeatRequest Desktop 心跳请求
 type DesktopHeartbeatRequest struct {
 	state           protoimpl.MessageState `protogen:"open.v1"`
@@ -437,11 +445,14 @@ func (x *DesktopHeartbeatRequest) GetTunnelConnected() bool {
 // AuthorizedService 已授权服务
 type AuthorizedService struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`                                   // 服务 ID
-	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`                               // 服务名称
-	AgentName     string                 `protobuf:"bytes,3,opt,name=agent_name,json=agentName,proto3" json:"agent_name,omitempty"`    // 所属 Agent 名称
-	ListenAddr    string                 `protobuf:"bytes,4,opt,name=listen_addr,json=listenAddr,proto3" json:"listen_addr,omitempty"` // 源地址（VPN 地址，如 100.64.0.1:3306）
-	TargetAddr    string                 `protobuf:"bytes,5,opt,name=target_addr,json=targetAddr,proto3" json:"target_addr,omitempty"` // 目标地址（内网地址，如 192.168.1.10:3306）
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`                                    // 服务 ID
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`                                // 服务名称
+	AgentName     string                 `protobuf:"bytes,3,opt,name=agent_name,json=agentName,proto3" json:"agent_name,omitempty"`     // 所属 Agent 名称
+	ListenAddr    string                 `protobuf:"bytes,4,opt,name=listen_addr,json=listenAddr,proto3" json:"listen_addr,omitempty"`  // 源地址（VPN 地址，如 100.64.0.1:3306）
+	TargetAddr    string                 `protobuf:"bytes,5,opt,name=target_addr,json=targetAddr,proto3" json:"target_addr,omitempty"`  // 目标地址（内网地址，如 192.168.1.10:3306）
+	Type          string                 `protobuf:"bytes,6,opt,name=type,proto3" json:"type,omitempty"`                                // 服务类型：tcp / web（为空时按 tcp 处理）
+	Domain        string                 `protobuf:"bytes,7,opt,name=domain,proto3" json:"domain,omitempty"`                            // 服务域名（web 类型时，浏览器通过该域名访问）
+	BackendTls    bool                   `protobuf:"varint,8,opt,name=backend_tls,json=backendTls,proto3" json:"backend_tls,omitempty"` // 后端是否为 HTTPS（web 类型时）
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -511,6 +522,27 @@ func (x *AuthorizedService) GetTargetAddr() string {
 	return ""
 }
 
+func (x *AuthorizedService) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *AuthorizedService) GetDomain() string {
+	if x != nil {
+		return x.Domain
+	}
+	return ""
+}
+
+func (x *AuthorizedService) GetBackendTls() bool {
+	if x != nil {
+		return x.BackendTls
+	}
+	return false
+}
+
 // DesktopHeartbeatResponse Desktop 心跳响应（纯心跳确认，不携带业务数据）
 type DesktopHeartbeatResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -2126,20 +2158,24 @@ func (x *ResolveDomainRequest) GetDomain() string {
 
 // ResolveDomainResponse 域名解析响应
 type ResolveDomainResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`                                  // 是否成功
-	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`                                   // 响应消息
-	Domain        string                 `protobuf:"bytes,3,opt,name=domain,proto3" json:"domain,omitempty"`                                     // 域名
-	AgentIp       string                 `protobuf:"bytes,4,opt,name=agent_ip,json=agentIp,proto3" json:"agent_ip,omitempty"`                    // Agent 的 Tailscale IP
-	TargetPort    int32                  `protobuf:"varint,5,opt,name=target_port,json=targetPort,proto3" json:"target_port,omitempty"`          // 目标端口
-	AgentName     string                 `protobuf:"bytes,6,opt,name=agent_name,json=agentName,proto3" json:"agent_name,omitempty"`              // Agent 名称
-	DomainType    string                 `protobuf:"bytes,7,opt,name=domain_type,json=domainType,proto3" json:"domain_type,omitempty"`           // 域名类型
-	Namespace     string                 `protobuf:"bytes,8,opt,name=namespace,proto3" json:"namespace,omitempty"`                               // K8S 命名空间（k8ssvc 类型时）
-	ServiceName   string                 `protobuf:"bytes,9,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`        // K8S Service 名称（k8ssvc 类型时）
-	SvcProxyPort  int32                  `protobuf:"varint,10,opt,name=svc_proxy_port,json=svcProxyPort,proto3" json:"svc_proxy_port,omitempty"` // Agent SVCProxy gRPC 端口（k8ssvc 类型时，默认 9090）
-	EndpointName  string                 `protobuf:"bytes,11,opt,name=endpoint_name,json=endpointName,proto3" json:"endpoint_name,omitempty"`    // Endpoint 名称（Endpoint 跳跃时，非空表示需要走 Endpoint 路径）
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Success          bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`                                              // 是否成功
+	Message          string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`                                               // 响应消息
+	Domain           string                 `protobuf:"bytes,3,opt,name=domain,proto3" json:"domain,omitempty"`                                                 // 域名
+	AgentIp          string                 `protobuf:"bytes,4,opt,name=agent_ip,json=agentIp,proto3" json:"agent_ip,omitempty"`                                // Agent 的 Tailscale IP
+	TargetPort       int32                  `protobuf:"varint,5,opt,name=target_port,json=targetPort,proto3" json:"target_port,omitempty"`                      // 目标端口
+	AgentName        string                 `protobuf:"bytes,6,opt,name=agent_name,json=agentName,proto3" json:"agent_name,omitempty"`                          // Agent 名称
+	DomainType       string                 `protobuf:"bytes,7,opt,name=domain_type,json=domainType,proto3" json:"domain_type,omitempty"`                       // 域名类型
+	Namespace        string                 `protobuf:"bytes,8,opt,name=namespace,proto3" json:"namespace,omitempty"`                                           // K8S 命名空间（k8ssvc 类型时）
+	ServiceName      string                 `protobuf:"bytes,9,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`                    // K8S Service 名称（k8ssvc 类型时）
+	SvcProxyPort     int32                  `protobuf:"varint,10,opt,name=svc_proxy_port,json=svcProxyPort,proto3" json:"svc_proxy_port,omitempty"`             // Agent SVCProxy gRPC 端口（k8ssvc 类型时，默认 9090）
+	EndpointName     string                 `protobuf:"bytes,11,opt,name=endpoint_name,json=endpointName,proto3" json:"endpoint_name,omitempty"`                // Endpoint 名称（Endpoint 跳跃时，非空表示需要走 Endpoint 路径）
+	UdpPorts         []int32                `protobuf:"varint,12,rep,packed,name=udp_ports,json=udpPorts,proto3" json:"udp_ports,omitempty"`                    // UDP 端口列表（服务需要 UDP 转发时，如 DNS / syslog / QUIC）
+	ProxyProtocol    string                 `protobuf:"bytes,13,opt,name=proxy_protocol,json=proxyProtocol,proto3" json:"proxy_protocol,omitempty"`             // 远程连接上发送的 PROXY protocol 版本（v1 / v2，为空时不发送）
+	ProxyProtocolTlv bool                   `protobuf:"varint,14,opt,name=proxy_protocol_tlv,json=proxyProtocolTlv,proto3" json:"proxy_protocol_tlv,omitempty"` // PROXY protocol v2 头部是否附加用户名 / Desktop ID TLV
+	BackendTls       bool                   `protobuf:"varint,15,opt,name=backend_tls,json=backendTls,proto3" json:"backend_tls,omitempty"`                     // 后端是否为 HTTPS（web 类型时）
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
 }
 
 func (x *ResolveDomainResponse) Reset() {
@@ -2249,6 +2285,34 @@ func (x *ResolveDomainResponse) GetEndpointName() string {
 	return ""
 }
 
+func (x *ResolveDomainResponse) GetUdpPorts() []int32 {
+	if x != nil {
+		return x.UdpPorts
+	}
+	return nil
+}
+
+func (x *ResolveDomainResponse) GetProxyProtocol() string {
+	if x != nil {
+		return x.ProxyProtocol
+	}
+	return ""
+}
+
+func (x *ResolveDomainResponse) GetProxyProtocolTlv() bool {
+	if x != nil {
+		return x.ProxyProtocolTlv
+	}
+	return false
+}
+
+func (x *ResolveDomainResponse) GetBackendTls() bool {
+	if x != nil {
+		return x.BackendTls
+	}
+	return false
+}
+
 // GetResourcesRequest 资源发现请求
 type GetResourcesRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -2808,6 +2872,7 @@ type DomainItem struct {
 	ServiceName   string                 `protobuf:"bytes,7,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`            // K8S Service 名称（k8ssvc 类型时）
 	Region        string                 `protobuf:"bytes,8,opt,name=region,proto3" json:"region,omitempty"`                                         // 区域名称（从 domain 解析，如 beijing）
 	EndpointId    string                 `protobuf:"bytes,9,opt,name=endpoint_id,json=endpointId,proto3" json:"endpoint_id,omitempty"`               // Endpoint 名称（Endpoint 域名时填充，Device 域名时为空）
+	UdpPorts      []int32                `protobuf:"varint,10,rep,packed,name=udp_ports,json=udpPorts,proto3" json:"udp_ports,omitempty"`            // UDP 端口列表（服务需要 UDP 转发时）
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -2905,6 +2970,13 @@ func (x *DomainItem) GetEndpointId() string {
 	return ""
 }
 
+func (x *DomainItem) GetUdpPorts() []int32 {
+	if x != nil {
+		return x.UdpPorts
+	}
+	return nil
+}
+
 // GetDomainListResponse 获取域名列表响应
 type GetDomainListResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -3073,18 +3145,19 @@ const file_desktop_pkg_proto_desktop_proto_rawDesc = "" +
 	"\x06secret\x18\x02 \x01(\tR\x06secret\x12-\n" +
 	"\x12device_fingerprint\x18\x03 \x01(\tR\x11deviceFingerprint\x12F\n" +
 	"\vsystem_info\x18\x04 \x01(\v2%.awecloud.signaling.DesktopSystemInfoR\n" +
-	"systemInfo\"\x8b\x01\n" +
+	"systemInfo\"\xa8\x01\n" +
 	"\x1bDesktopAuthenticateResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
 	"\amessage\x18\x02 \x01(\tR\amessage\x12\x19\n" +
 	"\bauth_key\x18\x03 \x01(\tR\aauthKey\x12\x1d\n" +
 	"\n" +
-	"server_url\x18\x04 \x01(\tR\tserverUrl\"\x80\x01\n" +
+	"server_url\x18\x04 \x01(\tR\tserverUrl\x12\x1b\n" +
+	"\tdns_zones\x18\x05 \x03(\tR\bdnsZones\"\x80\x01\n" +
 	"\x17DesktopHeartbeatRequest\x12\x1d\n" +
 	"\n" +
 	"desktop_id\x18\x01 \x01(\x04R\tdesktopId\x12\x1b\n" +
 	"\ttunnel_ip\x18\x02 \x01(\tR\btunnelIp\x12)\n" +
-	"\x10tunnel_connected\x18\x03 \x01(\bR\x0ftunnelConnected\"\x98\x01\n" +
+	"\x10tunnel_connected\x18\x03 \x01(\bR\x0ftunnelConnected\"\xe5\x01\n" +
 	"\x11AuthorizedService\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
 	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1d\n" +
@@ -3093,7 +3166,11 @@ const file_desktop_pkg_proto_desktop_proto_rawDesc = "" +
 	"\vlisten_addr\x18\x04 \x01(\tR\n" +
 	"listenAddr\x12\x1f\n" +
 	"\vtarget_addr\x18\x05 \x01(\tR\n" +
-	"targetAddr\" \n" +
+	"targetAddr\x12\x12\n" +
+	"\x04type\x18\x06 \x01(\tR\x04type\x12\x16\n" +
+	"\x06domain\x18\a \x01(\tR\x06domain\x12\x1f\n" +
+	"\vbackend_tls\x18\b \x01(\bR\n" +
+	"backendTls\" \n" +
 	"\x18DesktopHeartbeatResponseJ\x04\b\x01\x10\x02\"{\n" +
 	"\x12DesktopDataRequest\x12\x1d\n" +
 	"\n" +
@@ -3220,7 +3297,7 @@ const file_desktop_pkg_proto_desktop_proto_rawDesc = "" +
 	"\x14ResolveDomainRequest\x12\x1d\n" +
 	"\n" +
 	"desktop_id\x18\x01 \x01(\x04R\tdesktopId\x12\x16\n" +
-	"\x06domain\x18\x02 \x01(\tR\x06domain\"\xeb\x02\n" +
+	"\x06domain\x18\x02 \x01(\tR\x06domain\"\xfe\x03\n" +
 	"\x15ResolveDomainResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
 	"\amessage\x18\x02 \x01(\tR\amessage\x12\x16\n" +
@@ -3236,7 +3313,12 @@ const file_desktop_pkg_proto_desktop_proto_rawDesc = "" +
 	"\fservice_name\x18\t \x01(\tR\vserviceName\x12$\n" +
 	"\x0esvc_proxy_port\x18\n" +
 	" \x01(\x05R\fsvcProxyPort\x12#\n" +
-	"\rendpoint_name\x18\v \x01(\tR\fendpointName\"4\n" +
+	"\rendpoint_name\x18\v \x01(\tR\fendpointName\x12\x1b\n" +
+	"\tudp_ports\x18\f \x03(\x05R\budpPorts\x12%\n" +
+	"\x0eproxy_protocol\x18\r \x01(\tR\rproxyProtocol\x12,\n" +
+	"\x12proxy_protocol_tlv\x18\x0e \x01(\bR\x10proxyProtocolTlv\x12\x1f\n" +
+	"\vbackend_tls\x18\x0f \x01(\bR\n" +
+	"backendTls\"4\n" +
 	"\x13GetResourcesRequest\x12\x1d\n" +
 	"\n" +
 	"desktop_id\x18\x01 \x01(\x04R\tdesktopId\"|\n" +
@@ -3296,7 +3378,7 @@ const file_desktop_pkg_proto_desktop_proto_rawDesc = "" +
 	"\bssh_user\x18\x0f \x01(\tR\asshUser\"5\n" +
 	"\x14GetDomainListRequest\x12\x1d\n" +
 	"\n" +
-	"desktop_id\x18\x01 \x01(\x04R\tdesktopId\"\x8c\x02\n" +
+	"desktop_id\x18\x01 \x01(\x04R\tdesktopId\"\xa9\x02\n" +
 	"\n" +
 	"DomainItem\x12\x16\n" +
 	"\x06domain\x18\x01 \x01(\tR\x06domain\x12\x12\n" +
@@ -3308,7 +3390,9 @@ const file_desktop_pkg_proto_desktop_proto_rawDesc = "" +
 	"\fservice_name\x18\a \x01(\tR\vserviceName\x12\x16\n" +
 	"\x06region\x18\b \x01(\tR\x06region\x12\x1f\n" +
 	"\vendpoint_id\x18\t \x01(\tR\n" +
-	"endpointId\"Q\n" +
+	"endpointId\x12\x1b\n" +
+	"\tudp_ports\x18\n" +
+	" \x03(\x05R\budpPorts\"Q\n" +
 	"\x15GetDomainListResponse\x128\n" +
 	"\adomains\x18\x01 \x03(\v2\x1e.awecloud.signaling.DomainItemR\adomains\"\xec\x01\n" +
 	"\fSVCProxyData\x12\x1c\n" +